@@ -0,0 +1,8 @@
+//go:build azure_blob
+// +build azure_blob
+
+package cli
+
+import (
+	_ "github.com/nokia/migrate/v4/source/azure_blob"
+)
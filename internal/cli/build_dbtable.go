@@ -0,0 +1,8 @@
+//go:build dbtable
+// +build dbtable
+
+package cli
+
+import (
+	_ "github.com/nokia/migrate/v4/source/dbtable"
+)
@@ -0,0 +1,8 @@
+//go:build dynamodb
+// +build dynamodb
+
+package cli
+
+import (
+	_ "github.com/nokia/migrate/v4/source/dynamodb"
+)
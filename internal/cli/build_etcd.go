@@ -0,0 +1,8 @@
+//go:build etcd
+// +build etcd
+
+package cli
+
+import (
+	_ "github.com/nokia/migrate/v4/source/etcd"
+)
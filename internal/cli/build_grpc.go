@@ -0,0 +1,8 @@
+//go:build grpc
+// +build grpc
+
+package cli
+
+import (
+	_ "github.com/nokia/migrate/v4/source/grpc"
+)
@@ -0,0 +1,8 @@
+//go:build mongodb_gridfs
+// +build mongodb_gridfs
+
+package cli
+
+import (
+	_ "github.com/nokia/migrate/v4/source/mongodb_gridfs"
+)
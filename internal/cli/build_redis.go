@@ -0,0 +1,8 @@
+//go:build redis
+// +build redis
+
+package cli
+
+import (
+	_ "github.com/nokia/migrate/v4/source/redis"
+)
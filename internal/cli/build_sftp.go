@@ -0,0 +1,8 @@
+//go:build sftp
+// +build sftp
+
+package cli
+
+import (
+	_ "github.com/nokia/migrate/v4/source/sftp"
+)
@@ -84,6 +84,10 @@ type Migrate struct {
 
 	// Current application release
 	AppReleaseStr string
+
+	// SkipEmptyDown skips down migrations the source driver reports as
+	// empty instead of running them, see source.EmptyDownReporter.
+	SkipEmptyDown bool
 }
 
 // New returns a new Migrate instance from a source URL and a database URL.
@@ -761,13 +765,13 @@ func (m *Migrate) runMigrations(ret <-chan interface{}) error {
 			if migr.Body != nil {
 				m.logVerbosePrintf("Read and execute %v\n", migr.LogString())
 				if err := m.databaseDrv.Run(migr.BufferedBody); err != nil {
-					m.sourceDrv.UpdateStatus(migr.Version, source.Failed, err.Error())
+					m.updateStatus(migr, source.Failed, err.Error())
 					return err
 				}
 			} else if migr.MigrationFunc != nil {
 				m.logVerbosePrintf("Running Migration function %v\n", migr.LogString())
 				if err := m.databaseDrv.RunFunctionMigration(migr.MigrationFunc); err != nil {
-					m.sourceDrv.UpdateStatus(migr.Version, source.Failed, err.Error())
+					m.updateStatus(migr, source.Failed, err.Error())
 					return err
 				}
 			}
@@ -783,9 +787,9 @@ func (m *Migrate) runMigrations(ret <-chan interface{}) error {
 
 			// update status
 			if migr.Skipped {
-				m.sourceDrv.UpdateStatus(migr.Version, source.Skipped, "")
+				m.updateStatus(migr, source.Skipped, migr.SkipReason)
 			} else {
-				m.sourceDrv.UpdateStatus(migr.Version, source.Done, "")
+				m.updateStatus(migr, source.Done, "")
 			}
 			// log either verbose or normal
 			if m.Log != nil {
@@ -907,6 +911,14 @@ func (m *Migrate) newMigration(version uint, targetVersion int) (*Migration, err
 
 		} else if err != nil {
 			return nil, err
+		} else if m.isEmptyDown(version) {
+			if r != nil {
+				if err := r.Close(); err != nil {
+					return nil, err
+				}
+			}
+			migr = NewSkippedMigration(identifier, version, targetVersion)
+			migr.SkipReason = source.EmptyDownReason
 		} else if fn != nil {
 			// create migration with function
 			migr = NewFuncMigration(fn, identifier, version, targetVersion)
@@ -928,6 +940,25 @@ func (m *Migrate) newMigration(version uint, targetVersion int) (*Migration, err
 	return migr, nil
 }
 
+// isEmptyDown returns true if SkipEmptyDown is set and the source driver
+// reports the down migration of version as empty.
+func (m *Migrate) isEmptyDown(version uint) bool {
+	if !m.SkipEmptyDown {
+		return false
+	}
+	return source.IsEmptyDown(m.sourceDrv, version)
+}
+
+// updateStatus records the status of migr with the source driver, only for
+// the direction migr ran in if the driver supports it.
+func (m *Migrate) updateStatus(migr *Migration, status source.Status, errstr string) {
+	dir := source.Up
+	if migr.TargetVersion < int(migr.Version) {
+		dir = source.Down
+	}
+	source.UpdateStatusDir(m.sourceDrv, migr.Version, dir, status, errstr)
+}
+
 func (m *Migrate) skipMigration(location string) bool {
 	parentDir := filepath.Dir(location)
 	if parentDir != "." && parentDir < m.AppReleaseStr {
@@ -876,6 +876,54 @@ func TestUpAndDown(t *testing.T) {
 	equalDbSeq(t, 1, expectedSequence, dbDrv)
 }
 
+func TestUpAndDownStatusDir(t *testing.T) {
+	m, _ := New("stub://", "stub://")
+	migrations := source.NewMigrations()
+	migrations.Append(&source.Migration{Version: 1, Direction: source.Up, Identifier: "CREATE 1"})
+	migrations.Append(&source.Migration{Version: 1, Direction: source.Down, Identifier: "DROP 1"})
+	migrations.Append(&source.Migration{Version: 2, Direction: source.Up, Identifier: "CREATE 2"})
+	migrations.Append(&source.Migration{Version: 2, Direction: source.Down, Identifier: "DROP 2"})
+	m.sourceDrv.(*sStub.Stub).Migrations = migrations
+	status := func(version uint, dir source.Direction) source.Status {
+		read := migrations.Up
+		if dir == source.Down {
+			read = migrations.Down
+		}
+		migr, _ := read(version)
+		return migr.Status
+	}
+	untouched := status(1, source.Down)
+
+	// going up leaves the down migrations alone
+	if err := m.Up(); err != nil {
+		t.Fatal(err)
+	}
+	for _, version := range []uint{1, 2} {
+		if s := status(version, source.Up); s != source.Done {
+			t.Errorf("expected up migration %v to be %v, got %v", version, source.Done, s)
+		}
+		if s := status(version, source.Down); s != untouched {
+			t.Errorf("expected down migration %v to stay %q, got %q", version, untouched, s)
+		}
+	}
+
+	// going down leaves the up migrations alone
+	if err := m.Steps(-1); err != nil {
+		t.Fatal(err)
+	}
+	if s := status(2, source.Down); s != source.Done {
+		t.Errorf("expected down migration 2 to be %v, got %v", source.Done, s)
+	}
+	if s := status(1, source.Down); s != untouched {
+		t.Errorf("expected down migration 1 to stay %q, got %q", untouched, s)
+	}
+	for _, version := range []uint{1, 2} {
+		if s := status(version, source.Up); s != source.Done {
+			t.Errorf("expected up migration %v to stay %v, got %v", version, source.Done, s)
+		}
+	}
+}
+
 func TestUpDirty(t *testing.T) {
 	m, _ := New("stub://", "stub://")
 	dbDrv := m.databaseDrv.(*dStub.Stub)
@@ -902,6 +950,56 @@ func TestDownDirty(t *testing.T) {
 	}
 }
 
+func TestDownSkipEmptyDown(t *testing.T) {
+	m, _ := New("stub://", "stub://")
+	migrations := source.NewMigrations()
+	migrations.Append(&source.Migration{Version: 1, Direction: source.Up, Identifier: "CREATE 1"})
+	migrations.Append(&source.Migration{Version: 1, Direction: source.Down, Identifier: "DROP 1"})
+	migrations.Append(&source.Migration{Version: 2, Direction: source.Up, Identifier: "CREATE 2"})
+	migrations.Append(&source.Migration{Version: 2, Direction: source.Down, Identifier: " \n", Empty: true})
+	stub := m.sourceDrv.(*sStub.Stub)
+	stub.Migrations = migrations
+	m.sourceDrv = emptyDownStub{stub}
+	m.SkipEmptyDown = true
+	dbDrv := m.databaseDrv.(*dStub.Stub)
+
+	if err := m.Up(); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Down(); err != nil {
+		t.Fatal(err)
+	}
+	// the empty down migration of version 2 is not run
+	expectedSequence := migrationSequence{
+		mr("CREATE 1"),
+		mr("CREATE 2"),
+		mr("DROP 1"),
+	}
+	equalDbSeq(t, 0, expectedSequence, dbDrv)
+	if _, _, err := m.Version(); err != ErrNilVersion {
+		t.Errorf("expected ErrNilVersion, got %v", err)
+	}
+
+	down, _ := migrations.Down(2)
+	if down.Status != source.Skipped || down.Error != source.EmptyDownReason {
+		t.Errorf("expected down migration 2 to be %v with %q, got %v with %q",
+			source.Skipped, source.EmptyDownReason, down.Status, down.Error)
+	}
+	if down, _ := migrations.Down(1); down.Status != source.Done {
+		t.Errorf("expected down migration 1 to be %v, got %v", source.Done, down.Status)
+	}
+}
+
+// emptyDownStub is a source stub reporting the down migrations flagged as
+// Empty, like the drivers detecting them while loading do.
+type emptyDownStub struct {
+	*sStub.Stub
+}
+
+func (s emptyDownStub) IsEmptyDown(version uint) bool {
+	return s.Migrations.IsEmptyDown(version)
+}
+
 func TestDrop(t *testing.T) {
 	m, _ := New("stub://", "stub://")
 	m.sourceDrv.(*sStub.Stub).Migrations = sourceStubMigrations
@@ -62,6 +62,9 @@ type Migration struct {
 
 	// marked migration as skipped.
 	Skipped bool
+
+	// SkipReason optionally tells why the migration was skipped.
+	SkipReason string
 }
 
 // NewMigration returns a new Migration and sets the body, identifier,
@@ -0,0 +1,130 @@
+//go:build go1.16
+// +build go1.16
+
+// Package archive provides a source driver that reads migrations from a
+// zip or tar archive, optionally gzip compressed.
+package archive
+
+import (
+	"archive/zip"
+	"bufio"
+	"compress/gzip"
+	"fmt"
+	"io"
+	nurl "net/url"
+	"os"
+	"path/filepath"
+
+	"github.com/nokia/migrate/v4/source"
+	"github.com/nokia/migrate/v4/source/iofs"
+)
+
+func init() {
+	source.Register("zip", &Archive{})
+	source.Register("tar", &Archive{})
+}
+
+type Archive struct {
+	iofs.PartialDriver
+}
+
+// Open is part of source.Driver interface implementation.
+// The URL path names the archive file, followed by the directory holding
+// the migrations inside the archive, e.g.
+// zip:///path/to/migrations.zip/db/migrations.
+func (a *Archive) Open(url string) (source.Driver, error) {
+	u, err := nurl.Parse(url)
+	if err != nil {
+		return nil, err
+	}
+	archivePath, dir, err := splitPath(u.Host + u.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	switch u.Scheme {
+	case "zip":
+		r, err := zip.OpenReader(archivePath)
+		if err != nil {
+			return nil, err
+		}
+		na := &Archive{}
+		if err := na.Init(r, dir); err != nil {
+			r.Close()
+			return nil, err
+		}
+		return na, nil
+	case "tar":
+		f, err := os.Open(archivePath)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		return NewTar(f, dir)
+	default:
+		return nil, fmt.Errorf("unsupported archive scheme %q", u.Scheme)
+	}
+}
+
+// NewZip returns a driver reading the migrations in dir of the zip
+// archive r of the given size.
+func NewZip(r io.ReaderAt, size int64, dir string) (source.Driver, error) {
+	zr, err := zip.NewReader(r, size)
+	if err != nil {
+		return nil, err
+	}
+	a := &Archive{}
+	if err := a.Init(zr, dir); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+// NewTar returns a driver reading the migrations in dir of the tar archive
+// read from r, which may be gzip compressed. The archive is read into
+// memory, r is not used after NewTar returns.
+func NewTar(r io.Reader, dir string) (source.Driver, error) {
+	br := bufio.NewReader(r)
+	if magic, err := br.Peek(2); err == nil && magic[0] == 0x1f && magic[1] == 0x8b {
+		gr, err := gzip.NewReader(br)
+		if err != nil {
+			return nil, err
+		}
+		defer gr.Close()
+		r = gr
+	} else {
+		r = br
+	}
+	tfs, err := newTarFS(r)
+	if err != nil {
+		return nil, err
+	}
+	a := &Archive{}
+	if err := a.Init(tfs, dir); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+// splitPath splits p into the path of the archive file, which is the
+// longest prefix of p naming a regular file, and the directory inside of
+// the archive.
+func splitPath(p string) (archivePath, dir string, err error) {
+	if len(p) == 0 {
+		return "", "", fmt.Errorf("missing archive path")
+	}
+	p = filepath.FromSlash(p)
+	for candidate := p; ; candidate = filepath.Dir(candidate) {
+		fi, err := os.Stat(candidate)
+		if err == nil && fi.Mode().IsRegular() {
+			rel, err := filepath.Rel(candidate, p)
+			if err != nil {
+				return "", "", err
+			}
+			return candidate, filepath.ToSlash(rel), nil
+		}
+		if filepath.Dir(candidate) == candidate {
+			return "", "", fmt.Errorf("no archive file found in %v: %w", p, os.ErrNotExist)
+		}
+	}
+}
@@ -0,0 +1,171 @@
+//go:build go1.16
+// +build go1.16
+
+package archive
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+
+	st "github.com/nokia/migrate/v4/source/testing"
+)
+
+var migrations = map[string]string{
+	"db/migrations/1_foobar.up.sql":   "1 up",
+	"db/migrations/1_foobar.down.sql": "1 down",
+	"db/migrations/3_foobar.up.sql":   "3 up",
+	"db/migrations/4_foobar.up.sql":   "4 up",
+	"db/migrations/4_foobar.down.sql": "4 down",
+	"db/migrations/5_foobar.down.sql": "5 down",
+	"db/migrations/7_foobar.up.sql":   "7 up",
+	"db/migrations/7_foobar.down.sql": "7 down",
+	"db/README.md":                    "not a migration",
+}
+
+func buildZip(t *testing.T) []byte {
+	var buf bytes.Buffer
+	w := zip.NewWriter(&buf)
+	for name, body := range migrations {
+		f, err := w.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := f.Write([]byte(body)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func buildTarGz(t *testing.T) []byte {
+	var buf bytes.Buffer
+	gw := gzip.NewWriter(&buf)
+	w := tar.NewWriter(gw)
+	// directories are only present implicitly
+	for name, body := range migrations {
+		if err := w.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(body)), Typeflag: tar.TypeReg}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := w.Write([]byte(body)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := gw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestZip(t *testing.T) {
+	b := buildZip(t)
+	d, err := NewZip(bytes.NewReader(b), int64(len(b)), "db/migrations")
+	if err != nil {
+		t.Fatal(err)
+	}
+	st.Test(t, d)
+}
+
+func TestTar(t *testing.T) {
+	d, err := NewTar(bytes.NewReader(buildTarGz(t)), "db/migrations")
+	if err != nil {
+		t.Fatal(err)
+	}
+	st.Test(t, d)
+}
+
+func TestReadContent(t *testing.T) {
+	b := buildZip(t)
+	d, err := NewZip(bytes.NewReader(b), int64(len(b)), "db/migrations")
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, identifier, location, _, err := d.ReadDown(4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	body, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(body) != "4 down" || identifier != "foobar" || location != "db/migrations/4_foobar.down.sql" {
+		t.Errorf("unexpected read %q, %q, %q", body, identifier, location)
+	}
+}
+
+func TestTarFS(t *testing.T) {
+	tfs, err := newTarFS(bytes.NewReader(func() []byte {
+		var buf bytes.Buffer
+		w := tar.NewWriter(&buf)
+		w.WriteHeader(&tar.Header{Name: "db/", Mode: 0755, Typeflag: tar.TypeDir})
+		for name, body := range migrations {
+			w.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(body)), Typeflag: tar.TypeReg})
+			w.Write([]byte(body))
+		}
+		w.WriteHeader(&tar.Header{Name: "db/link.sql", Linkname: "db/README.md", Typeflag: tar.TypeSymlink})
+		w.Close()
+		return buf.Bytes()
+	}()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := fstest.TestFS(tfs, "db/README.md", "db/migrations/1_foobar.up.sql"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestOpen(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "TestOpen")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	zipPath := filepath.Join(tmpDir, "migrations.zip")
+	if err := ioutil.WriteFile(zipPath, buildZip(t), 0644); err != nil {
+		t.Fatal(err)
+	}
+	tarPath := filepath.Join(tmpDir, "migrations.tar.gz")
+	if err := ioutil.WriteFile(tarPath, buildTarGz(t), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, url := range []string{
+		"zip://" + filepath.ToSlash(zipPath) + "/db/migrations",
+		"tar://" + filepath.ToSlash(tarPath) + "/db/migrations",
+	} {
+		t.Run(url, func(t *testing.T) {
+			d, err := (&Archive{}).Open(url)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer d.Close()
+			if first, err := d.First(); err != nil || first != 1 {
+				t.Errorf("expected first version 1, got %v, %v", first, err)
+			}
+		})
+	}
+
+	for _, url := range []string{
+		"zip://" + filepath.ToSlash(tmpDir) + "/missing.zip/db/migrations",
+		"zip://" + filepath.ToSlash(zipPath) + "/missing",
+		"tar://" + filepath.ToSlash(zipPath) + "/db/migrations",
+	} {
+		if _, err := (&Archive{}).Open(url); err == nil {
+			t.Errorf("expected error opening %v", url)
+		}
+	}
+}
@@ -0,0 +1,159 @@
+//go:build go1.16
+// +build go1.16
+
+package archive
+
+import (
+	"archive/tar"
+	"bytes"
+	"io"
+	"io/fs"
+	"io/ioutil"
+	"path"
+	"sort"
+	"strings"
+	"time"
+)
+
+// tarFS is a read only fs.FS holding the directories and regular files of
+// a tar archive in memory. Other entries like links are left out.
+type tarFS struct {
+	entries map[string]*tarEntry
+}
+
+type tarEntry struct {
+	info     fs.FileInfo
+	data     []byte
+	children []*tarEntry
+}
+
+func newTarFS(r io.Reader) (*tarFS, error) {
+	t := &tarFS{entries: map[string]*tarEntry{
+		".": {info: dirInfo(".")},
+	}}
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return t, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		name := path.Clean(strings.TrimPrefix(hdr.Name, "/"))
+		if name == "." || !fs.ValidPath(name) {
+			continue
+		}
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			t.mkdirAll(name).info = hdr.FileInfo()
+		case tar.TypeReg:
+			data, err := ioutil.ReadAll(tr)
+			if err != nil {
+				return nil, err
+			}
+			if e, dup := t.entries[name]; dup {
+				// later entries win, like when extracting the archive
+				e.info, e.data = hdr.FileInfo(), data
+				continue
+			}
+			e := &tarEntry{info: hdr.FileInfo(), data: data}
+			parent := t.mkdirAll(path.Dir(name))
+			parent.children = append(parent.children, e)
+			t.entries[name] = e
+		}
+	}
+}
+
+// mkdirAll returns the directory entry of name, creating it and its
+// parents if needed.
+func (t *tarFS) mkdirAll(name string) *tarEntry {
+	if e, ok := t.entries[name]; ok {
+		return e
+	}
+	e := &tarEntry{info: dirInfo(path.Base(name))}
+	t.entries[name] = e
+	parent := t.mkdirAll(path.Dir(name))
+	parent.children = append(parent.children, e)
+	return e
+}
+
+// Open implements fs.FS.
+func (t *tarFS) Open(name string) (fs.File, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrInvalid}
+	}
+	e, ok := t.entries[name]
+	if !ok {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	}
+	if !e.info.IsDir() {
+		return &tarFile{Reader: bytes.NewReader(e.data), info: e.info}, nil
+	}
+	entries := make([]fs.DirEntry, len(e.children))
+	for i, c := range e.children {
+		entries[i] = dirEntry{c.info}
+	}
+	sort.Slice(entries, func(x, y int) bool {
+		return entries[x].Name() < entries[y].Name()
+	})
+	return &tarDir{info: e.info, entries: entries}, nil
+}
+
+type tarFile struct {
+	*bytes.Reader
+	info fs.FileInfo
+}
+
+func (f *tarFile) Stat() (fs.FileInfo, error) { return f.info, nil }
+func (f *tarFile) Close() error               { return nil }
+
+type tarDir struct {
+	info    fs.FileInfo
+	entries []fs.DirEntry
+	offset  int
+}
+
+func (d *tarDir) Stat() (fs.FileInfo, error) { return d.info, nil }
+func (d *tarDir) Close() error               { return nil }
+
+func (d *tarDir) Read([]byte) (int, error) {
+	return 0, &fs.PathError{Op: "read", Path: d.info.Name(), Err: fs.ErrInvalid}
+}
+
+// ReadDir implements fs.ReadDirFile.
+func (d *tarDir) ReadDir(n int) ([]fs.DirEntry, error) {
+	rest := d.entries[d.offset:]
+	if n <= 0 {
+		d.offset = len(d.entries)
+		return rest, nil
+	}
+	if len(rest) == 0 {
+		return nil, io.EOF
+	}
+	if n > len(rest) {
+		n = len(rest)
+	}
+	d.offset += n
+	return rest[:n], nil
+}
+
+type dirEntry struct {
+	info fs.FileInfo
+}
+
+func (e dirEntry) Name() string               { return e.info.Name() }
+func (e dirEntry) IsDir() bool                { return e.info.IsDir() }
+func (e dirEntry) Type() fs.FileMode          { return e.info.Mode().Type() }
+func (e dirEntry) Info() (fs.FileInfo, error) { return e.info, nil }
+
+// dirInfo describes a directory that has no entry of its own in the
+// archive.
+type dirInfo string
+
+func (i dirInfo) Name() string       { return string(i) }
+func (i dirInfo) Size() int64        { return 0 }
+func (i dirInfo) Mode() fs.FileMode  { return fs.ModeDir | 0555 }
+func (i dirInfo) ModTime() time.Time { return time.Time{} }
+func (i dirInfo) IsDir() bool        { return true }
+func (i dirInfo) Sys() interface{}   { return nil }
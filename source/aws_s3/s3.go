@@ -28,6 +28,9 @@ type s3Driver struct {
 type Config struct {
 	Bucket string
 	Prefix string
+	// Region is the AWS region of the bucket. If empty, the region is
+	// taken from the environment or shared config.
+	Region string
 }
 
 func (s *s3Driver) Open(folder string) (source.Driver, error) {
@@ -36,7 +39,11 @@ func (s *s3Driver) Open(folder string) (source.Driver, error) {
 		return nil, err
 	}
 
-	sess, err := session.NewSession()
+	awsConfig := aws.NewConfig()
+	if config.Region != "" {
+		awsConfig = awsConfig.WithRegion(config.Region)
+	}
+	sess, err := session.NewSession(awsConfig)
 	if err != nil {
 		return nil, err
 	}
@@ -72,6 +79,7 @@ func parseURI(uri string) (*Config, error) {
 	return &Config{
 		Bucket: u.Host,
 		Prefix: prefix,
+		Region: u.Query().Get("region"),
 	}, nil
 }
 
@@ -90,8 +98,8 @@ func (s *s3Driver) loadMigrations() error {
 		if err != nil {
 			continue
 		}
-		if !s.migrations.Append(m) {
-			return fmt.Errorf("unable to parse file %v", aws.StringValue(object.Key))
+		if err := s.migrations.AppendErr(m); err != nil {
+			return fmt.Errorf("unable to load %v: %w", aws.StringValue(object.Key), err)
 		}
 	}
 	return nil
@@ -159,6 +167,12 @@ func (s *s3Driver) UpdateStatus(version uint, status source.Status, errstr strin
 	s.migrations.UpdateStatus(version, status, errstr)
 }
 
+// UpdateStatusDir is like UpdateStatus, but only updates the migration of
+// direction dir.
+func (s *s3Driver) UpdateStatusDir(version uint, dir source.Direction, status source.Status, errstr string) {
+	s.migrations.UpdateStatusDir(version, dir, status, errstr)
+}
+
 func (s *s3Driver) PrintSummary(dir source.Direction) {
 	s.migrations.PrintSummary(dir)
 }
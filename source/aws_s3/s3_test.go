@@ -2,12 +2,14 @@ package awss3
 
 import (
 	"errors"
+	"io"
 	"io/ioutil"
 	"strings"
 	"testing"
 
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/nokia/migrate/v4/source"
 	st "github.com/nokia/migrate/v4/source/testing"
 	"github.com/stretchr/testify/assert"
 )
@@ -40,6 +42,65 @@ func Test(t *testing.T) {
 	st.Test(t, driver)
 }
 
+func TestReadContent(t *testing.T) {
+	s3Client := fakeS3{
+		bucket: "some-bucket",
+		objects: map[string]string{
+			"prod/migrations/2_foobar.up.sql":   "2 up",
+			"prod/migrations/1_foobar.up.sql":   "1 up",
+			"prod/migrations/1_foobar.down.sql": "1 down",
+		},
+	}
+	driver, err := WithInstance(&s3Client, &Config{
+		Bucket: "some-bucket",
+		Prefix: "prod/migrations/",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	first, err := driver.First()
+	assert.NoError(t, err)
+	assert.Equal(t, uint(1), first)
+	next, err := driver.Next(first)
+	assert.NoError(t, err)
+	assert.Equal(t, uint(2), next)
+
+	for _, tc := range []struct {
+		version uint
+		read    func(uint) (io.ReadCloser, string, string, source.MigrationFunc, error)
+		body    string
+	}{
+		{1, driver.ReadUp, "1 up"},
+		{1, driver.ReadDown, "1 down"},
+		{2, driver.ReadUp, "2 up"},
+	} {
+		r, _, _, _, err := tc.read(tc.version)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, err := ioutil.ReadAll(r)
+		assert.NoError(t, err)
+		assert.Equal(t, tc.body, string(body))
+	}
+}
+
+func TestDuplicateMigration(t *testing.T) {
+	s3Client := fakeS3{
+		bucket: "some-bucket",
+		objects: map[string]string{
+			"prod/migrations/1_foobar.up.sql": "1 up",
+			"prod/migrations/1_other.up.sql":  "1 up",
+		},
+	}
+	_, err := WithInstance(&s3Client, &Config{
+		Bucket: "some-bucket",
+		Prefix: "prod/migrations/",
+	})
+	var dup source.ErrDuplicateMigration
+	assert.True(t, errors.As(err, &dup), "expected ErrDuplicateMigration, got %v", err)
+}
+
 func TestParseURI(t *testing.T) {
 	tests := []struct {
 		name   string
@@ -76,6 +137,15 @@ func TestParseURI(t *testing.T) {
 				Bucket: "migration-bucket",
 			},
 		},
+		{
+			"with region",
+			"s3://migration-bucket/production?region=eu-west-1",
+			&Config{
+				Bucket: "migration-bucket",
+				Prefix: "production/",
+				Region: "eu-west-1",
+			},
+		},
 	}
 	for _, test := range tests {
 		t.Run(test.name, func(t *testing.T) {
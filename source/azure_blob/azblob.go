@@ -0,0 +1,279 @@
+// Package azureblob provides a source driver that reads migrations from an
+// Azure Blob Storage container.
+package azureblob
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/nokia/migrate/v4/source"
+)
+
+func init() {
+	source.Register("azblob", &azblob{})
+}
+
+// Blob is a blob listed by a BlobClient.
+type Blob struct {
+	// Name is the full name of the blob in the container.
+	Name string
+	Size int64
+}
+
+// BlobClient lists and reads the blobs of a container.
+type BlobClient interface {
+	// ListBlobs returns the blobs directly below prefix, not recursing
+	// into virtual directories.
+	ListBlobs(ctx context.Context, prefix string) ([]Blob, error)
+	// ReadBlob returns the content of the named blob.
+	ReadBlob(ctx context.Context, name string) (io.ReadCloser, error)
+}
+
+type Config struct {
+	Container string
+	Prefix    string
+}
+
+type azblob struct {
+	client     BlobClient
+	config     *Config
+	migrations *source.Migrations
+}
+
+// Open is part of source.Driver interface implementation.
+// The URL has the form azblob://<container>/<prefix>, credentials are
+// passed with the x-account and x-sas-token or the x-connection-string
+// query parameters.
+func (a *azblob) Open(folder string) (source.Driver, error) {
+	u, err := url.Parse(folder)
+	if err != nil {
+		return nil, err
+	}
+	config := &Config{
+		Container: u.Host,
+		Prefix:    strings.Trim(u.Path, "/"),
+	}
+	if config.Container == "" {
+		return nil, errors.New("azblob: missing container")
+	}
+
+	q := u.Query()
+	var client BlobClient
+	switch {
+	case q.Get("x-connection-string") != "":
+		if q.Get("x-sas-token") != "" {
+			return nil, errors.New("azblob: x-connection-string and x-sas-token are mutually exclusive")
+		}
+		client, err = NewClientFromConnectionString(q.Get("x-connection-string"), config.Container)
+	case q.Get("x-account") != "":
+		client, err = NewClientWithSAS(q.Get("x-account"), config.Container, q.Get("x-sas-token"))
+	default:
+		err = errors.New("azblob: either x-connection-string or x-account is required")
+	}
+	if err != nil {
+		return nil, err
+	}
+	return WithInstance(client, config)
+}
+
+// WithInstance returns a driver reading migrations with client.
+func WithInstance(client BlobClient, config *Config) (source.Driver, error) {
+	a := &azblob{
+		client: client,
+		config: &Config{
+			Container: config.Container,
+			Prefix:    strings.Trim(config.Prefix, "/"),
+		},
+		migrations: source.NewMigrations(),
+	}
+	if a.config.Prefix != "" {
+		a.config.Prefix += "/"
+	}
+	if err := a.loadMigrations(); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+func (a *azblob) loadMigrations() error {
+	blobs, err := a.client.ListBlobs(context.Background(), a.config.Prefix)
+	if err != nil {
+		return err
+	}
+	for _, blob := range blobs {
+		_, fileName := path.Split(blob.Name)
+		m, parseErr := source.DefaultParse(fileName)
+		if errors.Is(parseErr, source.ErrParse) {
+			continue
+		}
+		if parseErr != nil {
+			return fmt.Errorf("unable to parse blob %v: %w", blob.Name, parseErr)
+		}
+		m.Raw = fileName
+		m.Empty = m.Direction == source.Down && blob.Size == 0
+		if err := a.migrations.AppendErr(m); err != nil {
+			return fmt.Errorf("unable to load %v: %w", blob.Name, err)
+		}
+	}
+	return nil
+}
+
+func (a *azblob) Close() error {
+	return nil
+}
+
+func (a *azblob) First() (uint, error) {
+	v, ok := a.migrations.First()
+	if !ok {
+		return 0, a.errNotExist("first")
+	}
+	return v, nil
+}
+
+func (a *azblob) Prev(version uint) (uint, error) {
+	v, ok := a.migrations.Prev(version)
+	if !ok {
+		return 0, a.errNotExist("prev for version " + strconv.FormatUint(uint64(version), 10))
+	}
+	return v, nil
+}
+
+func (a *azblob) Next(version uint) (uint, error) {
+	v, ok := a.migrations.Next(version)
+	if !ok {
+		return 0, a.errNotExist("next for version " + strconv.FormatUint(uint64(version), 10))
+	}
+	return v, nil
+}
+
+func (a *azblob) ReadUp(version uint) (io.ReadCloser, string, string, source.MigrationFunc, error) {
+	if m, ok := a.migrations.Up(version); ok {
+		return a.open(m)
+	}
+	return nil, "", "", nil, a.errNotExist("read up for version " + strconv.FormatUint(uint64(version), 10))
+}
+
+func (a *azblob) ReadDown(version uint) (io.ReadCloser, string, string, source.MigrationFunc, error) {
+	if m, ok := a.migrations.Down(version); ok {
+		return a.open(m)
+	}
+	return nil, "", "", nil, a.errNotExist("read down for version " + strconv.FormatUint(uint64(version), 10))
+}
+
+// errNotExist returns an error wrapping fs.ErrNotExist for op on the
+// migrations location, like the iofs driver does.
+func (a *azblob) errNotExist(op string) error {
+	return &fs.PathError{
+		Op:   op,
+		Path: "azblob://" + a.config.Container + "/" + a.config.Prefix,
+		Err:  fs.ErrNotExist,
+	}
+}
+
+func (a *azblob) open(m *source.Migration) (io.ReadCloser, string, string, source.MigrationFunc, error) {
+	r, err := a.client.ReadBlob(context.Background(), a.config.Prefix+m.Raw)
+	if err != nil {
+		return nil, "", "", nil, err
+	}
+	return r, m.Identifier, m.Raw, nil, nil
+}
+
+// IsEmptyDown reports whether the down migration for version is an
+// empty blob.
+func (a *azblob) IsEmptyDown(version uint) bool {
+	return a.migrations.IsEmptyDown(version)
+}
+
+func (a *azblob) MarkSkipMigrations(version uint, dir source.Direction) {
+	a.migrations.MarkSkipMigrations(version, dir)
+}
+
+func (a *azblob) UpdateStatus(version uint, status source.Status, errstr string) {
+	a.migrations.UpdateStatus(version, status, errstr)
+}
+
+// UpdateStatusDir is like UpdateStatus, but only updates the migration of
+// direction dir.
+func (a *azblob) UpdateStatusDir(version uint, dir source.Direction, status source.Status, errstr string) {
+	a.migrations.UpdateStatusDir(version, dir, status, errstr)
+}
+
+func (a *azblob) PrintSummary(dir source.Direction) {
+	a.migrations.PrintSummary(dir)
+}
+
+// SummaryJSON returns the summary printed by PrintSummary as JSON.
+// See source.Migrations.SummaryJSON.
+func (a *azblob) SummaryJSON(dir source.Direction) ([]byte, error) {
+	return a.migrations.SummaryJSON(dir)
+}
+
+// ComputeChecksums reads every migration and records the SHA-256 of its
+// body, which is reported by SummaryJSON.
+func (a *azblob) ComputeChecksums() error {
+	return a.migrations.ComputeChecksums(a)
+}
+
+// Versions returns all versions available to the driver in ascending order.
+func (a *azblob) Versions() []uint {
+	return a.migrations.Versions()
+}
+
+// Identifier returns the identifier of the migration of version in
+// direction dir without reading it.
+func (a *azblob) Identifier(version uint, dir source.Direction) (string, bool) {
+	return a.migrations.Identifier(version, dir)
+}
+
+// FindByIdentifier returns a copy of the first migration in direction dir
+// named identifier, see source.Migrations.FindByIdentifier.
+func (a *azblob) FindByIdentifier(identifier string, dir source.Direction) (*source.Migration, bool) {
+	return a.migrations.FindByIdentifier(identifier, dir)
+}
+
+// FindByIdentifierFold is like FindByIdentifier, but matches identifier
+// case insensitively.
+func (a *azblob) FindByIdentifierFold(identifier string, dir source.Direction) (*source.Migration, bool) {
+	return a.migrations.FindByIdentifierFold(identifier, dir)
+}
+
+// Walk calls fn with a copy of each migration of direction dir in the
+// order they would be applied, see source.Migrations.Walk.
+func (a *azblob) Walk(dir source.Direction, fn func(m *source.Migration) error) error {
+	return a.migrations.Walk(dir, fn)
+}
+
+// Counts returns how many migrations of direction dir are in each status.
+func (a *azblob) Counts(dir source.Direction) map[source.Status]int {
+	return a.migrations.Counts(dir)
+}
+
+// HasFailures reports whether a migration has failed.
+func (a *azblob) HasFailures() bool {
+	return a.migrations.HasFailures()
+}
+
+// Validate checks that every version has an up and a down migration, or
+// only an up migration if downOptional is set, see source.Migrations.Validate.
+func (a *azblob) Validate(downOptional bool) error {
+	return a.migrations.Validate(downOptional)
+}
+
+// MissingVersions returns the versions absent from the sequence start,
+// start+step, ... up to the highest version of the driver.
+// See source.Migrations.MissingVersions.
+func (a *azblob) MissingVersions(start, step uint) []uint {
+	return a.migrations.MissingVersions(start, step)
+}
+
+// Reset sets the status of all migrations back to pending.
+func (a *azblob) Reset() {
+	a.migrations.Reset()
+}
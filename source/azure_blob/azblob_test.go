@@ -0,0 +1,390 @@
+package azureblob
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/dhui/dktest"
+
+	"github.com/nokia/migrate/v4/dktesting"
+	"github.com/nokia/migrate/v4/source"
+	st "github.com/nokia/migrate/v4/source/testing"
+)
+
+var (
+	opts = dktest.Options{
+		Cmd:          []string{"azurite-blob", "--blobHost", "0.0.0.0"},
+		PortRequired: true,
+		ReadyFunc:    isReady,
+	}
+	specs = []dktesting.ContainerSpec{
+		{ImageName: "mcr.microsoft.com/azure-storage/azurite:3.17.1", Options: opts},
+	}
+)
+
+// azuriteKey is the well known key of the devstoreaccount1 account of the
+// Azure storage emulators.
+const azuriteKey = "Eby8vdM02xNOcqFlqUwJPLlmEtlCDXJ1OUzFT50uSRZ6IFsuFr2Ju1Whr3hSJJ5uG7p/wM3iRYCzKKd6Uw=="
+
+func azuriteConnectionString(ip, port string) string {
+	return fmt.Sprintf("DefaultEndpointsProtocol=http;AccountName=devstoreaccount1;AccountKey=%v;BlobEndpoint=http://%v:%v/devstoreaccount1;", azuriteKey, ip, port)
+}
+
+func isReady(ctx context.Context, c dktest.ContainerInfo) bool {
+	ip, port, err := c.Port(10000)
+	if err != nil {
+		return false
+	}
+	client, err := NewClientFromConnectionString(azuriteConnectionString(ip, port), "migrations")
+	if err != nil {
+		return false
+	}
+	req, err := client.newRequest(ctx, http.MethodGet, "", url.Values{"restype": {"container"}}, nil)
+	if err != nil {
+		return false
+	}
+	resp, err := client.do(req)
+	if err != nil {
+		return false
+	}
+	resp.Body.Close()
+	return true
+}
+
+// TestAzurite checks the client, including its shared key signing, against
+// the Azurite storage emulator.
+func TestAzurite(t *testing.T) {
+	dktesting.ParallelTest(t, specs, func(t *testing.T, c dktest.ContainerInfo) {
+		ip, port, err := c.Port(10000)
+		if err != nil {
+			t.Fatal(err)
+		}
+		connStr := azuriteConnectionString(ip, port)
+		client, err := NewClientFromConnectionString(connStr, "migrations")
+		if err != nil {
+			t.Fatal(err)
+		}
+		put(t, client, "", url.Values{"restype": {"container"}}, nil)
+		for name, content := range map[string]string{
+			"prod/1_foobar.up.sql":        "1 up",
+			"prod/1_foobar.down.sql":      "1 down",
+			"prod/3_foobar.up.sql":        "3 up",
+			"prod/4_foobar.up.sql":        "4 up",
+			"prod/4_foobar.down.sql":      "4 down",
+			"prod/5_foobar.down.sql":      "5 down",
+			"prod/7_foobar.up.sql":        "7 up",
+			"prod/7_foobar.down.sql":      "7 down",
+			"prod/nested/8_foobar.up.sql": "8 up",
+			"staging/2_foobar.up.sql":     "2 up",
+			"staging/2_foobar.down.sql":   "",
+		} {
+			put(t, client, name, url.Values{}, []byte(content))
+		}
+
+		d, err := (&azblob{}).Open("azblob://migrations/prod?x-connection-string=" + url.QueryEscape(connStr))
+		if err != nil {
+			t.Fatal(err)
+		}
+		r, _, _, _, err := d.ReadUp(7)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer r.Close()
+		if body, _ := ioutil.ReadAll(r); string(body) != "7 up" {
+			t.Errorf("expected %q, got %q", "7 up", body)
+		}
+		if _, err := client.ReadBlob(context.Background(), "prod/6_foobar.up.sql"); !errors.Is(err, fs.ErrNotExist) {
+			t.Errorf("expected %v, got %v", fs.ErrNotExist, err)
+		}
+		st.Test(t, d)
+	})
+}
+
+// put creates the container if name is empty, or else uploads body as the
+// blob name.
+func put(t *testing.T, client *Client, name string, q url.Values, body []byte) {
+	t.Helper()
+	req, err := client.newRequest(context.Background(), http.MethodPut, name, q, body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if name != "" {
+		req.Header.Set("x-ms-blob-type", "BlockBlob")
+	}
+	resp, err := client.do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated {
+		msg, _ := ioutil.ReadAll(resp.Body)
+		t.Fatalf("unable to put %q: %v %s", name, resp.Status, msg)
+	}
+}
+
+func Test(t *testing.T) {
+	client := &fakeClient{blobs: map[string]string{
+		"staging/migrations/1_foobar.up.sql":          "1 up",
+		"staging/migrations/1_foobar.down.sql":        "1 down",
+		"prod/migrations/1_foobar.up.sql":             "1 up",
+		"prod/migrations/1_foobar.down.sql":           "1 down",
+		"prod/migrations/3_foobar.up.sql":             "3 up",
+		"prod/migrations/4_foobar.up.sql":             "4 up",
+		"prod/migrations/4_foobar.down.sql":           "4 down",
+		"prod/migrations/5_foobar.down.sql":           "5 down",
+		"prod/migrations/7_foobar.up.sql":             "7 up",
+		"prod/migrations/7_foobar.down.sql":           "7 down",
+		"prod/migrations/not-a-migration.txt":         "",
+		"prod/migrations/0-random-stuff/whatever.txt": "",
+		"prod/migrations/nested/8_foobar.up.sql":      "8 up",
+	}}
+	driver, err := WithInstance(client, &Config{
+		Container: "some-container",
+		Prefix:    "prod/migrations",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	st.Test(t, driver)
+}
+
+func TestReadContent(t *testing.T) {
+	client := &fakeClient{blobs: map[string]string{
+		"prod/migrations/2_foobar.up.sql":   "2 up",
+		"prod/migrations/1_foobar.up.sql":   "1 up",
+		"prod/migrations/1_foobar.down.sql": "",
+	}}
+	driver, err := WithInstance(client, &Config{
+		Container: "some-container",
+		Prefix:    "/prod/migrations/",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(client.reads) != 0 {
+		t.Fatalf("expected no blob to be read before ReadUp, got %v", client.reads)
+	}
+
+	first, err := driver.First()
+	if err != nil || first != 1 {
+		t.Fatalf("expected first version 1, got %v, %v", first, err)
+	}
+	next, err := driver.Next(first)
+	if err != nil || next != 2 {
+		t.Fatalf("expected next version 2, got %v, %v", next, err)
+	}
+
+	r, identifier, location, fn, err := driver.ReadUp(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	body, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(body) != "2 up" || identifier != "foobar" || location != "2_foobar.up.sql" || fn != nil {
+		t.Errorf("unexpected read %q, %q, %q, %v", body, identifier, location, fn)
+	}
+	if want := []string{"prod/migrations/2_foobar.up.sql"}; len(client.reads) != 1 || client.reads[0] != want[0] {
+		t.Errorf("expected reads %v, got %v", want, client.reads)
+	}
+
+	ed := driver.(interface{ IsEmptyDown(version uint) bool })
+	if !ed.IsEmptyDown(1) {
+		t.Error("expected empty down migration for version 1")
+	}
+
+	if _, _, _, _, err := driver.ReadDown(2); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("expected %v, got %v", fs.ErrNotExist, err)
+	}
+}
+
+func TestDuplicateMigration(t *testing.T) {
+	client := &fakeClient{blobs: map[string]string{
+		"1_foobar.up.sql": "1 up",
+		"1_foobaz.up.sql": "1 up",
+	}}
+	_, err := WithInstance(client, &Config{Container: "some-container"})
+	var dup source.ErrDuplicateMigration
+	if !errors.As(err, &dup) {
+		t.Fatalf("expected ErrDuplicateMigration, got %v", err)
+	}
+}
+
+func TestOpenErrors(t *testing.T) {
+	for _, url := range []string{
+		"azblob:///migrations?x-account=foo&x-sas-token=sig%3Dabc",
+		"azblob://container/migrations",
+		"azblob://container/migrations?x-account=foo",
+		"azblob://container/migrations?x-connection-string=AccountName%3Dfoo",
+		"azblob://container/migrations?x-connection-string=AccountName%3Dfoo%3BAccountKey%3Dbar&x-sas-token=sig%3Dabc",
+	} {
+		if _, err := (&azblob{}).Open(url); err == nil {
+			t.Errorf("expected error opening %v", url)
+		}
+	}
+}
+
+func TestClientWithSAS(t *testing.T) {
+	blobs := map[string]string{
+		"migrations/1_foobar.up.sql":   "1 up",
+		"migrations/1_foobar.down.sql": "1 down",
+		"migrations/2_foobar.up.sql":   "2 up",
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		if q.Get("sig") != "abc" || q.Get("sv") != "2020-10-02" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		if r.Header.Get("x-ms-version") != APIVersion {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		switch {
+		case r.URL.Path == "/container" && q.Get("comp") == "list":
+			// two pages
+			if q.Get("prefix") != "migrations/" {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			if q.Get("marker") == "" {
+				fmt.Fprint(w, listResponse("page2", "migrations/2_foobar.up.sql", "migrations/1_foobar.up.sql"))
+			} else {
+				fmt.Fprint(w, listResponse("", "migrations/1_foobar.down.sql"))
+			}
+		case strings.HasPrefix(r.URL.Path, "/container/"):
+			content, ok := blobs[strings.TrimPrefix(r.URL.Path, "/container/")]
+			if !ok {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			fmt.Fprint(w, content)
+		default:
+			w.WriteHeader(http.StatusBadRequest)
+		}
+	}))
+	defer server.Close()
+
+	client, err := NewClientWithSAS("account", "container", "?sv=2020-10-02&sig=abc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.endpoint.Scheme = "http"
+	client.endpoint.Host = strings.TrimPrefix(server.URL, "http://")
+
+	listed, err := client.ListBlobs(context.Background(), "migrations/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(listed) != 3 {
+		t.Fatalf("expected 3 blobs, got %v", listed)
+	}
+	if listed[0].Size != int64(len("2 up")) {
+		t.Errorf("expected size %v, got %v", len("2 up"), listed[0].Size)
+	}
+
+	driver, err := WithInstance(client, &Config{Container: "container", Prefix: "migrations"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, _, _, _, err := driver.ReadDown(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	if body, _ := ioutil.ReadAll(r); string(body) != "1 down" {
+		t.Errorf("expected %q, got %q", "1 down", body)
+	}
+
+	if _, err := client.ReadBlob(context.Background(), "migrations/3_foobar.up.sql"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("expected %v, got %v", fs.ErrNotExist, err)
+	}
+}
+
+func TestClientFromConnectionString(t *testing.T) {
+	var auth string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth = r.Header.Get("Authorization")
+		if r.URL.Path != "/devstoreaccount1/container" || r.Header.Get("x-ms-date") == "" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		fmt.Fprint(w, listResponse("", "1_foobar.up.sql"))
+	}))
+	defer server.Close()
+
+	client, err := NewClientFromConnectionString(
+		"DefaultEndpointsProtocol=http;AccountName=devstoreaccount1;AccountKey=a2V5;BlobEndpoint="+server.URL+"/devstoreaccount1;",
+		"container")
+	if err != nil {
+		t.Fatal(err)
+	}
+	listed, err := client.ListBlobs(context.Background(), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(listed) != 1 || listed[0].Name != "1_foobar.up.sql" {
+		t.Errorf("unexpected blobs %v", listed)
+	}
+	if !strings.HasPrefix(auth, "SharedKey devstoreaccount1:") {
+		t.Errorf("expected shared key authorization, got %q", auth)
+	}
+
+	for _, connStr := range []string{
+		"AccountKey=a2V5",
+		"AccountName=devstoreaccount1",
+		"AccountName=devstoreaccount1;AccountKey=not base64",
+		"AccountName=devstoreaccount1;garbage",
+	} {
+		if _, err := NewClientFromConnectionString(connStr, "container"); err == nil {
+			t.Errorf("expected error for connection string %q", connStr)
+		}
+	}
+}
+
+// fakeClient is a BlobClient serving blobs from a map of name to content.
+type fakeClient struct {
+	blobs map[string]string
+	reads []string
+}
+
+func (c *fakeClient) ListBlobs(ctx context.Context, prefix string) ([]Blob, error) {
+	var blobs []Blob
+	for name, content := range c.blobs {
+		if strings.HasPrefix(name, prefix) && !strings.Contains(strings.TrimPrefix(name, prefix), "/") {
+			blobs = append(blobs, Blob{Name: name, Size: int64(len(content))})
+		}
+	}
+	return blobs, nil
+}
+
+func (c *fakeClient) ReadBlob(ctx context.Context, name string) (io.ReadCloser, error) {
+	content, ok := c.blobs[name]
+	if !ok {
+		return nil, &fs.PathError{Op: "read", Path: name, Err: fs.ErrNotExist}
+	}
+	c.reads = append(c.reads, name)
+	return ioutil.NopCloser(strings.NewReader(content)), nil
+}
+
+func listResponse(nextMarker string, names ...string) string {
+	var b strings.Builder
+	b.WriteString(`<?xml version="1.0" encoding="utf-8"?><EnumerationResults><Blobs>`)
+	for _, name := range names {
+		fmt.Fprintf(&b, "<Blob><Name>%s</Name><Properties><Content-Length>4</Content-Length></Properties></Blob>", name)
+	}
+	b.WriteString("</Blobs>")
+	fmt.Fprintf(&b, "<NextMarker>%s</NextMarker></EnumerationResults>", nextMarker)
+	return b.String()
+}
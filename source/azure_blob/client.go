@@ -0,0 +1,291 @@
+package azureblob
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// APIVersion is the version of the Blob service REST API used by Client.
+const APIVersion = "2020-10-02"
+
+// Client is a BlobClient talking to the Blob service REST API, authorized
+// either with a shared access signature or with a shared key.
+type Client struct {
+	// HTTPClient defaults to http.DefaultClient.
+	HTTPClient *http.Client
+
+	endpoint  *url.URL
+	account   string
+	container string
+	key       []byte
+	sas       url.Values
+}
+
+// NewClientWithSAS returns a client for container of the storage account
+// account, authorized with the shared access signature sasToken.
+func NewClientWithSAS(account, container, sasToken string) (*Client, error) {
+	if sasToken == "" {
+		return nil, errors.New("azblob: x-sas-token is required with x-account")
+	}
+	sas, err := url.ParseQuery(strings.TrimPrefix(sasToken, "?"))
+	if err != nil {
+		return nil, fmt.Errorf("azblob: unable to parse sas token: %w", err)
+	}
+	return &Client{
+		endpoint:  &url.URL{Scheme: "https", Host: account + ".blob.core.windows.net"},
+		account:   account,
+		container: container,
+		sas:       sas,
+	}, nil
+}
+
+// NewClientFromConnectionString returns a client for container of the
+// storage account described by the connection string connStr, as shown in
+// the Azure portal. It must hold AccountName and either AccountKey or
+// SharedAccessSignature. BlobEndpoint may be set to use e.g. an emulator.
+func NewClientFromConnectionString(connStr, container string) (*Client, error) {
+	settings := make(map[string]string)
+	for _, part := range strings.Split(connStr, ";") {
+		if strings.TrimSpace(part) == "" {
+			continue
+		}
+		kv := strings.SplitN(part, "=", 2)
+		if len(kv) != 2 {
+			return nil, fmt.Errorf("azblob: malformed connection string setting %q", part)
+		}
+		settings[kv[0]] = kv[1]
+	}
+
+	c := &Client{
+		account:   settings["AccountName"],
+		container: container,
+	}
+	if c.account == "" {
+		return nil, errors.New("azblob: connection string is missing AccountName")
+	}
+
+	if endpoint := settings["BlobEndpoint"]; endpoint != "" {
+		u, err := url.Parse(endpoint)
+		if err != nil {
+			return nil, fmt.Errorf("azblob: unable to parse BlobEndpoint: %w", err)
+		}
+		c.endpoint = u
+	} else {
+		protocol := settings["DefaultEndpointsProtocol"]
+		if protocol == "" {
+			protocol = "https"
+		}
+		suffix := settings["EndpointSuffix"]
+		if suffix == "" {
+			suffix = "core.windows.net"
+		}
+		c.endpoint = &url.URL{Scheme: protocol, Host: c.account + ".blob." + suffix}
+	}
+
+	switch {
+	case settings["SharedAccessSignature"] != "":
+		sas, err := url.ParseQuery(strings.TrimPrefix(settings["SharedAccessSignature"], "?"))
+		if err != nil {
+			return nil, fmt.Errorf("azblob: unable to parse SharedAccessSignature: %w", err)
+		}
+		c.sas = sas
+	case settings["AccountKey"] != "":
+		key, err := base64.StdEncoding.DecodeString(settings["AccountKey"])
+		if err != nil {
+			return nil, fmt.Errorf("azblob: unable to decode AccountKey: %w", err)
+		}
+		c.key = key
+	default:
+		return nil, errors.New("azblob: connection string is missing AccountKey or SharedAccessSignature")
+	}
+	return c, nil
+}
+
+type listBlobsResult struct {
+	Blobs struct {
+		Blob []struct {
+			Name       string `xml:"Name"`
+			Properties struct {
+				ContentLength int64 `xml:"Content-Length"`
+			} `xml:"Properties"`
+		} `xml:"Blob"`
+	} `xml:"Blobs"`
+	NextMarker string `xml:"NextMarker"`
+}
+
+// ListBlobs is part of BlobClient interface implementation.
+func (c *Client) ListBlobs(ctx context.Context, prefix string) ([]Blob, error) {
+	var blobs []Blob
+	marker := ""
+	for {
+		q := url.Values{}
+		q.Set("restype", "container")
+		q.Set("comp", "list")
+		q.Set("delimiter", "/")
+		if prefix != "" {
+			q.Set("prefix", prefix)
+		}
+		if marker != "" {
+			q.Set("marker", marker)
+		}
+		resp, err := c.get(ctx, "", q)
+		if err != nil {
+			return nil, err
+		}
+		var result listBlobsResult
+		err = xml.NewDecoder(resp.Body).Decode(&result)
+		resp.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("azblob: unable to decode blob list: %w", err)
+		}
+		for _, b := range result.Blobs.Blob {
+			blobs = append(blobs, Blob{Name: b.Name, Size: b.Properties.ContentLength})
+		}
+		if result.NextMarker == "" {
+			return blobs, nil
+		}
+		marker = result.NextMarker
+	}
+}
+
+// ReadBlob is part of BlobClient interface implementation.
+func (c *Client) ReadBlob(ctx context.Context, name string) (io.ReadCloser, error) {
+	resp, err := c.get(ctx, name, url.Values{})
+	if err != nil {
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+// get requests the blob name, or the container itself if name is empty.
+// The body of the returned response must be closed by the caller.
+func (c *Client) get(ctx context.Context, name string, q url.Values) (*http.Response, error) {
+	req, err := c.newRequest(ctx, http.MethodGet, name, q, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode == http.StatusOK {
+		return resp, nil
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound && name != "" {
+		return nil, &fs.PathError{Op: "read", Path: name, Err: fs.ErrNotExist}
+	}
+	body, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 1024))
+	return nil, fmt.Errorf("azblob: unexpected status %v: %s", resp.Status, body)
+}
+
+// newRequest returns a request for the blob name, or the container itself
+// if name is empty, authorized with the shared access signature of c if it
+// has one. Headers set on the request before do are signed along.
+func (c *Client) newRequest(ctx context.Context, method, name string, q url.Values, body []byte) (*http.Request, error) {
+	u := *c.endpoint
+	u.Path = strings.TrimSuffix(u.Path, "/") + "/" + c.container
+	if name != "" {
+		u.Path += "/" + name
+	}
+	u.RawPath = ""
+	for k, vs := range c.sas {
+		for _, v := range vs {
+			q.Add(k, v)
+		}
+	}
+	u.RawQuery = q.Encode()
+
+	var r io.Reader
+	if body != nil {
+		r = bytes.NewReader(body)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), r)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("x-ms-version", APIVersion)
+	return req, nil
+}
+
+// do sends req, signed with the shared key of c if it has one.
+func (c *Client) do(req *http.Request) (*http.Response, error) {
+	req.Header.Set("x-ms-date", time.Now().UTC().Format(http.TimeFormat))
+	if c.key != nil {
+		req.Header.Set("Authorization", "SharedKey "+c.account+":"+c.sign(req))
+	}
+	client := c.HTTPClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return client.Do(req)
+}
+
+// sign returns the shared key signature of req, see
+// https://docs.microsoft.com/rest/api/storageservices/authorize-with-shared-key
+func (c *Client) sign(req *http.Request) string {
+	var contentLength string
+	if req.ContentLength > 0 {
+		contentLength = strconv.FormatInt(req.ContentLength, 10)
+	}
+	// Date is left empty as x-ms-date is set.
+	standard := []string{
+		req.Method,
+		req.Header.Get("Content-Encoding"),
+		req.Header.Get("Content-Language"),
+		contentLength,
+		req.Header.Get("Content-MD5"),
+		req.Header.Get("Content-Type"),
+		"",
+		req.Header.Get("If-Modified-Since"),
+		req.Header.Get("If-Match"),
+		req.Header.Get("If-None-Match"),
+		req.Header.Get("If-Unmodified-Since"),
+		req.Header.Get("Range"),
+	}
+	var canonical strings.Builder
+	canonical.WriteString(strings.Join(standard, "\n") + "\n")
+
+	var headers []string
+	for k := range req.Header {
+		if k := strings.ToLower(k); strings.HasPrefix(k, "x-ms-") {
+			headers = append(headers, k)
+		}
+	}
+	sort.Strings(headers)
+	for _, k := range headers {
+		canonical.WriteString(k + ":" + strings.TrimSpace(req.Header.Get(k)) + "\n")
+	}
+
+	canonical.WriteString("/" + c.account + req.URL.EscapedPath())
+	q := req.URL.Query()
+	params := make([]string, 0, len(q))
+	for k := range q {
+		params = append(params, k)
+	}
+	sort.Strings(params)
+	for _, k := range params {
+		vs := q[k]
+		sort.Strings(vs)
+		canonical.WriteString("\n" + strings.ToLower(k) + ":" + strings.Join(vs, ","))
+	}
+
+	mac := hmac.New(sha256.New, c.key)
+	mac.Write([]byte(canonical.String()))
+	return base64.StdEncoding.EncodeToString(mac.Sum(nil))
+}
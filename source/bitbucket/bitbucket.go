@@ -213,6 +213,12 @@ func (b *Bitbucket) UpdateStatus(version uint, status source.Status, errstr stri
 	b.migrations.UpdateStatus(version, status, errstr)
 }
 
+// UpdateStatusDir is like UpdateStatus, but only updates the migration of
+// direction dir.
+func (b *Bitbucket) UpdateStatusDir(version uint, dir source.Direction, status source.Status, errstr string) {
+	b.migrations.UpdateStatusDir(version, dir, status, errstr)
+}
+
 func (b *Bitbucket) PrintSummary(dir source.Direction) {
 	b.migrations.PrintSummary(dir)
 }
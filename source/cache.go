@@ -0,0 +1,93 @@
+package source
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/ioutil"
+	"sync"
+)
+
+// NewCachingDriver returns a driver reading the body of a migration from d
+// only once, e.g. to apply the same migrations to many databases in one
+// process. Later reads of the migration return the body kept in memory.
+// Go migrations and failed reads are not cached. The returned driver is
+// safe for concurrent use if d is. Closing it closes d.
+func NewCachingDriver(d Driver) Driver {
+	return &cachingDriver{
+		Driver: d,
+		bodies: make(map[cacheKey]cachedBody),
+	}
+}
+
+type cacheKey struct {
+	version uint
+	dir     Direction
+}
+
+type cachedBody struct {
+	body       []byte
+	identifier string
+	location   string
+}
+
+type cachingDriver struct {
+	Driver
+	mu     sync.Mutex
+	bodies map[cacheKey]cachedBody
+}
+
+// Open is part of Driver interface implementation. A caching driver can
+// only be created with NewCachingDriver.
+func (cd *cachingDriver) Open(url string) (Driver, error) {
+	return nil, errors.New("caching driver can't be opened from a URL, use NewCachingDriver")
+}
+
+func (cd *cachingDriver) ReadUp(version uint) (io.ReadCloser, string, string, MigrationFunc, error) {
+	return cd.read(cacheKey{version, Up}, cd.Driver.ReadUp)
+}
+
+func (cd *cachingDriver) ReadDown(version uint) (io.ReadCloser, string, string, MigrationFunc, error) {
+	return cd.read(cacheKey{version, Down}, cd.Driver.ReadDown)
+}
+
+func (cd *cachingDriver) read(key cacheKey, read func(uint) (io.ReadCloser, string, string, MigrationFunc, error)) (io.ReadCloser, string, string, MigrationFunc, error) {
+	cd.mu.Lock()
+	c, ok := cd.bodies[key]
+	cd.mu.Unlock()
+	if ok {
+		return ioutil.NopCloser(bytes.NewReader(c.body)), c.identifier, c.location, nil, nil
+	}
+
+	r, identifier, location, fn, err := read(key.version)
+	if err != nil || fn != nil || r == nil {
+		return r, identifier, location, fn, err
+	}
+	body, err := ioutil.ReadAll(r)
+	r.Close()
+	if err != nil {
+		return nil, "", "", nil, err
+	}
+	cd.mu.Lock()
+	cd.bodies[key] = cachedBody{body: body, identifier: identifier, location: location}
+	cd.mu.Unlock()
+	return ioutil.NopCloser(bytes.NewReader(body)), identifier, location, nil, nil
+}
+
+// UpdateStatusDir is like UpdateStatus, but only updates the migration of
+// direction dir if the wrapped driver supports it.
+func (cd *cachingDriver) UpdateStatusDir(version uint, dir Direction, status Status, errstr string) {
+	UpdateStatusDir(cd.Driver, version, dir, status, errstr)
+}
+
+// IsEmptyDown reports whether the wrapped driver flags the down migration of
+// version as empty.
+func (cd *cachingDriver) IsEmptyDown(version uint) bool {
+	return IsEmptyDown(cd.Driver, version)
+}
+
+// IsFunc reports whether the wrapped driver reports the migration of version
+// in direction dir as a go migration function.
+func (cd *cachingDriver) IsFunc(version uint, dir Direction) bool {
+	return IsFunc(cd.Driver, version, dir)
+}
@@ -0,0 +1,92 @@
+package source_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"sync"
+	"testing"
+
+	"github.com/nokia/migrate/v4/source"
+	"github.com/nokia/migrate/v4/source/memory"
+	st "github.com/nokia/migrate/v4/source/testing"
+)
+
+func TestCachingDriver(t *testing.T) {
+	d := source.NewCachingDriver(memory.New().
+		Add(1, source.Up, "1 up").
+		Add(1, source.Down, "1 down").
+		Add(3, source.Up, "3 up").
+		Add(4, source.Up, "4 up").
+		Add(4, source.Down, "4 down").
+		Add(5, source.Down, "5 down").
+		Add(7, source.Up, "7 up").
+		Add(7, source.Down, "7 down"))
+	st.Test(t, d)
+}
+
+func TestCachingDriverReads(t *testing.T) {
+	errFn := errors.New("fn")
+	counting := &countingDriver{Driver: memory.New().
+		Add(1, source.Up, "1 up").
+		Add(1, source.Down, "1 down").
+		AddFunc(2, source.Up, func(ctx context.Context, db interface{}) error { return errFn })}
+	d := source.NewCachingDriver(counting)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 2; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 2; j++ {
+				body, _, _, _, err := source.ReadDownString(d, 1)
+				if err != nil || body != "1 down" {
+					t.Errorf("expected %q, got %q, %v", "1 down", body, err)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	for i := 0; i < 2; i++ {
+		body, _, identifier, location, err := source.ReadUpString(d, 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if body != "1 up" || identifier == "" || location == "" {
+			t.Errorf("unexpected read %q, %q, %q", body, identifier, location)
+		}
+	}
+	if counting.reads[1] != 1 {
+		t.Errorf("expected the up migration to be read once, got %v", counting.reads[1])
+	}
+
+	for i := 0; i < 2; i++ {
+		_, fn, _, _, err := source.ReadUpString(d, 2)
+		if err != nil || fn == nil || fn(context.Background(), nil) != errFn {
+			t.Errorf("expected the registered function, got %v, %v", fn, err)
+		}
+	}
+	if counting.reads[2] != 2 {
+		t.Errorf("expected the go migration to be passed through, got %v reads", counting.reads[2])
+	}
+
+	if _, _, _, _, err := d.ReadDown(2); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("expected %v, got %v", fs.ErrNotExist, err)
+	}
+}
+
+// countingDriver counts the up migrations read from the wrapped driver.
+type countingDriver struct {
+	source.Driver
+	reads map[uint]int
+}
+
+func (d *countingDriver) ReadUp(version uint) (io.ReadCloser, string, string, source.MigrationFunc, error) {
+	if d.reads == nil {
+		d.reads = make(map[uint]int)
+	}
+	d.reads[version]++
+	return d.Driver.ReadUp(version)
+}
@@ -0,0 +1,103 @@
+package source
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+)
+
+// UpMarker and DownMarker start the up and the down section of a combined
+// migration file holding both directions, as used by sql-migrate:
+//  -- +migrate Up
+//  CREATE TABLE users ();
+//  -- +migrate Down
+//  DROP TABLE users;
+const (
+	UpMarker   = "-- +migrate Up"
+	DownMarker = "-- +migrate Down"
+)
+
+// CombinedRegex matches the following pattern of a combined migration file:
+//  123_name.ext
+var CombinedRegex = regexp.MustCompile(`^([0-9]+)[_-](.*)\.([^.]*)$`)
+
+// ParseCombined returns the up Migration for a file matching CombinedRegex,
+// with Combined set. Drivers add a copy with Direction Down if the file has
+// a down section, see Sections. Names matching Regex hold a single
+// direction and are rejected with an error wrapping ErrParse, like names
+// that don't match.
+func ParseCombined(raw string) (*Migration, error) {
+	m := CombinedRegex.FindStringSubmatch(raw)
+	if len(m) != 4 || Regex.MatchString(raw) {
+		return nil, fmt.Errorf("%w: %q is not named <version>_<name>.<ext>", ErrParse, raw)
+	}
+	version, err := ParseVersion(m[1])
+	if err != nil {
+		return nil, err
+	}
+	identifier, labels := splitLabels(m[2])
+	return &Migration{
+		Version:    version,
+		Identifier: strings.TrimSuffix(identifier, ParallelMarker),
+		Direction:  Up,
+		Raw:        raw,
+		Status:     Pending,
+		labels:     labels,
+		Parallel:   strings.HasSuffix(identifier, ParallelMarker),
+		Combined:   true,
+	}, nil
+}
+
+// Sections splits the body of a combined migration file into its up and
+// down section. A section is nil if its marker is missing, and empty if
+// nothing follows the marker. Lines before the first marker are dropped.
+// A marker may be followed by options on its line, which are ignored.
+// A body without any marker is rejected with an error wrapping ErrParse,
+// a repeated marker is an error.
+func Sections(r io.Reader) (up, down []byte, err error) {
+	var section *[]byte
+	br := bufio.NewReader(r)
+	for {
+		line, err := br.ReadBytes('\n')
+		if len(line) > 0 {
+			switch {
+			case isMarker(line, UpMarker):
+				if up != nil {
+					return nil, nil, fmt.Errorf("duplicate %q", UpMarker)
+				}
+				up, section = []byte{}, &up
+			case isMarker(line, DownMarker):
+				if down != nil {
+					return nil, nil, fmt.Errorf("duplicate %q", DownMarker)
+				}
+				down, section = []byte{}, &down
+			case section != nil:
+				*section = append(*section, line...)
+			}
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	if up == nil && down == nil {
+		return nil, nil, fmt.Errorf("%w: neither %q nor %q found", ErrParse, UpMarker, DownMarker)
+	}
+	return up, down, nil
+}
+
+// isMarker reports whether line starts with marker, followed by nothing
+// but options.
+func isMarker(line []byte, marker string) bool {
+	line = bytes.TrimSpace(line)
+	if !bytes.HasPrefix(line, []byte(marker)) {
+		return false
+	}
+	rest := line[len(marker):]
+	return len(rest) == 0 || rest[0] == ' ' || rest[0] == '\t'
+}
@@ -0,0 +1,91 @@
+package source
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseCombined(t *testing.T) {
+	m, err := ParseCombined("001_create_users+parallel@prod.sql")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := &Migration{
+		Version:    1,
+		Identifier: "create_users",
+		Direction:  Up,
+		Raw:        "001_create_users+parallel@prod.sql",
+		Status:     Pending,
+		labels:     "prod",
+		Parallel:   true,
+		Combined:   true,
+	}
+	if !reflect.DeepEqual(m, expected) {
+		t.Errorf("expected %#v, got %#v", expected, m)
+	}
+
+	for _, raw := range []string{"1_create_users.up.sql", "create_users.sql", "1_create_users"} {
+		if _, err := ParseCombined(raw); !errors.Is(err, ErrParse) {
+			t.Errorf("expected %q to be rejected with %v, got %v", raw, ErrParse, err)
+		}
+	}
+}
+
+func TestSections(t *testing.T) {
+	for _, tc := range []struct {
+		name       string
+		body       string
+		expectUp   []byte
+		expectDown []byte
+		expectErr  bool
+	}{
+		{
+			name:       "both",
+			body:       "-- comment\n-- +migrate Up\nCREATE TABLE users ();\n\n-- +migrate Down notransaction\nDROP TABLE users;",
+			expectUp:   []byte("CREATE TABLE users ();\n\n"),
+			expectDown: []byte("DROP TABLE users;"),
+		},
+		{
+			name:       "down first",
+			body:       "-- +migrate Down\nDROP TABLE users;\n-- +migrate Up\nCREATE TABLE users ();\n",
+			expectUp:   []byte("CREATE TABLE users ();\n"),
+			expectDown: []byte("DROP TABLE users;\n"),
+		},
+		{
+			name:     "no down",
+			body:     "-- +migrate Up\nCREATE TABLE users ();\n",
+			expectUp: []byte("CREATE TABLE users ();\n"),
+		},
+		{
+			name:       "empty down",
+			body:       "-- +migrate Up\nCREATE TABLE users ();\n-- +migrate Down\n",
+			expectUp:   []byte("CREATE TABLE users ();\n"),
+			expectDown: []byte{},
+		},
+		{
+			name:      "no marker",
+			body:      "CREATE TABLE users ();\n-- +migrate Upwards\n",
+			expectErr: true,
+		},
+		{
+			name:      "duplicate marker",
+			body:      "-- +migrate Up\nSELECT 1;\n-- +migrate Up\nSELECT 2;\n",
+			expectErr: true,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			up, down, err := Sections(strings.NewReader(tc.body))
+			if tc.expectErr != (err != nil) {
+				t.Fatalf("unexpected error %v", err)
+			}
+			if !reflect.DeepEqual(up, tc.expectUp) || !reflect.DeepEqual(down, tc.expectDown) {
+				t.Errorf("expected %q and %q, got %q and %q", tc.expectUp, tc.expectDown, up, down)
+			}
+		})
+	}
+	if _, _, err := Sections(strings.NewReader("SELECT 1;")); !errors.Is(err, ErrParse) {
+		t.Errorf("expected %v, got %v", ErrParse, err)
+	}
+}
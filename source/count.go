@@ -0,0 +1,48 @@
+package source
+
+import "io"
+
+// CountingReadCloser counts the bytes read through the wrapped
+// io.ReadCloser and reports the count once it is closed.
+type CountingReadCloser struct {
+	io.ReadCloser
+
+	// N is the number of bytes read so far.
+	N int64
+
+	// OnClose, if set, is called with N by the first Close.
+	OnClose func(n int64)
+
+	closed bool
+}
+
+func (c *CountingReadCloser) Read(p []byte) (int, error) {
+	n, err := c.ReadCloser.Read(p)
+	c.N += int64(n)
+	return n, err
+}
+
+func (c *CountingReadCloser) Close() error {
+	err := c.ReadCloser.Close()
+	if !c.closed {
+		c.closed = true
+		if c.OnClose != nil {
+			c.OnClose(c.N)
+		}
+	}
+	return err
+}
+
+// CountBytes returns body wrapped to record the number of bytes read from
+// it in m.Bytes once it is closed. Source drivers call it with the
+// migration they read, body is nil for go migrations, which record zero.
+func CountBytes(m *Migration, body io.ReadCloser) io.ReadCloser {
+	if body == nil {
+		m.Bytes = 0
+		return nil
+	}
+	return &CountingReadCloser{
+		ReadCloser: body,
+		OnClose:    func(n int64) { m.Bytes = n },
+	}
+}
@@ -0,0 +1,48 @@
+package source
+
+import (
+	"io"
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+func TestCountBytes(t *testing.T) {
+	m := &Migration{Version: 1, Direction: Up, Bytes: 42}
+	body := CountBytes(m, ioutil.NopCloser(strings.NewReader("CREATE TABLE foo (id int);")))
+	if _, err := io.CopyN(ioutil.Discard, body, 6); err != nil {
+		t.Fatal(err)
+	}
+	if m.Bytes != 42 {
+		t.Errorf("expected Bytes to be recorded on close only, got %v", m.Bytes)
+	}
+	if _, err := io.Copy(ioutil.Discard, body); err != nil {
+		t.Fatal(err)
+	}
+	if err := body.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if m.Bytes != 26 {
+		t.Errorf("expected 26 bytes, got %v", m.Bytes)
+	}
+
+	if body := CountBytes(m, nil); body != nil || m.Bytes != 0 {
+		t.Errorf("expected no body and zero bytes, got %v, %v", body, m.Bytes)
+	}
+}
+
+func TestCountingReadCloserOnCloseOnce(t *testing.T) {
+	calls := 0
+	c := &CountingReadCloser{
+		ReadCloser: ioutil.NopCloser(strings.NewReader("abc")),
+		OnClose:    func(n int64) { calls++ },
+	}
+	if _, err := ioutil.ReadAll(c); err != nil {
+		t.Fatal(err)
+	}
+	c.Close()
+	c.Close()
+	if calls != 1 || c.N != 3 {
+		t.Errorf("expected one call after 3 bytes, got %v calls after %v bytes", calls, c.N)
+	}
+}
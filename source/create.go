@@ -0,0 +1,81 @@
+//go:build go1.16
+// +build go1.16
+
+package source
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"strings"
+)
+
+// SeqDigits is the number of digits NewMigrationName pads sequence
+// numbers to, matching the default of `migrate create -seq`.
+const SeqDigits = 6
+
+// WritableFS is a file system new migration files can be written to.
+type WritableFS interface {
+	fs.FS
+
+	// WriteFile writes data to the named file, creating it if necessary.
+	WriteFile(name string, data []byte, perm fs.FileMode) error
+
+	// Remove removes the named file.
+	Remove(name string) error
+}
+
+// NewMigrationName returns the canonical file name of a sql migration
+// that is recognized by Parse, e.g. 000042_add_users.up.sql.
+// Whitespace in name is replaced by underscores.
+func NewMigrationName(seq uint, name string, dir Direction) string {
+	name = strings.Join(strings.Fields(name), "_")
+	return fmt.Sprintf("%0[2]*[1]d_%[3]s.%[4]s.sql", seq, SeqDigits, name, dir)
+}
+
+// CreateMigration writes an empty up and down migration named name to
+// dir in fsys, using the next sequence number after the migrations that
+// already exist there. It returns the paths of the created files. If the
+// down migration can't be written, the up migration is removed again, so
+// no half created migration is left behind. name must not contain path
+// separators or "..".
+func CreateMigration(fsys WritableFS, dir, name string) (upPath, downPath string, err error) {
+	if len(strings.Fields(name)) == 0 {
+		return "", "", errors.New("migration name must not be empty")
+	}
+	if strings.ContainsAny(name, `/\`) || strings.Contains(name, "..") {
+		return "", "", fmt.Errorf("migration name %q must not contain path separators or \"..\"", name)
+	}
+
+	seq := uint(1)
+	entries, err := fs.ReadDir(fsys, dir)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return "", "", err
+	}
+	for _, e := range entries {
+		if e.IsDir() {
+			continue
+		}
+		m, err := DefaultParse(e.Name())
+		if err != nil {
+			continue
+		}
+		if m.Version >= seq {
+			seq = m.Version + 1
+		}
+	}
+
+	upPath = path.Join(dir, NewMigrationName(seq, name, Up))
+	downPath = path.Join(dir, NewMigrationName(seq, name, Down))
+	if err := fsys.WriteFile(upPath, nil, 0644); err != nil {
+		return "", "", err
+	}
+	if err := fsys.WriteFile(downPath, nil, 0644); err != nil {
+		if removeErr := fsys.Remove(upPath); removeErr != nil {
+			return "", "", fmt.Errorf("%w (unable to remove %v: %v)", err, upPath, removeErr)
+		}
+		return "", "", err
+	}
+	return upPath, downPath, nil
+}
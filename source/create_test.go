@@ -0,0 +1,116 @@
+//go:build go1.16
+// +build go1.16
+
+package source
+
+import (
+	"errors"
+	"io/fs"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+type writableMapFS struct {
+	fstest.MapFS
+}
+
+func (m writableMapFS) WriteFile(name string, data []byte, perm fs.FileMode) error {
+	m.MapFS[name] = &fstest.MapFile{Data: data, Mode: perm}
+	return nil
+}
+
+func (m writableMapFS) Remove(name string) error {
+	delete(m.MapFS, name)
+	return nil
+}
+
+// downFailingFS fails to write down migrations.
+type downFailingFS struct {
+	writableMapFS
+}
+
+var errWrite = errors.New("write failed")
+
+func (m downFailingFS) WriteFile(name string, data []byte, perm fs.FileMode) error {
+	if strings.HasSuffix(name, ".down.sql") {
+		return errWrite
+	}
+	return m.writableMapFS.WriteFile(name, data, perm)
+}
+
+func TestNewMigrationName(t *testing.T) {
+	tt := []struct {
+		seq    uint
+		name   string
+		dir    Direction
+		expect string
+	}{
+		{seq: 1, name: "init", dir: Up, expect: "000001_init.up.sql"},
+		{seq: 42, name: "add users table", dir: Down, expect: "000042_add_users_table.down.sql"},
+		{seq: 7, name: "  trailing \t spaces ", dir: Up, expect: "000007_trailing_spaces.up.sql"},
+		{seq: 1234567, name: "wide", dir: Up, expect: "1234567_wide.up.sql"},
+	}
+
+	for i, v := range tt {
+		got := NewMigrationName(v.seq, v.name, v.dir)
+		if got != v.expect {
+			t.Errorf("expected %v, got %v, in %v", v.expect, got, i)
+			continue
+		}
+		m, err := DefaultParse(got)
+		if err != nil {
+			t.Fatalf("expected %v to parse, got %v, in %v", got, err, i)
+		}
+		if m.Version != v.seq || m.Direction != v.dir {
+			t.Errorf("expected version %v %v, got %v %v, in %v", v.seq, v.dir, m.Version, m.Direction, i)
+		}
+	}
+}
+
+func TestCreateMigration(t *testing.T) {
+	fsys := writableMapFS{fstest.MapFS{
+		"migrations/000001_init.up.sql":   &fstest.MapFile{},
+		"migrations/000001_init.down.sql": &fstest.MapFile{},
+		"migrations/000003_more.up.sql":   &fstest.MapFile{},
+		"migrations/README.md":            &fstest.MapFile{},
+	}}
+
+	up, down, err := CreateMigration(fsys, "migrations", "add users")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if up != "migrations/000004_add_users.up.sql" || down != "migrations/000004_add_users.down.sql" {
+		t.Errorf("unexpected paths %v, %v", up, down)
+	}
+	for _, p := range []string{up, down} {
+		if _, ok := fsys.MapFS[p]; !ok {
+			t.Errorf("expected %v to be written", p)
+		}
+	}
+
+	up, _, err = CreateMigration(writableMapFS{fstest.MapFS{}}, "new", "init")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if up != "new/000001_init.up.sql" {
+		t.Errorf("expected first migration in empty directory, got %v", up)
+	}
+
+	if _, _, err := CreateMigration(fsys, "migrations", "  "); err == nil {
+		t.Error("expected error for empty name")
+	}
+	for _, name := range []string{"../escape", "sub/dir", `sub\dir`, "a..b"} {
+		if _, _, err := CreateMigration(fsys, "migrations", name); err == nil {
+			t.Errorf("expected error for name %q", name)
+		}
+	}
+
+	failing := downFailingFS{writableMapFS{fstest.MapFS{}}}
+	if _, _, err := CreateMigration(failing, "migrations", "init"); !errors.Is(err, errWrite) {
+		t.Errorf("expected %v, got %v", errWrite, err)
+	}
+	if len(failing.MapFS) != 0 {
+		t.Errorf("expected the up migration to be removed, got %v", failing.MapFS)
+	}
+}
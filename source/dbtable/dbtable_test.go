@@ -0,0 +1,183 @@
+package dbtable
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"io/fs"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	st "github.com/nokia/migrate/v4/source/testing"
+)
+
+type row struct {
+	version    int64
+	direction  string
+	identifier string
+	body       string
+}
+
+func Test(t *testing.T) {
+	db := openFakeDB(t, []row{
+		{7, "down", "foobar", "7 down"},
+		{1, "up", "foobar", "1 up"},
+		{1, "down", "foobar", "1 down"},
+		{3, "up", "foobar", "3 up"},
+		{4, "up", "foobar", "4 up"},
+		{4, "down", "foobar", "4 down"},
+		{5, "down", "foobar", "5 down"},
+		{7, "up", "foobar", "7 up"},
+	})
+	d, err := WithInstance(db, &Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	st.Test(t, d)
+}
+
+func TestReadContent(t *testing.T) {
+	db := openFakeDB(t, []row{
+		{2, "up", "add_index", "CREATE INDEX ...;"},
+		{1, "up", "create_users", "CREATE TABLE users ();"},
+		{1, "down", "create_users", "DROP TABLE users;"},
+	})
+	d, err := WithInstance(db, &Config{Table: "app.migrations"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var versions []uint
+	for v, err := d.First(); err == nil; v, err = d.Next(v) {
+		versions = append(versions, v)
+	}
+	if len(versions) != 2 || versions[0] != 1 || versions[1] != 2 {
+		t.Errorf("expected versions [1 2], got %v", versions)
+	}
+
+	r, identifier, location, fn, err := d.ReadDown(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	body, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(body) != "DROP TABLE users;" || identifier != "create_users" || location != "app.migrations/1.down" || fn != nil {
+		t.Errorf("unexpected read %q, %q, %q, %v", body, identifier, location, fn)
+	}
+
+	if _, _, _, _, err := d.ReadDown(2); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("expected %v, got %v", fs.ErrNotExist, err)
+	}
+}
+
+func TestInvalidRows(t *testing.T) {
+	for name, rows := range map[string][]row{
+		"invalid direction": {{1, "sideways", "foobar", ""}},
+		"duplicate":         {{1, "up", "foo", ""}, {1, "up", "bar", ""}},
+	} {
+		t.Run(name, func(t *testing.T) {
+			if _, err := WithInstance(openFakeDB(t, rows), &Config{}); err == nil {
+				t.Error("expected error")
+			}
+		})
+	}
+}
+
+func TestQuotedTable(t *testing.T) {
+	d := &DBTable{config: &Config{Table: `app.my "migrations"`}}
+	if got, want := d.quotedTable(), `"app"."my ""migrations"""`; got != want {
+		t.Errorf("expected %v, got %v", want, got)
+	}
+}
+
+// openFakeDB returns a database answering the queries of the driver from
+// rows.
+func openFakeDB(t *testing.T, rows []row) *sql.DB {
+	db := sql.OpenDB(fakeConnector{rows})
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+type fakeConnector struct {
+	rows []row
+}
+
+func (c fakeConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	return fakeConn(c), nil
+}
+
+func (c fakeConnector) Driver() driver.Driver {
+	return fakeDriver{}
+}
+
+type fakeDriver struct{}
+
+func (fakeDriver) Open(name string) (driver.Conn, error) {
+	return nil, errors.New("use the connector")
+}
+
+type fakeConn struct {
+	rows []row
+}
+
+func (c fakeConn) Prepare(query string) (driver.Stmt, error) {
+	return fakeStmt{rows: c.rows, query: query}, nil
+}
+
+func (c fakeConn) Close() error { return nil }
+
+func (c fakeConn) Begin() (driver.Tx, error) {
+	return nil, errors.New("transactions not supported")
+}
+
+type fakeStmt struct {
+	rows  []row
+	query string
+}
+
+func (s fakeStmt) Close() error  { return nil }
+func (s fakeStmt) NumInput() int { return -1 }
+
+func (s fakeStmt) Exec(args []driver.Value) (driver.Result, error) {
+	return nil, errors.New("exec not supported")
+}
+
+func (s fakeStmt) Query(args []driver.Value) (driver.Rows, error) {
+	if !strings.HasPrefix(s.query, "SELECT body") {
+		r := &fakeRows{columns: []string{"version", "direction", "identifier"}}
+		for _, row := range s.rows {
+			r.values = append(r.values, []driver.Value{row.version, row.direction, row.identifier})
+		}
+		return r, nil
+	}
+	r := &fakeRows{columns: []string{"body"}}
+	for _, row := range s.rows {
+		if row.version == args[0].(int64) && row.direction == args[1].(string) {
+			r.values = append(r.values, []driver.Value{[]byte(row.body)})
+		}
+	}
+	return r, nil
+}
+
+type fakeRows struct {
+	columns []string
+	values  [][]driver.Value
+}
+
+func (r *fakeRows) Columns() []string { return r.columns }
+func (r *fakeRows) Close() error      { return nil }
+
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if len(r.values) == 0 {
+		return io.EOF
+	}
+	copy(dest, r.values[0])
+	r.values = r.values[1:]
+	return nil
+}
@@ -0,0 +1,309 @@
+// Package dynamodb provides a source driver that reads migrations stored as
+// items of a DynamoDB table.
+package dynamodb
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"io/ioutil"
+	nurl "net/url"
+	"strconv"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbiface"
+	"github.com/nokia/migrate/v4/source"
+)
+
+func init() {
+	source.Register("dynamodb", &DynamoDB{})
+}
+
+// DefaultNameKey is the attribute holding the file name of a migration if
+// none is configured.
+var DefaultNameKey = "name"
+
+// DefaultBodyAttribute is the attribute holding the body of a migration if
+// none is configured.
+var DefaultBodyAttribute = "body"
+
+var (
+	ErrNoTable     = errors.New("no table name")
+	ErrNoPartition = errors.New("x-partition-key and x-partition must be set together")
+)
+
+// Config configures the table migrations are read from. Each migration is
+// an item whose NameKey attribute holds a file name like
+// 1_create_users.up.sql and whose BodyAttribute holds the body.
+type Config struct {
+	Table string
+	// NameKey is the key attribute holding the file name, the partition
+	// key of the table, or its sort key if PartitionKey is set. Defaults
+	// to DefaultNameKey.
+	NameKey string
+	// PartitionKey and Partition restrict the driver to the items whose
+	// partition key attribute PartitionKey is the string Partition, e.g.
+	// the name of the service the migrations belong to.
+	PartitionKey string
+	Partition    string
+	// BodyAttribute is the string or binary attribute holding the body.
+	// Defaults to DefaultBodyAttribute.
+	BodyAttribute string
+}
+
+type DynamoDB struct {
+	client     dynamodbiface.DynamoDBAPI
+	config     *Config
+	migrations *source.Migrations
+}
+
+// Open is part of source.Driver interface implementation.
+// The URL names the table and its key schema, e.g.
+// dynamodb://migrations?x-partition-key=service&x-partition=billing.
+// The region and endpoint query parameters select where the table is, e.g.
+// endpoint=http://localhost:8000 for DynamoDB Local.
+func (d *DynamoDB) Open(url string) (source.Driver, error) {
+	u, err := nurl.Parse(url)
+	if err != nil {
+		return nil, err
+	}
+	q := u.Query()
+	config := &Config{
+		Table:         u.Host,
+		NameKey:       q.Get("x-name-key"),
+		PartitionKey:  q.Get("x-partition-key"),
+		Partition:     q.Get("x-partition"),
+		BodyAttribute: q.Get("x-body-attribute"),
+	}
+
+	awsConfig := aws.NewConfig()
+	if region := q.Get("region"); region != "" {
+		awsConfig = awsConfig.WithRegion(region)
+	}
+	if endpoint := q.Get("endpoint"); endpoint != "" {
+		awsConfig = awsConfig.WithEndpoint(endpoint)
+	}
+	sess, err := session.NewSession(awsConfig)
+	if err != nil {
+		return nil, err
+	}
+	return WithInstance(dynamodb.New(sess), config)
+}
+
+// WithInstance returns a driver reading migrations with client.
+func WithInstance(client dynamodbiface.DynamoDBAPI, config *Config) (source.Driver, error) {
+	if config.Table == "" {
+		return nil, ErrNoTable
+	}
+	if (config.PartitionKey == "") != (config.Partition == "") {
+		return nil, ErrNoPartition
+	}
+	if config.NameKey == "" {
+		config.NameKey = DefaultNameKey
+	}
+	if config.BodyAttribute == "" {
+		config.BodyAttribute = DefaultBodyAttribute
+	}
+	d := &DynamoDB{
+		client:     client,
+		config:     config,
+		migrations: source.NewMigrations(),
+	}
+	if err := d.loadMigrations(); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+// loadMigrations scans the names of the items of the table. Bodies are
+// left out of the scan, they are only read when needed.
+func (d *DynamoDB) loadMigrations() error {
+	input := &dynamodb.ScanInput{
+		TableName:                aws.String(d.config.Table),
+		ProjectionExpression:     aws.String("#n"),
+		ExpressionAttributeNames: map[string]*string{"#n": aws.String(d.config.NameKey)},
+	}
+	if d.config.PartitionKey != "" {
+		input.FilterExpression = aws.String("#p = :p")
+		input.ExpressionAttributeNames["#p"] = aws.String(d.config.PartitionKey)
+		input.ExpressionAttributeValues = map[string]*dynamodb.AttributeValue{
+			":p": {S: aws.String(d.config.Partition)},
+		}
+	}
+	for {
+		output, err := d.client.Scan(input)
+		if err != nil {
+			return fmt.Errorf("unable to scan %v: %w", d.location(), err)
+		}
+		for _, item := range output.Items {
+			name := aws.StringValue(item[d.config.NameKey].S)
+			m, err := source.DefaultParse(name)
+			if errors.Is(err, source.ErrParse) {
+				continue
+			}
+			if err != nil {
+				return fmt.Errorf("unable to parse item %v: %w", name, err)
+			}
+			m.Raw = name
+			if err := d.migrations.AppendErr(m); err != nil {
+				return fmt.Errorf("unable to load %v: %w", name, err)
+			}
+		}
+		if len(output.LastEvaluatedKey) == 0 {
+			return nil
+		}
+		input.ExclusiveStartKey = output.LastEvaluatedKey
+	}
+}
+
+// location names the table and partition the migrations are read from in
+// errors.
+func (d *DynamoDB) location() string {
+	if d.config.PartitionKey == "" {
+		return "dynamodb table " + d.config.Table
+	}
+	return "dynamodb table " + d.config.Table + " partition " + d.config.PartitionKey + "=" + d.config.Partition
+}
+
+// Close is part of source.Driver interface implementation.
+func (d *DynamoDB) Close() error {
+	return nil
+}
+
+func (d *DynamoDB) First() (uint, error) {
+	v, ok := d.migrations.First()
+	if !ok {
+		return 0, d.errNotExist("first")
+	}
+	return v, nil
+}
+
+func (d *DynamoDB) Prev(version uint) (uint, error) {
+	v, ok := d.migrations.Prev(version)
+	if !ok {
+		return 0, d.errNotExist("prev for version " + strconv.FormatUint(uint64(version), 10))
+	}
+	return v, nil
+}
+
+func (d *DynamoDB) Next(version uint) (uint, error) {
+	v, ok := d.migrations.Next(version)
+	if !ok {
+		return 0, d.errNotExist("next for version " + strconv.FormatUint(uint64(version), 10))
+	}
+	return v, nil
+}
+
+func (d *DynamoDB) ReadUp(version uint) (io.ReadCloser, string, string, source.MigrationFunc, error) {
+	if m, ok := d.migrations.Up(version); ok {
+		return d.read(m)
+	}
+	return nil, "", "", nil, d.errNotExist("read up for version " + strconv.FormatUint(uint64(version), 10))
+}
+
+func (d *DynamoDB) ReadDown(version uint) (io.ReadCloser, string, string, source.MigrationFunc, error) {
+	if m, ok := d.migrations.Down(version); ok {
+		return d.read(m)
+	}
+	return nil, "", "", nil, d.errNotExist("read down for version " + strconv.FormatUint(uint64(version), 10))
+}
+
+// read fetches the body attribute of the item of m.
+func (d *DynamoDB) read(m *source.Migration) (io.ReadCloser, string, string, source.MigrationFunc, error) {
+	key := map[string]*dynamodb.AttributeValue{
+		d.config.NameKey: {S: aws.String(m.Raw)},
+	}
+	if d.config.PartitionKey != "" {
+		key[d.config.PartitionKey] = &dynamodb.AttributeValue{S: aws.String(d.config.Partition)}
+	}
+	output, err := d.client.GetItem(&dynamodb.GetItemInput{
+		TableName:                aws.String(d.config.Table),
+		Key:                      key,
+		ProjectionExpression:     aws.String("#b"),
+		ExpressionAttributeNames: map[string]*string{"#b": aws.String(d.config.BodyAttribute)},
+	})
+	if err != nil {
+		return nil, "", "", nil, fmt.Errorf("unable to read %v: %w", m.Raw, err)
+	}
+	if len(output.Item) == 0 {
+		// the item was deleted since it was scanned
+		return nil, "", "", nil, &fs.PathError{Op: "read", Path: m.Raw, Err: fs.ErrNotExist}
+	}
+	body := output.Item[d.config.BodyAttribute]
+	switch {
+	case body == nil:
+		return nil, "", "", nil, fmt.Errorf("unable to read %v: no attribute %v", m.Raw, d.config.BodyAttribute)
+	case body.S != nil:
+		return ioutil.NopCloser(bytes.NewReader([]byte(*body.S))), m.Identifier, m.Raw, nil, nil
+	case body.B != nil:
+		return ioutil.NopCloser(bytes.NewReader(body.B)), m.Identifier, m.Raw, nil, nil
+	}
+	return nil, "", "", nil, fmt.Errorf("unable to read %v: attribute %v is neither a string nor binary", m.Raw, d.config.BodyAttribute)
+}
+
+// errNotExist returns an error wrapping fs.ErrNotExist for op on the
+// table, like the iofs driver does.
+func (d *DynamoDB) errNotExist(op string) error {
+	return &fs.PathError{
+		Op:   op,
+		Path: d.location(),
+		Err:  fs.ErrNotExist,
+	}
+}
+
+func (d *DynamoDB) MarkSkipMigrations(version uint, dir source.Direction) {
+	d.migrations.MarkSkipMigrations(version, dir)
+}
+
+func (d *DynamoDB) UpdateStatus(version uint, status source.Status, errstr string) {
+	d.migrations.UpdateStatus(version, status, errstr)
+}
+
+// UpdateStatusDir is like UpdateStatus, but only updates the migration of
+// direction dir.
+func (d *DynamoDB) UpdateStatusDir(version uint, dir source.Direction, status source.Status, errstr string) {
+	d.migrations.UpdateStatusDir(version, dir, status, errstr)
+}
+
+func (d *DynamoDB) PrintSummary(dir source.Direction) {
+	d.migrations.PrintSummary(dir)
+}
+
+// Versions returns all versions available to the driver in ascending order.
+func (d *DynamoDB) Versions() []uint {
+	return d.migrations.Versions()
+}
+
+// Identifier returns the identifier of the migration of version in
+// direction dir without reading it.
+func (d *DynamoDB) Identifier(version uint, dir source.Direction) (string, bool) {
+	return d.migrations.Identifier(version, dir)
+}
+
+// FindByIdentifier returns a copy of the first migration in direction dir
+// named identifier, see source.Migrations.FindByIdentifier.
+func (d *DynamoDB) FindByIdentifier(identifier string, dir source.Direction) (*source.Migration, bool) {
+	return d.migrations.FindByIdentifier(identifier, dir)
+}
+
+// FindByIdentifierFold is like FindByIdentifier, but matches identifier
+// case insensitively.
+func (d *DynamoDB) FindByIdentifierFold(identifier string, dir source.Direction) (*source.Migration, bool) {
+	return d.migrations.FindByIdentifierFold(identifier, dir)
+}
+
+// Walk calls fn with a copy of each migration of direction dir in the
+// order they would be applied, see source.Migrations.Walk.
+func (d *DynamoDB) Walk(dir source.Direction, fn func(m *source.Migration) error) error {
+	return d.migrations.Walk(dir, fn)
+}
+
+// Validate checks that every version has an up and a down migration, or
+// only an up migration if downOptional is set, see source.Migrations.Validate.
+func (d *DynamoDB) Validate(downOptional bool) error {
+	return d.migrations.Validate(downOptional)
+}
@@ -0,0 +1,242 @@
+package dynamodb
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbiface"
+	"github.com/nokia/migrate/v4/source"
+	st "github.com/nokia/migrate/v4/source/testing"
+)
+
+func Test(t *testing.T) {
+	client := newFakeClient(map[string]string{
+		"1_foobar.up.sql":   "1 up",
+		"1_foobar.down.sql": "1 down",
+		"3_foobar.up.sql":   "3 up",
+		"4_foobar.up.sql":   "4 up",
+		"4_foobar.down.sql": "4 down",
+		"5_foobar.down.sql": "5 down",
+		"7_foobar.up.sql":   "7 up",
+		"7_foobar.down.sql": "7 down",
+		"not-a-migration":   "",
+	})
+	d, err := WithInstance(client, &Config{Table: "migrations"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	st.Test(t, d)
+}
+
+func TestReadContent(t *testing.T) {
+	client := newFakeClient(map[string]string{
+		"10_add_index.up.sql":     "CREATE INDEX ...;",
+		"2_create_users.up.sql":   "CREATE TABLE users ();",
+		"2_create_users.down.sql": "DROP TABLE users;",
+		"3_seed.up.sql":           "INSERT INTO users VALUES (1);",
+	})
+	client.binary["3_seed.up.sql"] = true
+	client.items = append(client.items, map[string]*dynamodb.AttributeValue{
+		"service": {S: aws.String("other")},
+		"name":    {S: aws.String("1_other.up.sql")},
+		"body":    {S: aws.String("SELECT 1;")},
+	})
+	d, err := WithInstance(client, &Config{Table: "migrations", PartitionKey: "service", Partition: "billing"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if client.scans < 2 {
+		t.Errorf("expected the scan to be paginated, got %v pages", client.scans)
+	}
+
+	var versions []uint
+	for v, err := d.First(); err == nil; v, err = d.Next(v) {
+		versions = append(versions, v)
+	}
+	if expected := []uint{2, 3, 10}; !reflect.DeepEqual(versions, expected) {
+		t.Errorf("expected versions %v, got %v", expected, versions)
+	}
+
+	for _, tc := range []struct {
+		read     func(uint) (io.ReadCloser, string, string, source.MigrationFunc, error)
+		version  uint
+		location string
+		expected string
+	}{
+		{d.ReadDown, 2, "2_create_users.down.sql", "DROP TABLE users;"},
+		{d.ReadUp, 3, "3_seed.up.sql", "INSERT INTO users VALUES (1);"},
+		{d.ReadUp, 10, "10_add_index.up.sql", "CREATE INDEX ...;"},
+	} {
+		r, _, location, fn, err := tc.read(tc.version)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, err := ioutil.ReadAll(r)
+		r.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(body) != tc.expected || location != tc.location || fn != nil {
+			t.Errorf("expected %q from %v, got %q from %v", tc.expected, tc.location, body, location)
+		}
+	}
+
+	_, err = d.Prev(2)
+	if !errors.Is(err, fs.ErrNotExist) || !strings.Contains(err.Error(), "dynamodb table migrations partition service=billing") {
+		t.Errorf("expected not exist error naming the partition, got %v", err)
+	}
+}
+
+func TestDeletedItem(t *testing.T) {
+	client := newFakeClient(map[string]string{
+		"1_foobar.up.sql": "1 up",
+	})
+	d, err := WithInstance(client, &Config{Table: "migrations"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.items = nil
+	if _, _, _, _, err := d.ReadUp(1); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("expected %v, got %v", fs.ErrNotExist, err)
+	}
+}
+
+func TestInvalidConfig(t *testing.T) {
+	client := newFakeClient(nil)
+	for name, config := range map[string]*Config{
+		"no table":        {},
+		"no partition":    {Table: "migrations", PartitionKey: "service"},
+		"no partitionkey": {Table: "migrations", Partition: "billing"},
+	} {
+		t.Run(name, func(t *testing.T) {
+			if _, err := WithInstance(client, config); err == nil {
+				t.Error("expected error")
+			}
+		})
+	}
+}
+
+func TestOpen(t *testing.T) {
+	var targets []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		target := r.Header.Get("X-Amz-Target")
+		targets = append(targets, target)
+		w.Header().Set("Content-Type", "application/x-amz-json-1.0")
+		switch target {
+		case "DynamoDB_20120810.Scan":
+			io.WriteString(w, `{"Items": [{"name": {"S": "1_create_users.up.sql"}}]}`)
+		case "DynamoDB_20120810.GetItem":
+			io.WriteString(w, `{"Item": {"body": {"S": "CREATE TABLE users ();"}}}`)
+		default:
+			http.Error(w, "unexpected target "+target, http.StatusBadRequest)
+		}
+	}))
+	defer server.Close()
+	// DynamoDB Local accepts any credentials
+	os.Setenv("AWS_ACCESS_KEY_ID", "key")
+	defer os.Unsetenv("AWS_ACCESS_KEY_ID")
+	os.Setenv("AWS_SECRET_ACCESS_KEY", "secret")
+	defer os.Unsetenv("AWS_SECRET_ACCESS_KEY")
+
+	d, err := (&DynamoDB{}).Open("dynamodb://migrations?region=eu-west-1&endpoint=" + server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+	r, identifier, _, _, err := d.ReadUp(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	body, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(body) != "CREATE TABLE users ();" || identifier != "create_users" {
+		t.Errorf("unexpected read %q, %q", body, identifier)
+	}
+	if expected := []string{"DynamoDB_20120810.Scan", "DynamoDB_20120810.GetItem"}; !reflect.DeepEqual(targets, expected) {
+		t.Errorf("expected requests %v, got %v", expected, targets)
+	}
+}
+
+// fakeClient serves the items of a table with the key schema service
+// (partition key) and name, two items per page of a scan. Without a
+// partition key in the request, the name is taken to be the key.
+type fakeClient struct {
+	dynamodbiface.DynamoDBAPI
+	items  []map[string]*dynamodb.AttributeValue
+	binary map[string]bool
+	scans  int
+}
+
+// newFakeClient returns a client serving bodies by name in partition
+// billing, in no particular order.
+func newFakeClient(bodies map[string]string) *fakeClient {
+	c := &fakeClient{binary: make(map[string]bool)}
+	for name, body := range bodies {
+		c.items = append(c.items, map[string]*dynamodb.AttributeValue{
+			"service": {S: aws.String("billing")},
+			"name":    {S: aws.String(name)},
+			"body":    {S: aws.String(body)},
+		})
+	}
+	return c
+}
+
+func (c *fakeClient) Scan(input *dynamodb.ScanInput) (*dynamodb.ScanOutput, error) {
+	if aws.StringValue(input.TableName) != "migrations" {
+		return nil, errors.New("table not found")
+	}
+	c.scans++
+	start := 0
+	if input.ExclusiveStartKey != nil {
+		start, _ = strconv.Atoi(aws.StringValue(input.ExclusiveStartKey["offset"].S))
+	}
+	nameKey := aws.StringValue(input.ExpressionAttributeNames["#n"])
+	output := &dynamodb.ScanOutput{}
+	for i := start; i < len(c.items) && i < start+2; i++ {
+		item := c.items[i]
+		if input.FilterExpression != nil {
+			partitionKey := aws.StringValue(input.ExpressionAttributeNames["#p"])
+			if aws.StringValue(item[partitionKey].S) != aws.StringValue(input.ExpressionAttributeValues[":p"].S) {
+				continue
+			}
+		}
+		output.Items = append(output.Items, map[string]*dynamodb.AttributeValue{nameKey: item[nameKey]})
+	}
+	if start+2 < len(c.items) {
+		output.LastEvaluatedKey = map[string]*dynamodb.AttributeValue{"offset": {S: aws.String(strconv.Itoa(start + 2))}}
+	}
+	return output, nil
+}
+
+func (c *fakeClient) GetItem(input *dynamodb.GetItemInput) (*dynamodb.GetItemOutput, error) {
+	bodyAttribute := aws.StringValue(input.ExpressionAttributeNames["#b"])
+	for _, item := range c.items {
+		match := true
+		for k, v := range input.Key {
+			match = match && aws.StringValue(item[k].S) == aws.StringValue(v.S)
+		}
+		if !match {
+			continue
+		}
+		body := item[bodyAttribute]
+		if c.binary[aws.StringValue(item["name"].S)] {
+			body = &dynamodb.AttributeValue{B: []byte(aws.StringValue(body.S))}
+		}
+		return &dynamodb.GetItemOutput{Item: map[string]*dynamodb.AttributeValue{bodyAttribute: body}}, nil
+	}
+	return &dynamodb.GetItemOutput{}, nil
+}
@@ -0,0 +1,150 @@
+package source
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// ErrUndefinedVariable is returned when reading a body that references an
+// environment variable that is not set, see ExpandEnv.
+var ErrUndefinedVariable = errors.New("undefined environment variable")
+
+// envName matches the names ExpandEnv looks up in the environment. Other
+// references, like the $1 placeholders of PostgreSQL and $$ dollar quoting,
+// are left as they are.
+var envName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// dollarTag matches the tags of dollar quoting like $body$, which are left
+// as they are rather than expanded as $body followed by a $.
+var dollarTag = regexp.MustCompile(`\$[A-Za-z_][A-Za-z0-9_]*\$`)
+
+// ExpandEnv returns body with the ${VAR} and $VAR references replaced by
+// the values of the environment variables, as os.Expand does. The body is
+// expanded line by line while it is read, so it is never held in memory as
+// a whole. References to undefined variables expand to the empty string,
+// unless strict is set: reading then fails with an error wrapping
+// ErrUndefinedVariable.
+func ExpandEnv(body io.ReadCloser, strict bool) io.ReadCloser {
+	return &envReader{
+		r:      bufio.NewReader(body),
+		closer: body,
+		strict: strict,
+	}
+}
+
+type envReader struct {
+	r      *bufio.Reader
+	closer io.Closer
+	strict bool
+	// buf holds the rest of the expanded line not read yet.
+	buf []byte
+	// err is the error reading the body, undefined the error of the first
+	// undefined variable if e is strict. Either ends the body once buf is
+	// read.
+	err       error
+	undefined error
+}
+
+func (e *envReader) Read(p []byte) (int, error) {
+	for len(e.buf) == 0 && e.err == nil && e.undefined == nil {
+		var line string
+		line, e.err = e.r.ReadString('\n')
+		e.buf = []byte(e.expand(line))
+	}
+	n := copy(p, e.buf)
+	e.buf = e.buf[n:]
+	if len(e.buf) > 0 {
+		return n, nil
+	}
+	if e.undefined != nil {
+		return n, e.undefined
+	}
+	return n, e.err
+}
+
+// expand expands the references in line with os.Expand, leaving the tags
+// of dollar quoting as they are.
+func (e *envReader) expand(line string) string {
+	var b strings.Builder
+	start := 0
+	for _, tag := range dollarTag.FindAllStringIndex(line, -1) {
+		b.WriteString(os.Expand(line[start:tag[0]], e.lookup))
+		b.WriteString(line[tag[0]:tag[1]])
+		start = tag[1]
+	}
+	b.WriteString(os.Expand(line[start:], e.lookup))
+	return b.String()
+}
+
+// lookup returns the value of the environment variable name for
+// os.Expand. An undefined variable sets e.undefined if e is strict.
+func (e *envReader) lookup(name string) string {
+	if !envName.MatchString(name) {
+		return "$" + name
+	}
+	value, ok := os.LookupEnv(name)
+	if !ok && e.strict && e.undefined == nil {
+		e.undefined = fmt.Errorf("%w: %v", ErrUndefinedVariable, name)
+	}
+	return value
+}
+
+func (e *envReader) Close() error {
+	return e.closer.Close()
+}
+
+// WithEnvExpansion returns a driver expanding the environment variables
+// referenced by the bodies d returns, see ExpandEnv for strict. Go
+// migrations are passed through. Closing the returned driver closes d.
+func WithEnvExpansion(d Driver, strict bool) Driver {
+	return &envDriver{Driver: d, strict: strict}
+}
+
+type envDriver struct {
+	Driver
+	strict bool
+}
+
+// Open is part of Driver interface implementation. An expanding driver can
+// only be created with WithEnvExpansion.
+func (ed *envDriver) Open(url string) (Driver, error) {
+	return nil, errors.New("expanding driver can't be opened from a URL, use WithEnvExpansion")
+}
+
+func (ed *envDriver) ReadUp(version uint) (io.ReadCloser, string, string, MigrationFunc, error) {
+	return ed.expand(ed.Driver.ReadUp(version))
+}
+
+func (ed *envDriver) ReadDown(version uint) (io.ReadCloser, string, string, MigrationFunc, error) {
+	return ed.expand(ed.Driver.ReadDown(version))
+}
+
+func (ed *envDriver) expand(r io.ReadCloser, identifier, location string, fn MigrationFunc, err error) (io.ReadCloser, string, string, MigrationFunc, error) {
+	if r != nil && err == nil {
+		r = ExpandEnv(r, ed.strict)
+	}
+	return r, identifier, location, fn, err
+}
+
+// UpdateStatusDir is like UpdateStatus, but only updates the migration of
+// direction dir if the wrapped driver supports it.
+func (ed *envDriver) UpdateStatusDir(version uint, dir Direction, status Status, errstr string) {
+	UpdateStatusDir(ed.Driver, version, dir, status, errstr)
+}
+
+// IsEmptyDown reports whether the wrapped driver flags the down migration of
+// version as empty.
+func (ed *envDriver) IsEmptyDown(version uint) bool {
+	return IsEmptyDown(ed.Driver, version)
+}
+
+// IsFunc reports whether the wrapped driver reports the migration of version
+// in direction dir as a go migration function.
+func (ed *envDriver) IsFunc(version uint, dir Direction) bool {
+	return IsFunc(ed.Driver, version, dir)
+}
@@ -0,0 +1,91 @@
+package source_test
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+	"testing/iotest"
+
+	"github.com/nokia/migrate/v4/source"
+	"github.com/nokia/migrate/v4/source/memory"
+)
+
+func TestExpandEnv(t *testing.T) {
+	os.Setenv("MIGRATE_TEST_SCHEMA", "tenant_1")
+	defer os.Unsetenv("MIGRATE_TEST_SCHEMA")
+	os.Unsetenv("MIGRATE_TEST_UNSET")
+
+	body := "CREATE TABLE ${MIGRATE_TEST_SCHEMA}.users ();\n" +
+		"ALTER TABLE $MIGRATE_TEST_SCHEMA.users OWNER TO '${MIGRATE_TEST_UNSET}';\n" +
+		"SELECT $1, $$text$$;"
+	for _, tc := range []struct {
+		name      string
+		body      string
+		strict    bool
+		expected  string
+		expectErr bool
+	}{
+		{
+			name:     "lenient",
+			body:     body,
+			expected: "CREATE TABLE tenant_1.users ();\nALTER TABLE tenant_1.users OWNER TO '';\nSELECT $1, $$text$$;",
+		},
+		{
+			name:      "strict",
+			body:      body,
+			strict:    true,
+			expected:  "CREATE TABLE tenant_1.users ();\nALTER TABLE tenant_1.users OWNER TO '';\n",
+			expectErr: true,
+		},
+		{
+			name:      "strict last line",
+			body:      "SELECT 1;\nSELECT '${MIGRATE_TEST_UNSET}';",
+			strict:    true,
+			expected:  "SELECT 1;\nSELECT '';",
+			expectErr: true,
+		},
+		{
+			name:     "dollar tags",
+			body:     "CREATE FUNCTION $MIGRATE_TEST_SCHEMA.f() AS $body$\nSELECT 1;\n$body$ LANGUAGE sql;",
+			strict:   true,
+			expected: "CREATE FUNCTION tenant_1.f() AS $body$\nSELECT 1;\n$body$ LANGUAGE sql;",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			// read a byte at a time to check the streaming
+			r := source.ExpandEnv(ioutil.NopCloser(strings.NewReader(tc.body)), tc.strict)
+			b, err := ioutil.ReadAll(iotest.OneByteReader(r))
+			if tc.expectErr != errors.Is(err, source.ErrUndefinedVariable) {
+				t.Fatalf("unexpected error %v", err)
+			}
+			if tc.expectErr && !strings.Contains(err.Error(), "MIGRATE_TEST_UNSET") {
+				t.Errorf("expected error to name the variable, got %v", err)
+			}
+			if string(b) != tc.expected {
+				t.Errorf("expected %q, got %q", tc.expected, b)
+			}
+			if err := r.Close(); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+func TestWithEnvExpansion(t *testing.T) {
+	os.Setenv("MIGRATE_TEST_SCHEMA", "tenant_1")
+	defer os.Unsetenv("MIGRATE_TEST_SCHEMA")
+
+	d := source.WithEnvExpansion(memory.New().
+		Add(1, source.Up, "CREATE SCHEMA $MIGRATE_TEST_SCHEMA;").
+		Add(1, source.Down, "DROP SCHEMA ${MIGRATE_TEST_SCHEMA};"), true)
+	body, _, _, _, err := source.ReadUpString(d, 1)
+	if err != nil || body != "CREATE SCHEMA tenant_1;" {
+		t.Errorf("expected %q, got %q, %v", "CREATE SCHEMA tenant_1;", body, err)
+	}
+	body, _, _, _, err = source.ReadDownString(d, 1)
+	if err != nil || body != "DROP SCHEMA tenant_1;" {
+		t.Errorf("expected %q, got %q, %v", "DROP SCHEMA tenant_1;", body, err)
+	}
+}
@@ -1,15 +1,128 @@
 package source
 
-import "os"
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// ErrNilMigration is returned when appending a nil migration.
+var ErrNilMigration = errors.New("nil migration")
+
+// ErrIrreversibleMigration is returned when reading the down migration of
+// a migration that is marked as irreversible.
+var ErrIrreversibleMigration = errors.New("irreversible migration")
+
+// ErrFuncMigration is returned when reading the statements of a go
+// migration function, which has no body.
+var ErrFuncMigration = errors.New("go migration function has no statements")
 
 // ErrDuplicateMigration is an error type for reporting duplicate migration
 // files.
 type ErrDuplicateMigration struct {
 	Migration
 	os.FileInfo
+	// ExistingRaw is the Raw of the migration already holding the version
+	// and direction, if known.
+	ExistingRaw string
+	// ExistingModTime is the ModTime of the migration already holding the
+	// version and direction, if known.
+	ExistingModTime time.Time
 }
 
-// Error implements error interface.
+// Error implements error interface. It names the migration by its Raw
+// path, falling back to the file name, and adds the modification times
+// of both migrations if they are known.
 func (e ErrDuplicateMigration) Error() string {
-	return "duplicate migration file: " + e.Name()
+	name := e.Raw
+	if name == "" && e.FileInfo != nil {
+		name = e.Name()
+	}
+	if e.ExistingRaw == "" {
+		return "duplicate migration file: " + name
+	}
+	if e.Migration.ModTime.IsZero() || e.ExistingModTime.IsZero() {
+		return "duplicate migration file: " + name + " conflicts with " + e.ExistingRaw
+	}
+	return fmt.Sprintf("duplicate migration file: %v (modified %v) conflicts with %v (modified %v)",
+		name, e.Migration.ModTime.Format(time.RFC3339), e.ExistingRaw, e.ExistingModTime.Format(time.RFC3339))
+}
+
+// ErrAmbiguousMigration is an error type for reporting a migration that has
+// both a file body and a registered go migration function.
+type ErrAmbiguousMigration struct {
+	Migration
+	// Func is the file name the go migration function is registered for.
+	Func string
+}
+
+// Error implements error interface.
+func (e ErrAmbiguousMigration) Error() string {
+	return "ambiguous migration: " + e.Raw + " has a go migration function registered in " + e.Func
+}
+
+// ErrMissingDirection is an error type for reporting a version without a
+// migration in Direction.
+type ErrMissingDirection struct {
+	Version   uint
+	Direction Direction
+}
+
+// Error implements error interface.
+func (e ErrMissingDirection) Error() string {
+	return fmt.Sprintf("version %v has no %v migration", e.Version, e.Direction)
+}
+
+// ErrInvalidMigrations lists all problems found by Migrations.Validate.
+type ErrInvalidMigrations []error
+
+// Error implements error interface.
+func (e ErrInvalidMigrations) Error() string {
+	msgs := make([]string, len(e))
+	for i, err := range e {
+		msgs[i] = err.Error()
+	}
+	return "invalid migrations: " + strings.Join(msgs, "; ")
+}
+
+// Is reports whether any of the listed errors matches target, so
+// errors.Is looks into the list before Go 1.20.
+func (e ErrInvalidMigrations) Is(target error) bool {
+	return anyIs(e, target)
+}
+
+// As finds the first of the listed errors that matches target, so
+// errors.As looks into the list before Go 1.20.
+func (e ErrInvalidMigrations) As(target interface{}) bool {
+	return anyAs(e, target)
+}
+
+// Unwrap returns the listed errors, for errors.Is and errors.As of Go 1.20
+// and later.
+func (e ErrInvalidMigrations) Unwrap() []error {
+	return e
+}
+
+// anyIs reports whether errors.Is matches target for any of errs. The
+// multi-error types use it, as errors.Is only unwraps a list of errors
+// since Go 1.20.
+func anyIs(errs []error, target error) bool {
+	for _, err := range errs {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// anyAs sets target to the first of errs matching it, see anyIs.
+func anyAs(errs []error, target interface{}) bool {
+	for _, err := range errs {
+		if errors.As(err, target) {
+			return true
+		}
+	}
+	return false
 }
@@ -0,0 +1,167 @@
+package source
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"runtime"
+)
+
+// NewFuncDriver returns a driver for migrations that are all go migration
+// functions, so no file system or bucket is needed. up and down hold the
+// functions of each direction by version; every version in versions needs
+// at least one of them, and functions of versions not listed are an error.
+// ReadUp and ReadDown return the function with a nil reader. Identifiers
+// are the names of the functions.
+func NewFuncDriver(versions []uint, up, down map[uint]MigrationFunc) (Driver, error) {
+	fd := &funcDriver{
+		migrations: NewMigrations(),
+		funcs:      map[Direction]map[uint]MigrationFunc{Up: up, Down: down},
+	}
+	listed := make(map[uint]bool, len(versions))
+	for _, version := range versions {
+		listed[version] = true
+		if up[version] == nil && down[version] == nil {
+			return nil, fmt.Errorf("no migration function for version %v", version)
+		}
+	}
+	for _, dir := range []Direction{Up, Down} {
+		for version, fn := range fd.funcs[dir] {
+			if !listed[version] {
+				return nil, fmt.Errorf("%v migration function of version %v not listed in versions", dir, version)
+			}
+			if fn == nil {
+				continue
+			}
+			m := &Migration{
+				Version:    version,
+				Identifier: funcName(fn),
+				Direction:  dir,
+				Raw:        fmt.Sprintf("%v.%v.func", version, dir),
+				Status:     Pending,
+			}
+			if err := fd.migrations.AppendErr(m); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return fd, nil
+}
+
+// NewRegisteredFuncDriver is like NewFuncDriver, but for the functions
+// registered with RegisterFuncForVersion. Functions registered after it
+// returned are not seen by the driver.
+func NewRegisteredFuncDriver() (Driver, error) {
+	funcsMu.RLock()
+	versions := make([]uint, 0, len(versionFuncs))
+	up := make(map[uint]MigrationFunc)
+	down := make(map[uint]MigrationFunc)
+	for version, dirs := range versionFuncs {
+		versions = append(versions, version)
+		if fn, ok := dirs[Up]; ok {
+			up[version] = fn
+		}
+		if fn, ok := dirs[Down]; ok {
+			down[version] = fn
+		}
+	}
+	funcsMu.RUnlock()
+	return NewFuncDriver(versions, up, down)
+}
+
+// funcName returns the name of the function fn, e.g. main.seedUsers.
+func funcName(fn MigrationFunc) string {
+	if f := runtime.FuncForPC(reflect.ValueOf(fn).Pointer()); f != nil {
+		return f.Name()
+	}
+	return "<func>"
+}
+
+type funcDriver struct {
+	migrations *Migrations
+	funcs      map[Direction]map[uint]MigrationFunc
+}
+
+// Open is part of Driver interface implementation. A func driver can only
+// be created with NewFuncDriver.
+func (fd *funcDriver) Open(url string) (Driver, error) {
+	return nil, errors.New("func driver can't be opened from a URL, use NewFuncDriver")
+}
+
+func (fd *funcDriver) Close() error {
+	return nil
+}
+
+func (fd *funcDriver) First() (uint, error) {
+	if v, ok := fd.migrations.First(); ok {
+		return v, nil
+	}
+	return 0, &os.PathError{Op: "first", Path: "func", Err: os.ErrNotExist}
+}
+
+func (fd *funcDriver) Prev(version uint) (uint, error) {
+	if v, ok := fd.migrations.Prev(version); ok {
+		return v, nil
+	}
+	return 0, &os.PathError{Op: fmt.Sprintf("prev for version %v", version), Path: "func", Err: os.ErrNotExist}
+}
+
+func (fd *funcDriver) Next(version uint) (uint, error) {
+	if v, ok := fd.migrations.Next(version); ok {
+		return v, nil
+	}
+	return 0, &os.PathError{Op: fmt.Sprintf("next for version %v", version), Path: "func", Err: os.ErrNotExist}
+}
+
+func (fd *funcDriver) ReadUp(version uint) (io.ReadCloser, string, string, MigrationFunc, error) {
+	return fd.read(version, Up)
+}
+
+func (fd *funcDriver) ReadDown(version uint) (io.ReadCloser, string, string, MigrationFunc, error) {
+	return fd.read(version, Down)
+}
+
+func (fd *funcDriver) read(version uint, dir Direction) (io.ReadCloser, string, string, MigrationFunc, error) {
+	m, ok := fd.migrations.peek(version, dir)
+	if !ok {
+		return nil, "", "", nil, &os.PathError{Op: fmt.Sprintf("read %v for version %v", dir, version), Path: "func", Err: os.ErrNotExist}
+	}
+	return nil, m.Identifier, m.Raw, fd.funcs[dir][version], nil
+}
+
+func (fd *funcDriver) MarkSkipMigrations(version uint, dir Direction) {
+	fd.migrations.MarkSkipMigrations(version, dir)
+}
+
+func (fd *funcDriver) UpdateStatus(version uint, status Status, errstr string) {
+	fd.migrations.UpdateStatus(version, status, errstr)
+}
+
+// UpdateStatusDir is like UpdateStatus, but only updates the migration of
+// direction dir.
+func (fd *funcDriver) UpdateStatusDir(version uint, dir Direction, status Status, errstr string) {
+	fd.migrations.UpdateStatusDir(version, dir, status, errstr)
+}
+
+// IsFunc reports whether a function is given for version in direction
+// dir, which is true for every migration of the driver.
+func (fd *funcDriver) IsFunc(version uint, dir Direction) bool {
+	return fd.funcs[dir][version] != nil
+}
+
+func (fd *funcDriver) PrintSummary(dir Direction) {
+	fd.migrations.PrintSummary(dir)
+}
+
+// Versions returns all versions of the driver in ascending order.
+func (fd *funcDriver) Versions() []uint {
+	return fd.migrations.Versions()
+}
+
+// Walk calls fn with a copy of each migration of direction dir in the
+// order they would be applied, see Migrations.Walk.
+func (fd *funcDriver) Walk(dir Direction, fn func(m *Migration) error) error {
+	return fd.migrations.Walk(dir, fn)
+}
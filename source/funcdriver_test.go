@@ -0,0 +1,161 @@
+package source_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"strings"
+	"testing"
+
+	"github.com/nokia/migrate/v4/source"
+	st "github.com/nokia/migrate/v4/source/testing"
+)
+
+func TestFuncDriver(t *testing.T) {
+	called := make(map[string]bool)
+	fn := func(name string) source.MigrationFunc {
+		return func(ctx context.Context, db interface{}) error {
+			called[name] = true
+			return nil
+		}
+	}
+	d, err := source.NewFuncDriver([]uint{1, 3, 4, 5, 7}, map[uint]source.MigrationFunc{
+		1: fn("1 up"),
+		3: fn("3 up"),
+		4: fn("4 up"),
+		7: seedUsers,
+	}, map[uint]source.MigrationFunc{
+		1: fn("1 down"),
+		4: fn("4 down"),
+		5: fn("5 down"),
+		7: fn("7 down"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+	st.TestFirst(t, d)
+	st.TestPrev(t, d)
+	st.TestNext(t, d)
+
+	for _, tc := range []struct {
+		version uint
+		dir     source.Direction
+	}{{1, source.Up}, {1, source.Down}, {5, source.Down}} {
+		read := d.ReadUp
+		if tc.dir == source.Down {
+			read = d.ReadDown
+		}
+		r, _, _, fn, err := read(tc.version)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if r != nil || fn == nil {
+			t.Fatalf("expected a function and no reader for %v %v, got %v, %v", tc.version, tc.dir, r, fn)
+		}
+		if err := fn(context.Background(), nil); err != nil {
+			t.Fatal(err)
+		}
+		if name := fmt.Sprintf("%v %v", tc.version, tc.dir); !called[name] {
+			t.Errorf("expected %v to be called", name)
+		}
+	}
+
+	_, identifier, _, _, err := d.ReadUp(7)
+	if err != nil || !strings.HasSuffix(identifier, "seedUsers") {
+		t.Errorf("expected the function name as identifier, got %q, %v", identifier, err)
+	}
+	if _, _, _, _, err := d.ReadUp(5); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("expected %v, got %v", fs.ErrNotExist, err)
+	}
+
+	// IsFunc is forwarded by the wrapping drivers
+	md, err := source.NewMultiDriver(d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, wd := range []source.Driver{d, md, source.NewCachingDriver(md), source.WithEnvExpansion(md, false)} {
+		for _, tc := range []struct {
+			version uint
+			dir     source.Direction
+			isFunc  bool
+		}{{1, source.Up, true}, {5, source.Down, true}, {5, source.Up, false}, {2, source.Up, false}} {
+			if got := source.IsFunc(wd, tc.version, tc.dir); got != tc.isFunc {
+				t.Errorf("expected IsFunc(%v, %v) of %T to be %v, got %v", tc.version, tc.dir, wd, tc.isFunc, got)
+			}
+		}
+	}
+}
+
+func TestFuncDriverInvalid(t *testing.T) {
+	noop := func(ctx context.Context, db interface{}) error { return nil }
+	if _, err := source.NewFuncDriver([]uint{1, 2}, map[uint]source.MigrationFunc{1: noop}, nil); err == nil {
+		t.Error("expected error for version without functions")
+	}
+	if _, err := source.NewFuncDriver([]uint{1}, map[uint]source.MigrationFunc{1: noop}, map[uint]source.MigrationFunc{2: noop}); err == nil {
+		t.Error("expected error for function of unlisted version")
+	}
+}
+
+func TestRegisterFuncForVersion(t *testing.T) {
+	errUp, errDown := errors.New("42 up"), errors.New("42 down")
+	source.RegisterFuncForVersion(42, source.Up, func(ctx context.Context, db interface{}) error { return errUp })
+	source.RegisterFuncForVersion(42, source.Down, func(ctx context.Context, db interface{}) error { return errDown })
+	source.RegisterFuncForVersion(43, source.Up, seedUsers)
+	defer source.RegisterFuncForVersion(42, source.Up, nil)
+	defer source.RegisterFuncForVersion(42, source.Down, nil)
+	defer source.RegisterFuncForVersion(43, source.Up, nil)
+
+	if fn, ok := source.VersionFuncMigration(42, source.Down); !ok || fn(context.Background(), nil) != errDown {
+		t.Errorf("expected the down function of version 42, got %v", ok)
+	}
+	if _, ok := source.VersionFuncMigration(43, source.Down); ok {
+		t.Error("expected no down function of version 43")
+	}
+
+	d, err := source.NewRegisteredFuncDriver()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+	if v, err := d.First(); err != nil || v != 42 {
+		t.Errorf("expected first version 42, got %v, %v", v, err)
+	}
+	if v, err := d.Next(42); err != nil || v != 43 {
+		t.Errorf("expected next version 43, got %v, %v", v, err)
+	}
+	for dir, expected := range map[source.Direction]error{source.Up: errUp, source.Down: errDown} {
+		read := d.ReadUp
+		if dir == source.Down {
+			read = d.ReadDown
+		}
+		r, _, location, fn, err := read(42)
+		if err != nil || r != nil || fn == nil {
+			t.Fatalf("expected %v function of version 42, got %v, %v", dir, fn, err)
+		}
+		if err := fn(context.Background(), nil); err != expected {
+			t.Errorf("expected %v, got %v", expected, err)
+		}
+		if location != fmt.Sprintf("42.%v.func", dir) {
+			t.Errorf("expected a location independent of any file, got %v", location)
+		}
+	}
+	if _, _, _, _, err := d.ReadDown(43); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("expected %v, got %v", fs.ErrNotExist, err)
+	}
+
+	// removed registrations are gone from drivers created afterwards
+	source.RegisterFuncForVersion(43, source.Up, nil)
+	d, err = source.NewRegisteredFuncDriver()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := d.Next(42); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("expected version 43 to be removed, got %v", err)
+	}
+}
+
+func seedUsers(ctx context.Context, db interface{}) error {
+	return nil
+}
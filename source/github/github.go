@@ -232,6 +232,12 @@ func (g *Github) UpdateStatus(version uint, status source.Status, errstr string)
 	g.migrations.UpdateStatus(version, status, errstr)
 }
 
+// UpdateStatusDir is like UpdateStatus, but only updates the migration of
+// direction dir.
+func (g *Github) UpdateStatusDir(version uint, dir source.Direction, status source.Status, errstr string) {
+	g.migrations.UpdateStatusDir(version, dir, status, errstr)
+}
+
 func (g *Github) PrintSummary(dir source.Direction) {
 	g.migrations.PrintSummary(dir)
 }
@@ -8,7 +8,6 @@ import (
 	"net/http"
 	nurl "net/url"
 	"os"
-	"strconv"
 	"strings"
 
 	"github.com/nokia/migrate/v4/source"
@@ -150,14 +149,14 @@ func (g *Gitlab) readDirectory() error {
 func (g *Gitlab) nodeToMigration(node *gitlab.TreeNode) (*source.Migration, error) {
 	m := source.Regex.FindStringSubmatch(node.Name)
 	if len(m) == 5 {
-		versionUint64, err := strconv.ParseUint(m[1], 10, 64)
+		version, err := source.ParseVersion(m[1])
 		if err != nil {
 			return nil, err
 		}
 		return &source.Migration{
-			Version:    uint(versionUint64),
+			Version:    version,
 			Identifier: m[2],
-			Direction:  source.Direction(m[3]),
+			Direction:  source.Direction(strings.ToLower(m[3])),
 			Raw:        g.path + "/" + node.Name,
 		}, nil
 	}
@@ -244,6 +243,12 @@ func (g *Gitlab) UpdateStatus(version uint, status source.Status, errstr string)
 	g.migrations.UpdateStatus(version, status, errstr)
 }
 
+// UpdateStatusDir is like UpdateStatus, but only updates the migration of
+// direction dir.
+func (g *Gitlab) UpdateStatusDir(version uint, dir source.Direction, status source.Status, errstr string) {
+	g.migrations.UpdateStatusDir(version, dir, status, errstr)
+}
+
 func (g *Gitlab) PrintSummary(dir source.Direction) {
 	g.migrations.PrintSummary(dir)
 }
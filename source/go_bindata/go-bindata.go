@@ -124,6 +124,12 @@ func (b *Bindata) UpdateStatus(version uint, status source.Status, errstr string
 	b.migrations.UpdateStatus(version, status, errstr)
 }
 
+// UpdateStatusDir is like UpdateStatus, but only updates the migration of
+// direction dir.
+func (b *Bindata) UpdateStatusDir(version uint, dir source.Direction, status source.Status, errstr string) {
+	b.migrations.UpdateStatusDir(version, dir, status, errstr)
+}
+
 func (b *Bindata) PrintSummary(dir source.Direction) {
 	b.migrations.PrintSummary(dir)
 }
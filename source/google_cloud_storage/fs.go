@@ -0,0 +1,157 @@
+package googlecloudstorage
+
+import (
+	"context"
+	"io"
+	"io/fs"
+	"path"
+	"sort"
+	"time"
+
+	"cloud.google.com/go/storage"
+)
+
+// FS returns a read only fs.FS of the migration objects of the driver.
+// It has a single flat directory holding the recognized migration files,
+// which are read from the bucket when opened.
+func (g *gcs) FS() fs.FS {
+	gfs := &gcsFS{g: g, files: make(map[string]bool)}
+	for version, ok := g.migrations.First(); ok; version, ok = g.migrations.Next(version) {
+		if m, ok := g.migrations.Up(version); ok {
+			gfs.files[m.Raw] = true
+		}
+		if m, ok := g.migrations.Down(version); ok {
+			gfs.files[m.Raw] = true
+		}
+	}
+	return gfs
+}
+
+type gcsFS struct {
+	g     *gcs
+	files map[string]bool
+}
+
+func (f *gcsFS) object(name string) *storage.ObjectHandle {
+	return f.g.bucket.Object(path.Join(f.g.prefix, name))
+}
+
+// Open implements fs.FS.
+func (f *gcsFS) Open(name string) (fs.File, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrInvalid}
+	}
+	if name == "." {
+		entries, err := f.ReadDir(name)
+		if err != nil {
+			return nil, err
+		}
+		return &gcsDir{entries: entries}, nil
+	}
+	if !f.files[name] {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	}
+	r, err := f.object(name).NewReader(context.Background())
+	if err != nil {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+	}
+	return &gcsFile{Reader: r, entry: gcsDirEntry{fs: f, name: name}}, nil
+}
+
+// ReadDir implements fs.ReadDirFS.
+func (f *gcsFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	if name != "." {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: fs.ErrNotExist}
+	}
+	entries := make([]fs.DirEntry, 0, len(f.files))
+	for file := range f.files {
+		entries = append(entries, &gcsDirEntry{fs: f, name: file})
+	}
+	sort.Slice(entries, func(x, y int) bool {
+		return entries[x].Name() < entries[y].Name()
+	})
+	return entries, nil
+}
+
+// gcsFile is an open migration object.
+type gcsFile struct {
+	*storage.Reader
+	entry gcsDirEntry
+}
+
+func (f *gcsFile) Stat() (fs.FileInfo, error) {
+	return f.entry.Info()
+}
+
+// gcsDir is the root directory of a gcsFS.
+type gcsDir struct {
+	entries []fs.DirEntry
+	offset  int
+}
+
+func (d *gcsDir) Stat() (fs.FileInfo, error) {
+	return &gcsFileInfo{name: ".", dir: true}, nil
+}
+
+func (d *gcsDir) Read([]byte) (int, error) {
+	return 0, &fs.PathError{Op: "read", Path: ".", Err: fs.ErrInvalid}
+}
+
+func (d *gcsDir) Close() error {
+	return nil
+}
+
+// ReadDir implements fs.ReadDirFile.
+func (d *gcsDir) ReadDir(n int) ([]fs.DirEntry, error) {
+	rest := d.entries[d.offset:]
+	if n <= 0 {
+		d.offset = len(d.entries)
+		return rest, nil
+	}
+	if len(rest) == 0 {
+		return nil, io.EOF
+	}
+	if n > len(rest) {
+		n = len(rest)
+	}
+	d.offset += n
+	return rest[:n], nil
+}
+
+// gcsDirEntry fetches the object attributes only when Info is called.
+type gcsDirEntry struct {
+	fs   *gcsFS
+	name string
+}
+
+func (e *gcsDirEntry) Name() string      { return e.name }
+func (e *gcsDirEntry) IsDir() bool       { return false }
+func (e *gcsDirEntry) Type() fs.FileMode { return 0 }
+
+func (e *gcsDirEntry) Info() (fs.FileInfo, error) {
+	attrs, err := e.fs.object(e.name).Attrs(context.Background())
+	if err != nil {
+		return nil, &fs.PathError{Op: "stat", Path: e.name, Err: err}
+	}
+	return &gcsFileInfo{name: e.name, size: attrs.Size, modTime: attrs.Updated}, nil
+}
+
+type gcsFileInfo struct {
+	name    string
+	size    int64
+	modTime time.Time
+	dir     bool
+}
+
+func (i *gcsFileInfo) Name() string       { return i.name }
+func (i *gcsFileInfo) Size() int64        { return i.size }
+func (i *gcsFileInfo) ModTime() time.Time { return i.modTime }
+func (i *gcsFileInfo) IsDir() bool        { return i.dir }
+func (i *gcsFileInfo) Sys() interface{}   { return nil }
+
+func (i *gcsFileInfo) Mode() fs.FileMode {
+	if i.dir {
+		return fs.ModeDir | 0555
+	}
+	return 0444
+}
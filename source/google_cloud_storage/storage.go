@@ -1,16 +1,24 @@
 package googlecloudstorage
 
 import (
+	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"io"
+	"io/fs"
+	"net"
 	"net/url"
-	"os"
 	"path"
+	"strconv"
 	"strings"
+	"sync"
+	"syscall"
+	"time"
 
 	"cloud.google.com/go/storage"
 	"github.com/nokia/migrate/v4/source"
+	"google.golang.org/api/googleapi"
 	"google.golang.org/api/iterator"
 )
 
@@ -20,8 +28,63 @@ func init() {
 
 type gcs struct {
 	bucket     *storage.BucketHandle
+	bucketName string
 	prefix     string
 	migrations *source.Migrations
+	// readChunkSize is the number of bytes fetched per request when reading
+	// a migration. Zero streams the whole object with a single request.
+	readChunkSize int64
+	// countBytes records the number of bytes read from a migration in its
+	// Bytes, see source.CountBytes.
+	countBytes bool
+	// maxRetries is how often listing the objects, opening a migration and
+	// reading a chunk of it are retried after a transient error, waiting
+	// backoff before the first retry and twice as long before each further
+	// one.
+	maxRetries int
+	backoff    time.Duration
+	// listTimeout bounds the time listing the objects may take, retries
+	// included. Zero means no limit.
+	listTimeout time.Duration
+	// slots holds a token for each open migration if the number of open
+	// migrations is limited, a full channel makes open wait for a reader
+	// to be closed. Nil means no limit.
+	slots chan struct{}
+	// objects lists the objects below prefix, it defaults to listing them
+	// in bucket.
+	objects func(ctx context.Context) objectIterator
+	// onSkip is called with the objects left out by loadMigrations.
+	onSkip  func(path string, err error)
+	skipped []skippedObject
+}
+
+// skippedObject is an object whose name didn't parse as a migration.
+type skippedObject struct {
+	name string
+	err  error
+}
+
+// DefaultMaxRetries is the number of retries after transient errors if
+// x-max-retries is not set.
+var DefaultMaxRetries = 3
+
+// DefaultRetryBackoff is the time waited before the first retry.
+var DefaultRetryBackoff = 100 * time.Millisecond
+
+// Config configures a driver returned by WithInstance.
+type Config struct {
+	Bucket string
+	// Prefix is the path of the migrations within the bucket, e.g.
+	// prod/migrations. Empty means the root of the bucket.
+	Prefix string
+	// OnSkip, if set, is called with the name of each object that is left
+	// out because it doesn't parse as a migration.
+	OnSkip func(path string, err error)
+}
+
+// objectIterator is implemented by *storage.ObjectIterator.
+type objectIterator interface {
+	Next() (*storage.ObjectAttrs, error)
 }
 
 func (g *gcs) Open(folder string) (source.Driver, error) {
@@ -33,32 +96,162 @@ func (g *gcs) Open(folder string) (source.Driver, error) {
 	if err != nil {
 		return nil, err
 	}
-	driver := gcs{
-		bucket:     client.Bucket(u.Host),
-		prefix:     strings.Trim(u.Path, "/") + "/",
-		migrations: source.NewMigrations(),
+	driver := newDriver(client, &Config{Bucket: u.Host, Prefix: u.Path})
+	if s := u.Query().Get("x-max-retries"); len(s) > 0 {
+		driver.maxRetries, err = strconv.Atoi(s)
+		if err != nil {
+			return nil, fmt.Errorf("unable to parse option x-max-retries: %w", err)
+		}
+		if driver.maxRetries < 0 {
+			return nil, fmt.Errorf("x-max-retries must not be negative, got %v", driver.maxRetries)
+		}
+	}
+	if s := u.Query().Get("x-read-chunk-size"); len(s) > 0 {
+		driver.readChunkSize, err = strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("unable to parse option x-read-chunk-size: %w", err)
+		}
+		if driver.readChunkSize < 0 {
+			return nil, fmt.Errorf("x-read-chunk-size must not be negative, got %v", driver.readChunkSize)
+		}
+	}
+	if s := u.Query().Get("x-list-timeout"); len(s) > 0 {
+		driver.listTimeout, err = time.ParseDuration(s)
+		if err != nil {
+			return nil, fmt.Errorf("unable to parse option x-list-timeout: %w", err)
+		}
+		if driver.listTimeout < 0 {
+			return nil, fmt.Errorf("x-list-timeout must not be negative, got %v", driver.listTimeout)
+		}
+	}
+	if s := u.Query().Get("x-max-open"); len(s) > 0 {
+		maxOpen, err := strconv.Atoi(s)
+		if err != nil {
+			return nil, fmt.Errorf("unable to parse option x-max-open: %w", err)
+		}
+		if maxOpen < 0 {
+			return nil, fmt.Errorf("x-max-open must not be negative, got %v", maxOpen)
+		}
+		if maxOpen > 0 {
+			driver.slots = make(chan struct{}, maxOpen)
+		}
+	}
+	if s := u.Query().Get("x-count-bytes"); len(s) > 0 {
+		driver.countBytes, err = strconv.ParseBool(s)
+		if err != nil {
+			return nil, fmt.Errorf("unable to parse option x-count-bytes: %w", err)
+		}
 	}
 	err = driver.loadMigrations()
 	if err != nil {
 		return nil, err
 	}
-	return &driver, nil
+	return driver, nil
+}
+
+// WithInstance returns a driver reading the migrations below config.Prefix
+// in config.Bucket with client, using the defaults of the URL options.
+func WithInstance(client *storage.Client, config *Config) (source.Driver, error) {
+	driver := newDriver(client, config)
+	if err := driver.loadMigrations(); err != nil {
+		return nil, err
+	}
+	return driver, nil
+}
+
+// newDriver returns a driver for config with the default options, which
+// has yet to load its migrations.
+func newDriver(client *storage.Client, config *Config) *gcs {
+	return &gcs{
+		bucket:     client.Bucket(config.Bucket),
+		bucketName: config.Bucket,
+		prefix:     objectPrefix(config.Prefix),
+		migrations: source.NewMigrations(),
+		maxRetries: DefaultMaxRetries,
+		backoff:    DefaultRetryBackoff,
+		onSkip:     config.OnSkip,
+	}
 }
 
+// objectPrefix returns the prefix of the objects below the URL path p,
+// which is empty for the root of the bucket.
+func objectPrefix(p string) string {
+	p = strings.Trim(p, "/")
+	if len(p) == 0 {
+		return ""
+	}
+	return p + "/"
+}
+
+// loadMigrations lists the migrations below prefix. A listing failing with
+// a transient error is started over, as the iterator can't be resumed, so
+// skipped objects are only reported once the listing succeeded. Once
+// listTimeout has passed, loadMigrations gives up with an error wrapping
+// context.DeadlineExceeded.
 func (g *gcs) loadMigrations() error {
-	iter := g.bucket.Objects(context.Background(), &storage.Query{
-		Prefix:    g.prefix,
-		Delimiter: "/",
+	ctx := context.Background()
+	if g.listTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, g.listTimeout)
+		defer cancel()
+	}
+	err := g.retry(ctx, func() error {
+		g.migrations = source.NewMigrations()
+		g.skipped = nil
+		return g.listMigrations(ctx)
 	})
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return fmt.Errorf("listing gcs://%v/%v timed out after %v: %w", g.bucketName, g.prefix, g.listTimeout, ctx.Err())
+	}
+	if err != nil {
+		return err
+	}
+	if g.onSkip != nil {
+		for _, s := range g.skipped {
+			g.onSkip(s.name, s.err)
+		}
+	}
+	g.skipped = nil
+	return nil
+}
+
+func (g *gcs) listMigrations(ctx context.Context) error {
+	var iter objectIterator
+	if g.objects != nil {
+		iter = g.objects(ctx)
+	} else {
+		iter = g.bucket.Objects(ctx, &storage.Query{
+			Prefix:    g.prefix,
+			Delimiter: "/",
+		})
+	}
 	object, err := iter.Next()
 	for ; err == nil; object, err = iter.Next() {
+		if object.Name == "" {
+			// synthetic entry of a directory below prefix, listed with
+			// the delimiter
+			continue
+		}
 		_, fileName := path.Split(object.Name)
 		m, parseErr := source.DefaultParse(fileName)
-		if parseErr != nil {
+		if errors.Is(parseErr, source.ErrParse) {
+			g.skipped = append(g.skipped, skippedObject{object.Name, parseErr})
 			continue
 		}
-		if !g.migrations.Append(m) {
-			return fmt.Errorf("unable to parse file %v", object.Name)
+		if parseErr != nil {
+			return fmt.Errorf("unable to parse file %v: %w", object.Name, parseErr)
+		}
+		m.Raw = fileName
+		m.Empty = m.Direction == source.Down && object.Size == 0
+		m.ModTime = object.Updated
+		if err := g.migrations.AppendErr(m); err != nil {
+			var dup source.ErrDuplicateMigration
+			if errors.As(err, &dup) {
+				// name the objects instead of the file names
+				dup.Raw, dup.ExistingRaw = object.Name, path.Join(g.prefix, dup.ExistingRaw)
+				return dup
+			}
+			return err
 		}
 	}
 	if err != iterator.Done {
@@ -67,6 +260,39 @@ func (g *gcs) loadMigrations() error {
 	return nil
 }
 
+// retry calls f until it succeeds, fails with an error that is not
+// transient, maxRetries retries are used up or ctx is done.
+func (g *gcs) retry(ctx context.Context, f func() error) error {
+	wait := g.backoff
+	for attempt := 0; ; attempt++ {
+		err := f()
+		if err == nil || attempt >= g.maxRetries || !isTransient(err) || ctx.Err() != nil {
+			return err
+		}
+		select {
+		case <-time.After(wait):
+		case <-ctx.Done():
+			return err
+		}
+		wait *= 2
+	}
+}
+
+// isTransient reports whether err is worth a retry: a server error or rate
+// limit of the storage API, a timeout or a dropped connection. Client
+// errors like failed authentication are not.
+func isTransient(err error) bool {
+	var apiErr *googleapi.Error
+	if errors.As(err, &apiErr) {
+		return apiErr.Code == 429 || apiErr.Code >= 500
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return true
+	}
+	return errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, syscall.ECONNRESET)
+}
+
 func (g *gcs) Close() error {
 	return nil
 }
@@ -74,7 +300,7 @@ func (g *gcs) Close() error {
 func (g *gcs) First() (uint, error) {
 	v, ok := g.migrations.First()
 	if !ok {
-		return 0, os.ErrNotExist
+		return 0, g.errNotExist("first")
 	}
 	return v, nil
 }
@@ -82,7 +308,7 @@ func (g *gcs) First() (uint, error) {
 func (g *gcs) Prev(version uint) (uint, error) {
 	v, ok := g.migrations.Prev(version)
 	if !ok {
-		return 0, os.ErrNotExist
+		return 0, g.errNotExist("prev for version " + strconv.FormatUint(uint64(version), 10))
 	}
 	return v, nil
 }
@@ -90,7 +316,7 @@ func (g *gcs) Prev(version uint) (uint, error) {
 func (g *gcs) Next(version uint) (uint, error) {
 	v, ok := g.migrations.Next(version)
 	if !ok {
-		return 0, os.ErrNotExist
+		return 0, g.errNotExist("next for version " + strconv.FormatUint(uint64(version), 10))
 	}
 	return v, nil
 }
@@ -99,23 +325,211 @@ func (g *gcs) ReadUp(version uint) (io.ReadCloser, string, string, source.Migrat
 	if m, ok := g.migrations.Up(version); ok {
 		return g.open(m)
 	}
-	return nil, "", "", nil, os.ErrNotExist
+	return nil, "", "", nil, g.errNotExist("read up for version " + strconv.FormatUint(uint64(version), 10))
 }
 
 func (g *gcs) ReadDown(version uint) (io.ReadCloser, string, string, source.MigrationFunc, error) {
 	if m, ok := g.migrations.Down(version); ok {
 		return g.open(m)
 	}
-	return nil, "", "", nil, os.ErrNotExist
+	// down function registered together with the up migration
+	if m, ok := g.migrations.Up(version); ok {
+		if fn, ok := source.DownFuncMigration(m.Raw); ok {
+			if source.IsIrreversible(fn) {
+				return nil, "", "", nil, fmt.Errorf("%w: %v", source.ErrIrreversibleMigration, m.Raw)
+			}
+			return nil, m.Identifier, m.Raw, fn, nil
+		}
+	}
+	return nil, "", "", nil, g.errNotExist("read down for version " + strconv.FormatUint(uint64(version), 10))
+}
+
+// errNotExist returns an error wrapping fs.ErrNotExist for op on the
+// migrations location, like the iofs driver does.
+func (g *gcs) errNotExist(op string) error {
+	return &fs.PathError{
+		Op:   op,
+		Path: "gcs://" + g.bucketName + "/" + g.prefix,
+		Err:  fs.ErrNotExist,
+	}
 }
 
+// open returns a reader of the object of m, or the go migration function
+// registered for it, see source.FuncMigration. If x-max-open is set, it
+// waits until fewer migrations than that are open, the slot taken is
+// released when the reader is closed.
 func (g *gcs) open(m *source.Migration) (io.ReadCloser, string, string, source.MigrationFunc, error) {
-	objectPath := path.Join(g.prefix, m.Raw)
-	reader, err := g.bucket.Object(objectPath).NewReader(context.Background())
+	fn, err := source.FuncMigration(m)
 	if err != nil {
 		return nil, "", "", nil, err
 	}
-	return reader, m.Identifier, m.Raw, nil, nil
+	if m.Direction == source.Down && source.IsIrreversible(fn) {
+		return nil, "", "", nil, fmt.Errorf("%w: %v", source.ErrIrreversibleMigration, m.Raw)
+	}
+	if fn != nil {
+		g.count(m, nil)
+		return nil, m.Identifier, m.Raw, fn, nil
+	}
+	objectPath := path.Join(g.prefix, m.Raw)
+	object := g.bucket.Object(objectPath)
+	ctx := context.Background()
+	g.acquire()
+	if g.readChunkSize > 0 {
+		// the size tells the last chunk apart, and a missing object is
+		// reported on open rather than on the first read
+		var attrs *storage.ObjectAttrs
+		err = g.retry(ctx, func() (err error) {
+			attrs, err = object.Attrs(ctx)
+			return err
+		})
+		if err != nil {
+			g.release()
+			return nil, "", "", nil, g.readErr(objectPath, err)
+		}
+		chunks := &chunkReader{object: object, size: g.readChunkSize, total: attrs.Size, retry: g.retry}
+		return g.slot(g.count(m, chunks)), m.Identifier, m.Raw, nil, nil
+	}
+	var reader *storage.Reader
+	err = g.retry(ctx, func() (err error) {
+		reader, err = object.NewReader(ctx)
+		return err
+	})
+	if err != nil {
+		g.release()
+		return nil, "", "", nil, g.readErr(objectPath, err)
+	}
+	return g.slot(g.count(m, reader)), m.Identifier, m.Raw, nil, nil
+}
+
+// readErr turns storage.ErrObjectNotExist for the object at objectPath
+// into an error wrapping fs.ErrNotExist, like the iofs driver returns for
+// a missing file. Other errors are returned as is.
+func (g *gcs) readErr(objectPath string, err error) error {
+	if errors.Is(err, storage.ErrObjectNotExist) {
+		return &fs.PathError{
+			Op:   "read",
+			Path: "gcs://" + g.bucketName + "/" + objectPath,
+			Err:  fs.ErrNotExist,
+		}
+	}
+	return err
+}
+
+// acquire takes a slot for an open migration, waiting for one to be
+// released if all are taken.
+func (g *gcs) acquire() {
+	if g.slots != nil {
+		g.slots <- struct{}{}
+	}
+}
+
+// release gives back a slot taken by acquire.
+func (g *gcs) release() {
+	if g.slots != nil {
+		<-g.slots
+	}
+}
+
+// slot wraps body to release its slot when it is closed.
+func (g *gcs) slot(body io.ReadCloser) io.ReadCloser {
+	if g.slots == nil {
+		return body
+	}
+	return &slotReader{ReadCloser: body, release: g.release}
+}
+
+// slotReader releases the slot of an open migration once it is closed.
+// Closing it more than once releases the slot only once.
+type slotReader struct {
+	io.ReadCloser
+	once    sync.Once
+	release func()
+}
+
+func (r *slotReader) Close() error {
+	err := r.ReadCloser.Close()
+	r.once.Do(r.release)
+	return err
+}
+
+// count wraps body to record its size in m if x-count-bytes is set.
+func (g *gcs) count(m *source.Migration, body io.ReadCloser) io.ReadCloser {
+	if !g.countBytes {
+		return body
+	}
+	return source.CountBytes(m, body)
+}
+
+// chunkReader reads an object with one range request per chunk of size
+// bytes. Only the current chunk is held in memory, so larger chunks mean
+// fewer round trips at the cost of more memory per open migration. The
+// client has no chunk setting for reads, storage.Writer.ChunkSize only
+// applies to uploads and storage.Reader streams the whole range it was
+// opened for, so the chunks are read with range requests of their own.
+type chunkReader struct {
+	object *storage.ObjectHandle
+	size   int64
+	// total is the size of the object, read when it was opened.
+	total  int64
+	offset int64
+	buf    bytes.Buffer
+	// retry retries a range request failing with a transient error.
+	retry func(ctx context.Context, f func() error) error
+}
+
+func (c *chunkReader) Read(p []byte) (int, error) {
+	if c.buf.Len() == 0 {
+		if c.offset >= c.total {
+			return 0, io.EOF
+		}
+		if err := c.fill(); err != nil {
+			return 0, err
+		}
+		if c.buf.Len() == 0 {
+			// the object was truncated since it was opened
+			return 0, io.ErrUnexpectedEOF
+		}
+	}
+	return c.buf.Read(p)
+}
+
+// fill reads the chunk at offset into buf. The last chunk only asks for
+// the bytes left in the object. A range request failing part way is
+// started over, so buf never holds half a chunk.
+func (c *chunkReader) fill() error {
+	ctx := context.Background()
+	length := c.size
+	if left := c.total - c.offset; left < length {
+		length = left
+	}
+	err := c.retry(ctx, func() error {
+		c.buf.Reset()
+		r, err := c.object.NewRangeReader(ctx, c.offset, length)
+		if err != nil {
+			return err
+		}
+		defer r.Close()
+		_, err = c.buf.ReadFrom(r)
+		return err
+	})
+	if err != nil {
+		c.buf.Reset()
+		return err
+	}
+	c.offset += int64(c.buf.Len())
+	return nil
+}
+
+func (c *chunkReader) Close() error {
+	c.offset = c.total
+	c.buf.Reset()
+	return nil
+}
+
+// IsEmptyDown reports whether the down migration for version is an
+// empty object.
+func (g *gcs) IsEmptyDown(version uint) bool {
+	return g.migrations.IsEmptyDown(version)
 }
 
 func (g *gcs) MarkSkipMigrations(version uint, dir source.Direction) {
@@ -126,6 +540,88 @@ func (g *gcs) UpdateStatus(version uint, status source.Status, errstr string) {
 	g.migrations.UpdateStatus(version, status, errstr)
 }
 
+// UpdateStatusDir is like UpdateStatus, but only updates the migration of
+// direction dir.
+func (g *gcs) UpdateStatusDir(version uint, dir source.Direction, status source.Status, errstr string) {
+	g.migrations.UpdateStatusDir(version, dir, status, errstr)
+}
+
 func (g *gcs) PrintSummary(dir source.Direction) {
 	g.migrations.PrintSummary(dir)
 }
+
+// SummaryJSON returns the summary printed by PrintSummary as JSON.
+// See source.Migrations.SummaryJSON.
+func (g *gcs) SummaryJSON(dir source.Direction) ([]byte, error) {
+	return g.migrations.SummaryJSON(dir)
+}
+
+// ComputeChecksums reads every migration and records the SHA-256 of its
+// body, which is reported by SummaryJSON.
+func (g *gcs) ComputeChecksums() error {
+	return g.migrations.ComputeChecksums(g)
+}
+
+// Versions returns all versions available to the driver in ascending order.
+func (g *gcs) Versions() []uint {
+	return g.migrations.Versions()
+}
+
+// IsFunc reports whether the migration of version in direction dir is a
+// go migration function rather than an object, without reading it.
+// See source.Migrations.IsFunc.
+func (g *gcs) IsFunc(version uint, dir source.Direction) bool {
+	return g.migrations.IsFunc(version, dir)
+}
+
+// Identifier returns the identifier of the migration of version in
+// direction dir without reading it.
+func (g *gcs) Identifier(version uint, dir source.Direction) (string, bool) {
+	return g.migrations.Identifier(version, dir)
+}
+
+// FindByIdentifier returns a copy of the first migration in direction dir
+// named identifier, see source.Migrations.FindByIdentifier.
+func (g *gcs) FindByIdentifier(identifier string, dir source.Direction) (*source.Migration, bool) {
+	return g.migrations.FindByIdentifier(identifier, dir)
+}
+
+// FindByIdentifierFold is like FindByIdentifier, but matches identifier
+// case insensitively.
+func (g *gcs) FindByIdentifierFold(identifier string, dir source.Direction) (*source.Migration, bool) {
+	return g.migrations.FindByIdentifierFold(identifier, dir)
+}
+
+// Walk calls fn with a copy of each migration of direction dir in the
+// order they would be applied, see source.Migrations.Walk.
+func (g *gcs) Walk(dir source.Direction, fn func(m *source.Migration) error) error {
+	return g.migrations.Walk(dir, fn)
+}
+
+// Counts returns how many migrations of direction dir are in each status.
+func (g *gcs) Counts(dir source.Direction) map[source.Status]int {
+	return g.migrations.Counts(dir)
+}
+
+// HasFailures reports whether a migration has failed.
+func (g *gcs) HasFailures() bool {
+	return g.migrations.HasFailures()
+}
+
+// Validate checks that every version has an up and a down migration, or
+// only an up migration if downOptional is set, see source.Migrations.Validate.
+func (g *gcs) Validate(downOptional bool) error {
+	return g.migrations.Validate(downOptional)
+}
+
+// MissingVersions returns the versions absent from the sequence start,
+// start+step, ... up to the highest version of the driver.
+// See source.Migrations.MissingVersions.
+func (g *gcs) MissingVersions(start, step uint) []uint {
+	return g.migrations.MissingVersions(start, step)
+}
+
+// Reset sets the status of all migrations back to pending.
+func (g *gcs) Reset() {
+	g.migrations.Reset()
+}
@@ -1,11 +1,28 @@
 package googlecloudstorage
 
 import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"io/ioutil"
+	"net/url"
+	"reflect"
+	"strings"
+	"sync"
+	"syscall"
 	"testing"
+	"testing/fstest"
+	"time"
 
+	"cloud.google.com/go/storage"
 	"github.com/fsouza/fake-gcs-server/fakestorage"
 	"github.com/nokia/migrate/v4/source"
 	st "github.com/nokia/migrate/v4/source/testing"
+	"google.golang.org/api/googleapi"
+	"google.golang.org/api/iterator"
 )
 
 func Test(t *testing.T) {
@@ -35,3 +52,528 @@ func Test(t *testing.T) {
 	}
 	st.Test(t, &driver)
 }
+
+func BenchmarkReadUpChunkSize(b *testing.B) {
+	content := bytes.Repeat([]byte("INSERT INTO seed VALUES (1);\n"), 1<<18)
+	server := fakestorage.NewServer([]fakestorage.Object{
+		{BucketName: "some-bucket", Name: "prod/migrations/1_seed.up.sql", Content: content},
+	})
+	defer server.Stop()
+
+	for _, bm := range []struct {
+		name      string
+		chunkSize int64
+	}{
+		{name: "default"},
+		{name: "256KiB", chunkSize: 256 << 10},
+		{name: "4MiB", chunkSize: 4 << 20},
+	} {
+		b.Run(bm.name, func(b *testing.B) {
+			driver := gcs{
+				bucket:        server.Client().Bucket("some-bucket"),
+				prefix:        "prod/migrations/",
+				migrations:    source.NewMigrations(),
+				readChunkSize: bm.chunkSize,
+			}
+			if err := driver.loadMigrations(); err != nil {
+				b.Fatal(err)
+			}
+			b.SetBytes(int64(len(content)))
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				r, _, _, _, err := driver.ReadUp(1)
+				if err != nil {
+					b.Fatal(err)
+				}
+				n, err := io.Copy(ioutil.Discard, r)
+				if err != nil {
+					b.Fatal(err)
+				}
+				if n != int64(len(content)) {
+					b.Fatalf("expected %v bytes, got %v", len(content), n)
+				}
+				r.Close()
+			}
+		})
+	}
+}
+
+func TestPrefix(t *testing.T) {
+	server := fakestorage.NewServer([]fakestorage.Object{
+		{BucketName: "some-bucket", Name: "1_root.up.sql", Content: []byte("1 root")},
+		{BucketName: "some-bucket", Name: "migrations/1_nested.up.sql", Content: []byte("1 nested")},
+	})
+	defer server.Stop()
+	for _, tc := range []struct {
+		url            string
+		expectedPrefix string
+		expectedBody   string
+	}{
+		{"gcs://some-bucket", "", "1 root"},
+		{"gcs://some-bucket/", "", "1 root"},
+		{"gcs://some-bucket/migrations/", "migrations/", "1 nested"},
+	} {
+		t.Run(tc.url, func(t *testing.T) {
+			u, err := url.Parse(tc.url)
+			if err != nil {
+				t.Fatal(err)
+			}
+			driver := gcs{
+				bucket:     server.Client().Bucket(u.Host),
+				bucketName: u.Host,
+				prefix:     objectPrefix(u.Path),
+				migrations: source.NewMigrations(),
+			}
+			if driver.prefix != tc.expectedPrefix {
+				t.Errorf("expected prefix %q, got %q", tc.expectedPrefix, driver.prefix)
+			}
+			if err := driver.loadMigrations(); err != nil {
+				t.Fatal(err)
+			}
+			body, _, _, _, err := source.ReadUpString(&driver, 1)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if body != tc.expectedBody {
+				t.Errorf("expected %q, got %q", tc.expectedBody, body)
+			}
+		})
+	}
+}
+
+func TestFS(t *testing.T) {
+	server := fakestorage.NewServer([]fakestorage.Object{
+		{BucketName: "some-bucket", Name: "prod/migrations/1_foobar.up.sql", Content: []byte("1 up")},
+		{BucketName: "some-bucket", Name: "prod/migrations/1_foobar.down.sql", Content: []byte("1 down")},
+		{BucketName: "some-bucket", Name: "prod/migrations/3_foobar.up.sql", Content: []byte("3 up")},
+		{BucketName: "some-bucket", Name: "prod/migrations/not-a-migration.txt"},
+	})
+	defer server.Stop()
+	driver := gcs{
+		bucket:     server.Client().Bucket("some-bucket"),
+		prefix:     "prod/migrations/",
+		migrations: source.NewMigrations(),
+	}
+	if err := driver.loadMigrations(); err != nil {
+		t.Fatal(err)
+	}
+
+	fsys := driver.FS()
+	if err := fstest.TestFS(fsys, "1_foobar.up.sql", "1_foobar.down.sql", "3_foobar.up.sql"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := fsys.Open("not-a-migration.txt"); err == nil {
+		t.Error("expected non-migration object to be hidden")
+	}
+}
+
+func TestDuplicateMigration(t *testing.T) {
+	server := fakestorage.NewServer([]fakestorage.Object{
+		{BucketName: "some-bucket", Name: "prod/migrations/1_foobar.up.sql", Content: []byte("1 up")},
+		{BucketName: "some-bucket", Name: "prod/migrations/1_other.up.sql", Content: []byte("1 up")},
+	})
+	defer server.Stop()
+	driver := gcs{
+		bucket:     server.Client().Bucket("some-bucket"),
+		prefix:     "prod/migrations/",
+		migrations: source.NewMigrations(),
+	}
+	err := driver.loadMigrations()
+	var dup source.ErrDuplicateMigration
+	if !errors.As(err, &dup) {
+		t.Fatalf("expected ErrDuplicateMigration, got %v", err)
+	}
+	for _, name := range []string{"prod/migrations/1_foobar.up.sql", "prod/migrations/1_other.up.sql"} {
+		if !strings.Contains(err.Error(), name) {
+			t.Errorf("expected error to name %v, got %v", name, err)
+		}
+	}
+}
+
+// flakyObjects returns iterators over objects that fail with err after the
+// first object for the first failures listings.
+func flakyObjects(objects []*storage.ObjectAttrs, failures int, err error) (func(ctx context.Context) objectIterator, *int) {
+	listings := 0
+	return func(ctx context.Context) objectIterator {
+		listings++
+		it := &fakeIterator{objects: objects}
+		if listings <= failures {
+			it.objects, it.err = objects[:1], err
+		}
+		return it
+	}, &listings
+}
+
+type fakeIterator struct {
+	objects []*storage.ObjectAttrs
+	err     error
+}
+
+func (it *fakeIterator) Next() (*storage.ObjectAttrs, error) {
+	if len(it.objects) == 0 {
+		if it.err != nil {
+			return nil, it.err
+		}
+		return nil, iterator.Done
+	}
+	o := it.objects[0]
+	it.objects = it.objects[1:]
+	return o, nil
+}
+
+func TestRetryListing(t *testing.T) {
+	objects := []*storage.ObjectAttrs{
+		{Name: "prod/migrations/1_foobar.up.sql", Size: 4},
+		{Name: "prod/migrations/1_foobar.down.sql", Size: 6},
+		{Name: "prod/migrations/3_foobar.up.sql", Size: 4},
+	}
+	unavailable := &googleapi.Error{Code: 503}
+	for _, tc := range []struct {
+		name         string
+		failures     int
+		err          error
+		expectErr    bool
+		expectListed int
+	}{
+		{name: "transient", failures: 2, err: unavailable, expectListed: 3},
+		{name: "connection reset", failures: 1, err: syscall.ECONNRESET, expectListed: 2},
+		{name: "retries exhausted", failures: 4, err: unavailable, expectErr: true, expectListed: 4},
+		{name: "auth failure", failures: 1, err: &googleapi.Error{Code: 403}, expectErr: true, expectListed: 1},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			objectsFunc, listings := flakyObjects(objects, tc.failures, tc.err)
+			driver := gcs{
+				prefix:     "prod/migrations/",
+				migrations: source.NewMigrations(),
+				maxRetries: 3,
+				backoff:    time.Millisecond,
+				objects:    objectsFunc,
+			}
+			err := driver.loadMigrations()
+			if tc.expectErr != (err != nil) {
+				t.Fatalf("unexpected error %v", err)
+			}
+			if *listings != tc.expectListed {
+				t.Errorf("expected %v listings, got %v", tc.expectListed, *listings)
+			}
+			if err == nil && !reflect.DeepEqual(driver.Versions(), []uint{1, 3}) {
+				t.Errorf("expected versions [1 3], got %v", driver.Versions())
+			}
+		})
+	}
+}
+
+// stalledIterator returns objects, then blocks until its context is done,
+// like the iterator of a stalled connection.
+type stalledIterator struct {
+	ctx     context.Context
+	objects []*storage.ObjectAttrs
+}
+
+func (it *stalledIterator) Next() (*storage.ObjectAttrs, error) {
+	if len(it.objects) > 0 {
+		o := it.objects[0]
+		it.objects = it.objects[1:]
+		return o, nil
+	}
+	<-it.ctx.Done()
+	return nil, it.ctx.Err()
+}
+
+func TestListTimeout(t *testing.T) {
+	driver := gcs{
+		bucketName:  "some-bucket",
+		prefix:      "prod/migrations/",
+		migrations:  source.NewMigrations(),
+		maxRetries:  3,
+		backoff:     time.Millisecond,
+		listTimeout: 20 * time.Millisecond,
+		objects: func(ctx context.Context) objectIterator {
+			return &stalledIterator{ctx: ctx, objects: []*storage.ObjectAttrs{
+				{Name: "prod/migrations/1_foobar.up.sql", Size: 4},
+			}}
+		},
+	}
+	start := time.Now()
+	err := driver.loadMigrations()
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected %v, got %v", context.DeadlineExceeded, err)
+	}
+	if !strings.Contains(err.Error(), "gcs://some-bucket/prod/migrations/") {
+		t.Errorf("expected error to name the location, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("expected to give up after the timeout, took %v", elapsed)
+	}
+}
+
+func TestMaxOpen(t *testing.T) {
+	var objects []fakestorage.Object
+	for v := 1; v <= 6; v++ {
+		name := fmt.Sprintf("prod/migrations/%v_foobar.up.sql", v)
+		objects = append(objects, fakestorage.Object{BucketName: "some-bucket", Name: name, Content: []byte("up")})
+	}
+	server := fakestorage.NewServer(objects)
+	defer server.Stop()
+	driver := gcs{
+		bucket:     server.Client().Bucket("some-bucket"),
+		prefix:     "prod/migrations/",
+		migrations: source.NewMigrations(),
+		slots:      make(chan struct{}, 2),
+	}
+	if err := driver.loadMigrations(); err != nil {
+		t.Fatal(err)
+	}
+
+	var (
+		mu        sync.Mutex
+		open, max int
+		wg        sync.WaitGroup
+	)
+	for v := uint(1); v <= 6; v++ {
+		wg.Add(1)
+		go func(version uint) {
+			defer wg.Done()
+			r, _, _, _, err := driver.ReadUp(version)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			mu.Lock()
+			open++
+			if open > max {
+				max = open
+			}
+			mu.Unlock()
+			time.Sleep(10 * time.Millisecond)
+			mu.Lock()
+			open--
+			mu.Unlock()
+			r.Close()
+			// closing twice must not release another slot
+			r.Close()
+		}(v)
+	}
+	wg.Wait()
+	if max > 2 {
+		t.Errorf("expected at most 2 open migrations, got %v", max)
+	}
+
+	// a reader waits until another one is closed
+	first, _, _, _, err := driver.ReadUp(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, _, _, _, err := driver.ReadUp(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer second.Close()
+	opened := make(chan io.ReadCloser)
+	go func() {
+		r, _, _, _, _ := driver.ReadUp(3)
+		opened <- r
+	}()
+	select {
+	case <-opened:
+		t.Fatal("expected the third reader to wait")
+	case <-time.After(50 * time.Millisecond):
+	}
+	first.Close()
+	select {
+	case r := <-opened:
+		r.Close()
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected the third reader to open once the first is closed")
+	}
+}
+
+func TestReadChunks(t *testing.T) {
+	server := fakestorage.NewServer([]fakestorage.Object{
+		{BucketName: "some-bucket", Name: "prod/migrations/1_empty.up.sql", Content: []byte{}},
+		{BucketName: "some-bucket", Name: "prod/migrations/2_partial.up.sql", Content: []byte("0123456789")},
+		{BucketName: "some-bucket", Name: "prod/migrations/3_whole.up.sql", Content: []byte("01234567")},
+	})
+	defer server.Stop()
+
+	for _, chunkSize := range []int64{0, 1, 4, 100} {
+		driver := gcs{
+			bucket:        server.Client().Bucket("some-bucket"),
+			bucketName:    "some-bucket",
+			prefix:        "prod/migrations/",
+			migrations:    source.NewMigrations(),
+			readChunkSize: chunkSize,
+		}
+		if err := driver.loadMigrations(); err != nil {
+			t.Fatal(err)
+		}
+		for version, expected := range map[uint]string{1: "", 2: "0123456789", 3: "01234567"} {
+			r, _, _, _, err := driver.ReadUp(version)
+			if err != nil {
+				t.Fatal(err)
+			}
+			body, err := ioutil.ReadAll(r)
+			r.Close()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(body) != expected {
+				t.Errorf("expected %q for version %v in chunks of %v, got %q", expected, version, chunkSize, body)
+			}
+		}
+
+		// listed, but deleted before it is read
+		driver.migrations.Append(&source.Migration{Version: 4, Direction: source.Up, Identifier: "missing", Raw: "4_missing.up.sql"})
+		if _, _, _, _, err := driver.ReadUp(4); !errors.Is(err, fs.ErrNotExist) {
+			t.Errorf("expected error to wrap %v in chunks of %v, got %v", fs.ErrNotExist, chunkSize, err)
+		}
+	}
+}
+
+func TestErrNotExist(t *testing.T) {
+	server := fakestorage.NewServer([]fakestorage.Object{
+		{BucketName: "some-bucket", Name: "prod/migrations/1_foobar.up.sql", Content: []byte("1 up")},
+		{BucketName: "some-bucket", Name: "prod/migrations/3_foobar.up.sql", Content: []byte("3 up")},
+	})
+	defer server.Stop()
+	driver := gcs{
+		bucket:     server.Client().Bucket("some-bucket"),
+		bucketName: "some-bucket",
+		prefix:     "prod/migrations/",
+		migrations: source.NewMigrations(),
+	}
+	if err := driver.loadMigrations(); err != nil {
+		t.Fatal(err)
+	}
+
+	_, prevErr := driver.Prev(1)
+	_, nextErr := driver.Next(3)
+	_, _, _, _, readErr := driver.ReadDown(3)
+	for _, err := range []error{prevErr, nextErr, readErr} {
+		if !errors.Is(err, fs.ErrNotExist) {
+			t.Errorf("expected error to wrap %v, got %v", fs.ErrNotExist, err)
+		}
+		if !strings.Contains(err.Error(), "gcs://some-bucket/prod/migrations/") {
+			t.Errorf("expected error to name the location, got %v", err)
+		}
+	}
+	if !strings.Contains(nextErr.Error(), "version 3") {
+		t.Errorf("expected error to name the version, got %v", nextErr)
+	}
+
+	empty := gcs{migrations: source.NewMigrations()}
+	if _, err := empty.First(); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("expected error to wrap %v, got %v", fs.ErrNotExist, err)
+	}
+}
+
+func TestIsFunc(t *testing.T) {
+	fn := func(ctx context.Context, db interface{}) error { return nil }
+	source.RegisterFuncMigrationNamed("1_foobar.up.go", fn)
+	defer delete(source.MgrFunctions, "1_foobar.up.go")
+	server := fakestorage.NewServer([]fakestorage.Object{
+		{BucketName: "some-bucket", Name: "prod/migrations/1_foobar.up.go", Content: []byte("package migrations")},
+		{BucketName: "some-bucket", Name: "prod/migrations/2_foobar.up.sql", Content: []byte("2 up")},
+	})
+	defer server.Stop()
+	driver := gcs{
+		bucket:     server.Client().Bucket("some-bucket"),
+		prefix:     "prod/migrations/",
+		migrations: source.NewMigrations(),
+	}
+	if err := driver.loadMigrations(); err != nil {
+		t.Fatal(err)
+	}
+	var fd source.FuncReporter = &driver
+	for _, tc := range []struct {
+		version uint
+		dir     source.Direction
+		isFunc  bool
+	}{
+		{1, source.Up, true},
+		{1, source.Down, false},
+		{2, source.Up, false},
+		{3, source.Up, false},
+	} {
+		if isFunc := fd.IsFunc(tc.version, tc.dir); isFunc != tc.isFunc {
+			t.Errorf("expected IsFunc of %v %v to be %v, got %v", tc.dir, tc.version, tc.isFunc, isFunc)
+		}
+	}
+	// reads agree with IsFunc
+	for _, version := range []uint{1, 2} {
+		r, _, _, fn, err := driver.ReadUp(version)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if isFunc := fn != nil; isFunc != driver.IsFunc(version, source.Up) {
+			t.Errorf("expected ReadUp of version %v to return a function: %v", version, !isFunc)
+		}
+		if r != nil {
+			r.Close()
+		}
+	}
+}
+
+func TestOnSkip(t *testing.T) {
+	objects := []*storage.ObjectAttrs{
+		// listed before the first listing fails
+		{Name: "prod/migrations/README.md", Size: 10},
+		{Prefix: "prod/migrations/archive/"},
+		{Name: "prod/migrations/1_foobar.up.sql", Size: 4},
+		{Name: "prod/migrations/two_foobar.up.sql", Size: 4},
+	}
+	objectsFunc, _ := flakyObjects(objects, 1, &googleapi.Error{Code: 503})
+	skipped := make(map[string]error)
+	driver := gcs{
+		prefix:     "prod/migrations/",
+		migrations: source.NewMigrations(),
+		maxRetries: 3,
+		backoff:    time.Millisecond,
+		objects:    objectsFunc,
+		onSkip: func(path string, err error) {
+			if _, dup := skipped[path]; dup {
+				t.Errorf("%v reported twice", path)
+			}
+			skipped[path] = err
+		},
+	}
+	if err := driver.loadMigrations(); err != nil {
+		t.Fatal(err)
+	}
+	if len(skipped) != 2 {
+		t.Errorf("expected 2 skipped objects, got %v", skipped)
+	}
+	for _, name := range []string{"prod/migrations/README.md", "prod/migrations/two_foobar.up.sql"} {
+		if err, ok := skipped[name]; !ok || !errors.Is(err, source.ErrParse) {
+			t.Errorf("expected %v to be skipped with %v, got %v", name, source.ErrParse, err)
+		}
+	}
+}
+
+func TestWithInstance(t *testing.T) {
+	server := fakestorage.NewServer([]fakestorage.Object{
+		{BucketName: "some-bucket", Name: "prod/migrations/1_foobar.up.sql", Content: []byte("1 up")},
+		{BucketName: "some-bucket", Name: "prod/migrations/1_foobar.down.sql", Content: []byte("1 down")},
+		{BucketName: "some-bucket", Name: "prod/migrations/README.md", Content: []byte("# migrations")},
+		{BucketName: "some-bucket", Name: "prod/migrations/archive/0_foobar.up.sql", Content: []byte("0 up")},
+	})
+	defer server.Stop()
+	var skipped []string
+	d, err := WithInstance(server.Client(), &Config{
+		Bucket: "some-bucket",
+		Prefix: "prod/migrations",
+		OnSkip: func(path string, err error) {
+			skipped = append(skipped, path)
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v, err := d.First(); err != nil || v != 1 {
+		t.Errorf("expected first version 1, got %v, %v", v, err)
+	}
+	// the archive directory is neither read nor reported
+	if expected := []string{"prod/migrations/README.md"}; !reflect.DeepEqual(skipped, expected) {
+		t.Errorf("expected %v to be skipped, got %v", expected, skipped)
+	}
+}
@@ -0,0 +1,335 @@
+// Package grpc provides a source driver that reads migrations from a
+// service implementing the MigrationService of migrationpb over gRPC.
+package grpc
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"io/ioutil"
+	nurl "net/url"
+	"strconv"
+	"strings"
+
+	"github.com/nokia/migrate/v4/source"
+	"github.com/nokia/migrate/v4/source/grpc/migrationpb"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+)
+
+func init() {
+	source.Register("grpc", &GRPC{})
+}
+
+var (
+	ErrNoTarget         = errors.New("no grpc target")
+	ErrAppendPEM        = errors.New("failed to add PEM")
+	ErrTLSCertKeyConfig = errors.New("x-tls-cert and x-tls-key must both be set or both be empty")
+)
+
+type Config struct {
+	// Path names the directory of the service the migrations are listed
+	// in, empty for its root.
+	Path string
+}
+
+type GRPC struct {
+	client     migrationpb.MigrationServiceClient
+	conn       *grpc.ClientConn
+	config     *Config
+	migrations *source.Migrations
+}
+
+// Open is part of source.Driver interface implementation.
+// The URL names the target to dial and the directory of the service, e.g.
+// grpc://migrations.internal:50051/app/prod.
+func (g *GRPC) Open(url string) (source.Driver, error) {
+	u, err := nurl.Parse(url)
+	if err != nil {
+		return nil, err
+	}
+	if len(u.Host) == 0 {
+		return nil, ErrNoTarget
+	}
+	tlsConfig, err := tlsConfig(u.Query())
+	if err != nil {
+		return nil, err
+	}
+	creds := insecure.NewCredentials()
+	if tlsConfig != nil {
+		creds = credentials.NewTLS(tlsConfig)
+	}
+	conn, err := grpc.Dial(u.Host, grpc.WithTransportCredentials(creds))
+	if err != nil {
+		return nil, err
+	}
+	d, err := WithInstance(migrationpb.NewMigrationServiceClient(conn), &Config{Path: strings.TrimPrefix(u.Path, "/")})
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	d.(*GRPC).conn = conn
+	return d, nil
+}
+
+// tlsConfig returns the TLS configuration set by the x-tls options in q,
+// or nil if none is set.
+func tlsConfig(q nurl.Values) (*tls.Config, error) {
+	ca, cert, key := q.Get("x-tls-ca"), q.Get("x-tls-cert"), q.Get("x-tls-key")
+	skipVerify := q.Get("x-tls-insecure-skip-verify")
+	if ca == "" && cert == "" && key == "" && skipVerify == "" {
+		return nil, nil
+	}
+	config := &tls.Config{}
+	if len(ca) > 0 {
+		pem, err := ioutil.ReadFile(ca)
+		if err != nil {
+			return nil, err
+		}
+		config.RootCAs = x509.NewCertPool()
+		if ok := config.RootCAs.AppendCertsFromPEM(pem); !ok {
+			return nil, ErrAppendPEM
+		}
+	}
+	if cert != "" || key != "" {
+		if cert == "" || key == "" {
+			return nil, ErrTLSCertKeyConfig
+		}
+		pair, err := tls.LoadX509KeyPair(cert, key)
+		if err != nil {
+			return nil, err
+		}
+		config.Certificates = []tls.Certificate{pair}
+	}
+	if len(skipVerify) > 0 {
+		x, err := strconv.ParseBool(skipVerify)
+		if err != nil {
+			return nil, fmt.Errorf("unable to parse option x-tls-insecure-skip-verify: %w", err)
+		}
+		config.InsecureSkipVerify = x
+	}
+	return config, nil
+}
+
+// WithInstance returns a driver reading migrations with client. The
+// connection of client is not closed by Close.
+func WithInstance(client migrationpb.MigrationServiceClient, config *Config) (source.Driver, error) {
+	g := &GRPC{
+		client:     client,
+		config:     config,
+		migrations: source.NewMigrations(),
+	}
+	if err := g.loadMigrations(); err != nil {
+		return nil, err
+	}
+	return g, nil
+}
+
+func (g *GRPC) loadMigrations() error {
+	resp, err := g.client.ListMigrations(context.TODO(), &migrationpb.ListMigrationsRequest{Path: g.config.Path})
+	if err != nil {
+		return fmt.Errorf("unable to list %v: %w", g.location(), err)
+	}
+	for _, name := range resp.Names {
+		m, err := source.DefaultParse(name)
+		if errors.Is(err, source.ErrParse) {
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("unable to parse file %v: %w", name, err)
+		}
+		m.Raw = name
+		if err := g.migrations.AppendErr(m); err != nil {
+			return fmt.Errorf("unable to load %v: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// location names the directory of the service in errors.
+func (g *GRPC) location() string {
+	return "grpc " + g.config.Path
+}
+
+// Close is part of source.Driver interface implementation.
+// The connection is only closed if the driver was created by Open.
+func (g *GRPC) Close() error {
+	if g.conn == nil {
+		return nil
+	}
+	return g.conn.Close()
+}
+
+func (g *GRPC) First() (uint, error) {
+	v, ok := g.migrations.First()
+	if !ok {
+		return 0, g.errNotExist("first")
+	}
+	return v, nil
+}
+
+func (g *GRPC) Prev(version uint) (uint, error) {
+	v, ok := g.migrations.Prev(version)
+	if !ok {
+		return 0, g.errNotExist("prev for version " + strconv.FormatUint(uint64(version), 10))
+	}
+	return v, nil
+}
+
+func (g *GRPC) Next(version uint) (uint, error) {
+	v, ok := g.migrations.Next(version)
+	if !ok {
+		return 0, g.errNotExist("next for version " + strconv.FormatUint(uint64(version), 10))
+	}
+	return v, nil
+}
+
+func (g *GRPC) ReadUp(version uint) (io.ReadCloser, string, string, source.MigrationFunc, error) {
+	if m, ok := g.migrations.Up(version); ok {
+		return g.read(m)
+	}
+	return nil, "", "", nil, g.errNotExist("read up for version " + strconv.FormatUint(uint64(version), 10))
+}
+
+func (g *GRPC) ReadDown(version uint) (io.ReadCloser, string, string, source.MigrationFunc, error) {
+	if m, ok := g.migrations.Down(version); ok {
+		return g.read(m)
+	}
+	return nil, "", "", nil, g.errNotExist("read down for version " + strconv.FormatUint(uint64(version), 10))
+}
+
+// read streams the body of m from the service. The first chunk is
+// received right away, so a file that is gone is reported by ReadUp and
+// ReadDown rather than by the first Read.
+func (g *GRPC) read(m *source.Migration) (io.ReadCloser, string, string, source.MigrationFunc, error) {
+	ctx, cancel := context.WithCancel(context.TODO())
+	stream, err := g.client.GetMigration(ctx, &migrationpb.GetMigrationRequest{Path: g.config.Path, Name: m.Raw})
+	if err != nil {
+		cancel()
+		return nil, "", "", nil, g.readErr(m, err)
+	}
+	r := &streamReader{stream: stream, cancel: cancel}
+	if err := r.recv(); err != nil && err != io.EOF {
+		cancel()
+		return nil, "", "", nil, g.readErr(m, err)
+	}
+	return r, m.Identifier, m.Raw, nil, nil
+}
+
+// readErr returns the error of reading m, wrapping fs.ErrNotExist if the
+// service reported the file as not found.
+func (g *GRPC) readErr(m *source.Migration, err error) error {
+	if status.Code(err) == codes.NotFound {
+		return &fs.PathError{Op: "read", Path: m.Raw, Err: fs.ErrNotExist}
+	}
+	return fmt.Errorf("unable to read %v: %w", m.Raw, err)
+}
+
+// errNotExist returns an error wrapping fs.ErrNotExist for op on the
+// directory of the service, like the iofs driver does.
+func (g *GRPC) errNotExist(op string) error {
+	return &fs.PathError{
+		Op:   op,
+		Path: g.location(),
+		Err:  fs.ErrNotExist,
+	}
+}
+
+// streamReader reads the chunks of a GetMigration stream.
+type streamReader struct {
+	stream migrationpb.MigrationService_GetMigrationClient
+	cancel context.CancelFunc
+	chunk  []byte
+	err    error
+}
+
+// recv receives the next chunk, it returns io.EOF at the end of the
+// stream.
+func (r *streamReader) recv() error {
+	resp, err := r.stream.Recv()
+	if err != nil {
+		r.err = err
+		return err
+	}
+	r.chunk = resp.Chunk
+	return nil
+}
+
+func (r *streamReader) Read(p []byte) (int, error) {
+	for len(r.chunk) == 0 {
+		if r.err != nil {
+			return 0, r.err
+		}
+		r.recv()
+	}
+	n := copy(p, r.chunk)
+	r.chunk = r.chunk[n:]
+	return n, nil
+}
+
+// Close cancels the stream, it may be called before the body was read to
+// the end.
+func (r *streamReader) Close() error {
+	r.cancel()
+	return nil
+}
+
+func (g *GRPC) MarkSkipMigrations(version uint, dir source.Direction) {
+	g.migrations.MarkSkipMigrations(version, dir)
+}
+
+func (g *GRPC) UpdateStatus(version uint, status source.Status, errstr string) {
+	g.migrations.UpdateStatus(version, status, errstr)
+}
+
+// UpdateStatusDir is like UpdateStatus, but only updates the migration of
+// direction dir.
+func (g *GRPC) UpdateStatusDir(version uint, dir source.Direction, status source.Status, errstr string) {
+	g.migrations.UpdateStatusDir(version, dir, status, errstr)
+}
+
+func (g *GRPC) PrintSummary(dir source.Direction) {
+	g.migrations.PrintSummary(dir)
+}
+
+// Versions returns all versions available to the driver in ascending order.
+func (g *GRPC) Versions() []uint {
+	return g.migrations.Versions()
+}
+
+// Identifier returns the identifier of the migration of version in
+// direction dir without reading it.
+func (g *GRPC) Identifier(version uint, dir source.Direction) (string, bool) {
+	return g.migrations.Identifier(version, dir)
+}
+
+// FindByIdentifier returns a copy of the first migration in direction dir
+// named identifier, see source.Migrations.FindByIdentifier.
+func (g *GRPC) FindByIdentifier(identifier string, dir source.Direction) (*source.Migration, bool) {
+	return g.migrations.FindByIdentifier(identifier, dir)
+}
+
+// FindByIdentifierFold is like FindByIdentifier, but matches identifier
+// case insensitively.
+func (g *GRPC) FindByIdentifierFold(identifier string, dir source.Direction) (*source.Migration, bool) {
+	return g.migrations.FindByIdentifierFold(identifier, dir)
+}
+
+// Walk calls fn with a copy of each migration of direction dir in the
+// order they would be applied, see source.Migrations.Walk.
+func (g *GRPC) Walk(dir source.Direction, fn func(m *source.Migration) error) error {
+	return g.migrations.Walk(dir, fn)
+}
+
+// Validate checks that every version has an up and a down migration, or
+// only an up migration if downOptional is set, see source.Migrations.Validate.
+func (g *GRPC) Validate(downOptional bool) error {
+	return g.migrations.Validate(downOptional)
+}
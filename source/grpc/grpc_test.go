@@ -0,0 +1,199 @@
+package grpc
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"io/ioutil"
+	"net"
+	"sort"
+	"testing"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+
+	"github.com/nokia/migrate/v4/source/grpc/migrationpb"
+	st "github.com/nokia/migrate/v4/source/testing"
+)
+
+func Test(t *testing.T) {
+	client := startServer(t, map[string]map[string]string{
+		"prod": {
+			"1_foobar.up.sql":   "1 up",
+			"1_foobar.down.sql": "1 down",
+			"3_foobar.up.sql":   "3 up",
+			"4_foobar.up.sql":   "4 up",
+			"4_foobar.down.sql": "4 down",
+			"5_foobar.down.sql": "5 down",
+			"7_foobar.up.sql":   "7 up",
+			"7_foobar.down.sql": "7 down",
+			"not-a-migration":   "",
+		},
+		"staging": {
+			"2_foobar.up.sql": "2 up",
+		},
+	})
+	d, err := WithInstance(client, &Config{Path: "prod"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+	st.Test(t, d)
+}
+
+func TestReadContent(t *testing.T) {
+	client := startServer(t, map[string]map[string]string{
+		"": {
+			"10_add_index.up.sql":     "CREATE INDEX ...;",
+			"2_create_users.up.sql":   "CREATE TABLE users ();",
+			"2_create_users.down.sql": "DROP TABLE users;",
+		},
+	})
+	d, err := WithInstance(client, &Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+
+	var versions []uint
+	for v, err := d.First(); err == nil; v, err = d.Next(v) {
+		versions = append(versions, v)
+	}
+	if len(versions) != 2 || versions[0] != 2 || versions[1] != 10 {
+		t.Errorf("expected versions [2 10], got %v", versions)
+	}
+
+	// the bodies are streamed in chunks of chunkSize bytes
+	r, identifier, location, fn, err := d.ReadUp(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	body, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(body) != "CREATE TABLE users ();" || identifier != "create_users" || location != "2_create_users.up.sql" || fn != nil {
+		t.Errorf("unexpected read %q, %q, %q, %v", body, identifier, location, fn)
+	}
+
+	// a body closed before its end
+	r, _, _, _, err = d.ReadDown(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Close(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestReadNotFound(t *testing.T) {
+	files := map[string]map[string]string{
+		"": {"1_foobar.up.sql": "1 up"},
+	}
+	d, err := WithInstance(startServer(t, files), &Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	delete(files[""], "1_foobar.up.sql")
+	if _, _, _, _, err := d.ReadUp(1); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("expected %v, got %v", fs.ErrNotExist, err)
+	}
+}
+
+func TestListError(t *testing.T) {
+	if _, err := WithInstance(startServer(t, nil), &Config{Path: "missing"}); status.Code(errors.Unwrap(err)) != codes.NotFound {
+		t.Errorf("expected listing to fail with %v, got %v", codes.NotFound, err)
+	}
+}
+
+func TestOpen(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	serve(t, l, map[string]map[string]string{
+		"app/prod": {"1_foobar.up.sql": "1 up"},
+	})
+	d, err := (&GRPC{}).Open("grpc://" + l.Addr().String() + "/app/prod")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+	if v, err := d.First(); err != nil || v != 1 {
+		t.Errorf("expected first version 1, got %v, %v", v, err)
+	}
+
+	if _, err := (&GRPC{}).Open("grpc:///app/prod"); !errors.Is(err, ErrNoTarget) {
+		t.Errorf("expected %v, got %v", ErrNoTarget, err)
+	}
+	if _, err := (&GRPC{}).Open("grpc://" + l.Addr().String() + "/app/prod?x-tls-cert=cert.pem"); !errors.Is(err, ErrTLSCertKeyConfig) {
+		t.Errorf("expected %v, got %v", ErrTLSCertKeyConfig, err)
+	}
+}
+
+// chunkSize is the size of the chunks fakeServer streams bodies in.
+const chunkSize = 4
+
+// fakeServer serves files by directory and name.
+type fakeServer struct {
+	migrationpb.UnimplementedMigrationServiceServer
+	files map[string]map[string]string
+}
+
+func (s *fakeServer) ListMigrations(ctx context.Context, req *migrationpb.ListMigrationsRequest) (*migrationpb.ListMigrationsResponse, error) {
+	dir, ok := s.files[req.Path]
+	if !ok {
+		return nil, status.Errorf(codes.NotFound, "no directory %v", req.Path)
+	}
+	resp := &migrationpb.ListMigrationsResponse{}
+	for name := range dir {
+		resp.Names = append(resp.Names, name)
+	}
+	sort.Strings(resp.Names)
+	return resp, nil
+}
+
+func (s *fakeServer) GetMigration(req *migrationpb.GetMigrationRequest, stream migrationpb.MigrationService_GetMigrationServer) error {
+	body, ok := s.files[req.Path][req.Name]
+	if !ok {
+		return status.Errorf(codes.NotFound, "no file %v", req.Name)
+	}
+	for len(body) > 0 {
+		n := chunkSize
+		if n > len(body) {
+			n = len(body)
+		}
+		if err := stream.Send(&migrationpb.GetMigrationResponse{Chunk: []byte(body[:n])}); err != nil {
+			return err
+		}
+		body = body[n:]
+	}
+	return nil
+}
+
+// serve serves files on l until the test ends.
+func serve(t *testing.T, l net.Listener, files map[string]map[string]string) {
+	server := grpc.NewServer()
+	migrationpb.RegisterMigrationServiceServer(server, &fakeServer{files: files})
+	go server.Serve(l)
+	t.Cleanup(server.Stop)
+}
+
+// startServer serves files in-process and returns a client connected to
+// it.
+func startServer(t *testing.T, files map[string]map[string]string) migrationpb.MigrationServiceClient {
+	l := bufconn.Listen(1 << 20)
+	serve(t, l, files)
+	conn, err := grpc.Dial("bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return l.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return migrationpb.NewMigrationServiceClient(conn)
+}
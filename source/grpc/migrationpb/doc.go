@@ -0,0 +1,5 @@
+// Package migrationpb holds the protocol of the services the grpc source
+// driver reads migrations from, generated from migration.proto.
+package migrationpb
+
+//go:generate protoc --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative migration.proto
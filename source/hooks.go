@@ -0,0 +1,73 @@
+package source
+
+import (
+	"context"
+	"fmt"
+)
+
+// SetPreHook sets fn to run once before the first migration of a batch,
+// e.g. to disable triggers. Unlike go migrations it belongs to no version.
+// A nil fn removes the hook. See RunWithHooks.
+func (i *Migrations) SetPreHook(fn MigrationFunc) {
+	i.preHook = fn
+}
+
+// SetPostHook sets fn to run once after the last migration of a batch,
+// e.g. to enable triggers again. It runs even if a migration failed, the
+// failure is available to fn with RunError. A nil fn removes the hook.
+// See RunWithHooks.
+func (i *Migrations) SetPostHook(fn MigrationFunc) {
+	i.postHook = fn
+}
+
+// PreHook returns the hook set by SetPreHook, nil if there is none.
+func (i *Migrations) PreHook() MigrationFunc {
+	return i.preHook
+}
+
+// PostHook returns the hook set by SetPostHook, nil if there is none.
+func (i *Migrations) PostHook() MigrationFunc {
+	return i.postHook
+}
+
+// runErrKey is the context key of the error passed to the post hook.
+type runErrKey struct{}
+
+// WithRunError returns a copy of ctx carrying err, the failure of a batch
+// of migrations, for the post hook. RunWithHooks calls it, runners
+// invoking the hooks themselves should too.
+func WithRunError(ctx context.Context, err error) context.Context {
+	return context.WithValue(ctx, runErrKey{}, err)
+}
+
+// RunError returns the error a batch of migrations failed with, as passed
+// to the post hook, or nil if the batch succeeded.
+func RunError(ctx context.Context) error {
+	err, _ := ctx.Value(runErrKey{}).(error)
+	return err
+}
+
+// RunWithHooks runs the pre hook, then run, then the post hook, each with
+// db. run is not called if the pre hook fails. The post hook runs even if
+// run failed, with the error of run available by RunError of its context.
+// The error of run is returned, annotated with the error of the post hook
+// if both failed.
+func (i *Migrations) RunWithHooks(ctx context.Context, db interface{}, run func() error) error {
+	if i.preHook != nil {
+		if err := i.preHook(ctx, db); err != nil {
+			return fmt.Errorf("pre hook failed: %w", err)
+		}
+	}
+	err := run()
+	if i.postHook == nil {
+		return err
+	}
+	postErr := i.postHook(WithRunError(ctx, err), db)
+	switch {
+	case postErr == nil:
+		return err
+	case err == nil:
+		return fmt.Errorf("post hook failed: %w", postErr)
+	}
+	return fmt.Errorf("%w (post hook failed: %v)", err, postErr)
+}
@@ -0,0 +1,86 @@
+package source
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestHooks(t *testing.T) {
+	i := NewMigrations()
+	if i.PreHook() != nil || i.PostHook() != nil {
+		t.Fatal("expected no hooks by default")
+	}
+
+	var calls []string
+	var postRunErr error
+	i.SetPreHook(func(ctx context.Context, db interface{}) error {
+		calls = append(calls, "pre "+db.(string))
+		return nil
+	})
+	i.SetPostHook(func(ctx context.Context, db interface{}) error {
+		calls = append(calls, "post "+db.(string))
+		postRunErr = RunError(ctx)
+		return nil
+	})
+	if i.PreHook() == nil || i.PostHook() == nil {
+		t.Fatal("expected hooks to be set")
+	}
+	if c := i.Clone(); c.PreHook() == nil || c.PostHook() == nil {
+		t.Error("expected Clone to keep the hooks")
+	}
+
+	err := i.RunWithHooks(context.Background(), "db", func() error {
+		calls = append(calls, "run")
+		return nil
+	})
+	if err != nil || postRunErr != nil {
+		t.Errorf("expected success, got %v, %v", err, postRunErr)
+	}
+	if expected := []string{"pre db", "run", "post db"}; !reflect.DeepEqual(calls, expected) {
+		t.Errorf("expected %v, got %v", expected, calls)
+	}
+
+	// the post hook runs after a failed migration and sees the failure
+	calls = nil
+	errRun := errors.New("migration 2 failed")
+	err = i.RunWithHooks(context.Background(), "db", func() error {
+		calls = append(calls, "run")
+		return errRun
+	})
+	if !errors.Is(err, errRun) || !errors.Is(postRunErr, errRun) {
+		t.Errorf("expected %v, got %v, %v", errRun, err, postRunErr)
+	}
+	if expected := []string{"pre db", "run", "post db"}; !reflect.DeepEqual(calls, expected) {
+		t.Errorf("expected %v, got %v", expected, calls)
+	}
+
+	errPost := errors.New("enable triggers")
+	i.SetPostHook(func(ctx context.Context, db interface{}) error { return errPost })
+	err = i.RunWithHooks(context.Background(), "db", func() error { return errRun })
+	if !errors.Is(err, errRun) || !strings.Contains(err.Error(), "post hook failed: enable triggers") {
+		t.Errorf("expected both errors, got %v", err)
+	}
+	err = i.RunWithHooks(context.Background(), "db", func() error { return nil })
+	if !errors.Is(err, errPost) {
+		t.Errorf("expected %v, got %v", errPost, err)
+	}
+
+	// nothing runs after a failed pre hook
+	errPre := errors.New("disable triggers")
+	i.SetPreHook(func(ctx context.Context, db interface{}) error { return errPre })
+	i.SetPostHook(nil)
+	ran := false
+	err = i.RunWithHooks(context.Background(), "db", func() error {
+		ran = true
+		return nil
+	})
+	if !errors.Is(err, errPre) || ran {
+		t.Errorf("expected the pre hook to stop the run, got %v, ran %v", err, ran)
+	}
+	if i.PostHook() != nil {
+		t.Error("expected nil to remove the post hook")
+	}
+}
@@ -0,0 +1,239 @@
+// Package http provides a source driver that fetches migrations from a
+// plain HTTP(S) server. The server lists the available migration files in
+// a manifest, either one file name per line or as a JSON array of file
+// names. Files are fetched relative to the base URL when they are read.
+package http
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	nethttp "net/http"
+	nurl "net/url"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/nokia/migrate/v4/source"
+)
+
+func init() {
+	source.Register("http", &HTTP{})
+	source.Register("https", &HTTP{})
+}
+
+var (
+	// DefaultManifestPath is the path of the manifest relative to the base URL.
+	DefaultManifestPath = "manifest"
+	// DefaultTimeout is the time limit for each request, including reading
+	// the response body.
+	DefaultTimeout = 30 * time.Second
+)
+
+type Config struct {
+	// BaseURL is the URL the manifest and migration files are relative to.
+	BaseURL string
+	// ManifestPath defaults to DefaultManifestPath.
+	ManifestPath string
+}
+
+type HTTP struct {
+	client     *nethttp.Client
+	config     *Config
+	migrations *source.Migrations
+}
+
+// Open is part of source.Driver interface implementation.
+// The driver specific x-manifest and x-timeout query parameters are
+// removed from the URL before it is used as base URL.
+func (h *HTTP) Open(url string) (source.Driver, error) {
+	u, err := nurl.Parse(url)
+	if err != nil {
+		return nil, err
+	}
+	q := u.Query()
+
+	timeout := DefaultTimeout
+	if s := q.Get("x-timeout"); len(s) > 0 {
+		timeout, err = time.ParseDuration(s)
+		if err != nil {
+			return nil, fmt.Errorf("unable to parse option x-timeout: %w", err)
+		}
+	}
+	config := &Config{ManifestPath: q.Get("x-manifest")}
+
+	q.Del("x-manifest")
+	q.Del("x-timeout")
+	u.RawQuery = q.Encode()
+	config.BaseURL = u.String()
+
+	return WithInstance(&nethttp.Client{Timeout: timeout}, config)
+}
+
+// WithInstance returns a driver fetching migrations with client.
+func WithInstance(client *nethttp.Client, config *Config) (source.Driver, error) {
+	if config.ManifestPath == "" {
+		config.ManifestPath = DefaultManifestPath
+	}
+	h := &HTTP{
+		client:     client,
+		config:     config,
+		migrations: source.NewMigrations(),
+	}
+	if err := h.loadMigrations(); err != nil {
+		return nil, err
+	}
+	return h, nil
+}
+
+func (h *HTTP) url(name string) (string, error) {
+	u, err := nurl.Parse(h.config.BaseURL)
+	if err != nil {
+		return "", err
+	}
+	u.Path = path.Join("/", u.Path, name)
+	return u.String(), nil
+}
+
+func (h *HTTP) get(name string) (io.ReadCloser, error) {
+	u, err := h.url(name)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := h.client.Get(u)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != nethttp.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("GET %v: unexpected status %v", u, resp.Status)
+	}
+	return resp.Body, nil
+}
+
+func (h *HTTP) loadMigrations() error {
+	body, err := h.get(h.config.ManifestPath)
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+	manifest, err := ioutil.ReadAll(body)
+	if err != nil {
+		return err
+	}
+	files, err := parseManifest(manifest)
+	if err != nil {
+		return fmt.Errorf("unable to parse manifest %v: %w", h.config.ManifestPath, err)
+	}
+
+	for _, file := range files {
+		m, err := source.DefaultParse(path.Base(file))
+		if err != nil {
+			continue // ignore files that we can't parse
+		}
+		m.Raw = file
+		if err := h.migrations.AppendErr(m); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// parseManifest returns the file names listed in a manifest. A manifest is
+// either a JSON array of names or holds one name per line, where empty
+// lines and lines starting with # are ignored.
+func parseManifest(manifest []byte) ([]string, error) {
+	manifest = bytes.TrimSpace(manifest)
+	if bytes.HasPrefix(manifest, []byte("[")) {
+		var files []string
+		if err := json.Unmarshal(manifest, &files); err != nil {
+			return nil, err
+		}
+		return files, nil
+	}
+
+	var files []string
+	for _, line := range strings.Split(string(manifest), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		files = append(files, line)
+	}
+	return files, nil
+}
+
+// Close is part of source.Driver interface implementation.
+func (h *HTTP) Close() error {
+	h.client.CloseIdleConnections()
+	return nil
+}
+
+// First is part of source.Driver interface implementation.
+func (h *HTTP) First() (version uint, err error) {
+	if v, ok := h.migrations.First(); ok {
+		return v, nil
+	}
+	return 0, &os.PathError{Op: "first", Path: h.config.BaseURL, Err: os.ErrNotExist}
+}
+
+// Prev is part of source.Driver interface implementation.
+func (h *HTTP) Prev(version uint) (prevVersion uint, err error) {
+	if v, ok := h.migrations.Prev(version); ok {
+		return v, nil
+	}
+	return 0, &os.PathError{Op: fmt.Sprintf("prev for version %v", version), Path: h.config.BaseURL, Err: os.ErrNotExist}
+}
+
+// Next is part of source.Driver interface implementation.
+func (h *HTTP) Next(version uint) (nextVersion uint, err error) {
+	if v, ok := h.migrations.Next(version); ok {
+		return v, nil
+	}
+	return 0, &os.PathError{Op: fmt.Sprintf("next for version %v", version), Path: h.config.BaseURL, Err: os.ErrNotExist}
+}
+
+// ReadUp is part of source.Driver interface implementation.
+func (h *HTTP) ReadUp(version uint) (r io.ReadCloser, identifier string, location string, fn source.MigrationFunc, err error) {
+	if m, ok := h.migrations.Up(version); ok {
+		return h.open(m)
+	}
+	return nil, "", "", nil, &os.PathError{Op: fmt.Sprintf("read up for version %v", version), Path: h.config.BaseURL, Err: os.ErrNotExist}
+}
+
+// ReadDown is part of source.Driver interface implementation.
+func (h *HTTP) ReadDown(version uint) (r io.ReadCloser, identifier string, location string, fn source.MigrationFunc, err error) {
+	if m, ok := h.migrations.Down(version); ok {
+		return h.open(m)
+	}
+	return nil, "", "", nil, &os.PathError{Op: fmt.Sprintf("read down for version %v", version), Path: h.config.BaseURL, Err: os.ErrNotExist}
+}
+
+func (h *HTTP) open(m *source.Migration) (io.ReadCloser, string, string, source.MigrationFunc, error) {
+	body, err := h.get(m.Raw)
+	if err != nil {
+		return nil, "", "", nil, err
+	}
+	return body, m.Identifier, m.Raw, nil, nil
+}
+
+func (h *HTTP) MarkSkipMigrations(version uint, dir source.Direction) {
+	h.migrations.MarkSkipMigrations(version, dir)
+}
+
+func (h *HTTP) UpdateStatus(version uint, status source.Status, errstr string) {
+	h.migrations.UpdateStatus(version, status, errstr)
+}
+
+// UpdateStatusDir is like UpdateStatus, but only updates the migration of
+// direction dir.
+func (h *HTTP) UpdateStatusDir(version uint, dir source.Direction, status source.Status, errstr string) {
+	h.migrations.UpdateStatusDir(version, dir, status, errstr)
+}
+
+func (h *HTTP) PrintSummary(dir source.Direction) {
+	h.migrations.PrintSummary(dir)
+}
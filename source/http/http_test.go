@@ -0,0 +1,112 @@
+package http
+
+import (
+	"io/ioutil"
+	nethttp "net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	st "github.com/nokia/migrate/v4/source/testing"
+)
+
+var files = map[string]string{
+	"/migrations/1_foobar.up.sql":   "1 up",
+	"/migrations/1_foobar.down.sql": "1 down",
+	"/migrations/3_foobar.up.sql":   "3 up",
+	"/migrations/4_foobar.up.sql":   "4 up",
+	"/migrations/4_foobar.down.sql": "4 down",
+	"/migrations/5_foobar.down.sql": "5 down",
+	"/migrations/7_foobar.up.sql":   "7 up",
+	"/migrations/7_foobar.down.sql": "7 down",
+}
+
+func newServer(manifestPath, manifest string, delay time.Duration) *httptest.Server {
+	return httptest.NewServer(nethttp.HandlerFunc(func(w nethttp.ResponseWriter, r *nethttp.Request) {
+		time.Sleep(delay)
+		if r.URL.Path == manifestPath {
+			_, _ = w.Write([]byte(manifest))
+			return
+		}
+		body, ok := files[r.URL.Path]
+		if !ok {
+			nethttp.NotFound(w, r)
+			return
+		}
+		_, _ = w.Write([]byte(body))
+	}))
+}
+
+func Test(t *testing.T) {
+	manifest := `
+# migrations
+1_foobar.up.sql
+1_foobar.down.sql
+3_foobar.up.sql
+4_foobar.up.sql
+4_foobar.down.sql
+5_foobar.down.sql
+7_foobar.up.sql
+7_foobar.down.sql
+README.md
+`
+	ts := newServer("/migrations/manifest", manifest, 0)
+	defer ts.Close()
+
+	d, err := (&HTTP{}).Open(ts.URL + "/migrations")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+	st.Test(t, d)
+}
+
+func TestJSONManifest(t *testing.T) {
+	manifest := `["1_foobar.up.sql", "1_foobar.down.sql", "3_foobar.up.sql"]`
+	ts := newServer("/migrations/index.json", manifest, 0)
+	defer ts.Close()
+
+	d, err := (&HTTP{}).Open(ts.URL + "/migrations?x-manifest=index.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+
+	for version, expected := range map[uint]string{1: "1 down"} {
+		r, _, _, _, err := d.ReadDown(version)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, err := ioutil.ReadAll(r)
+		r.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(body) != expected {
+			t.Errorf("expected %q, got %q", expected, body)
+		}
+	}
+	if next, err := d.Next(1); err != nil || next != 3 {
+		t.Errorf("expected next version 3, got %v, %v", next, err)
+	}
+}
+
+func TestMissingManifest(t *testing.T) {
+	ts := newServer("/migrations/manifest", "", 0)
+	defer ts.Close()
+
+	_, err := (&HTTP{}).Open(ts.URL + "/other")
+	if err == nil || !strings.Contains(err.Error(), "404") {
+		t.Errorf("expected not found error, got %v", err)
+	}
+}
+
+func TestTimeout(t *testing.T) {
+	ts := newServer("/migrations/manifest", "1_foobar.up.sql", 200*time.Millisecond)
+	defer ts.Close()
+
+	if _, err := (&HTTP{}).Open(ts.URL + "/migrations?x-timeout=20ms"); err == nil {
+		t.Error("expected timeout error")
+	}
+}
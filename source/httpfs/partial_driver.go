@@ -50,12 +50,14 @@ func (p *PartialDriver) Init(fs http.FileSystem, path string) error {
 		if err != nil {
 			continue // ignore files that we can't parse
 		}
+		m.ModTime = file.ModTime()
 
-		if !ms.Append(m) {
-			return source.ErrDuplicateMigration{
-				Migration: *m,
-				FileInfo:  file,
+		if err := ms.AppendErr(m); err != nil {
+			if dup, ok := err.(source.ErrDuplicateMigration); ok {
+				dup.FileInfo = file
+				return dup
 			}
+			return err
 		}
 	}
 
@@ -163,6 +165,12 @@ func (d *PartialDriver) UpdateStatus(version uint, status source.Status, errstr
 	d.migrations.UpdateStatus(version, status, errstr)
 }
 
+// UpdateStatusDir is like UpdateStatus, but only updates the migration of
+// direction dir.
+func (d *PartialDriver) UpdateStatusDir(version uint, dir source.Direction, status source.Status, errstr string) {
+	d.migrations.UpdateStatusDir(version, dir, status, errstr)
+}
+
 func (d *PartialDriver) PrintSummary(dir source.Direction) {
 	d.migrations.PrintSummary(dir)
 }
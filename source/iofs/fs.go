@@ -0,0 +1,128 @@
+//go:build go1.16
+// +build go1.16
+
+package iofs
+
+import (
+	"io"
+	"io/fs"
+	"path"
+	"strings"
+)
+
+// FS returns a read only view of the driver's file system that contains
+// only the recognized migration files. Names are relative to the path the
+// driver was initialized with.
+func (d *PartialDriver) FS() fs.FS {
+	mfs := &migrationFS{
+		files: make(map[string]bool),
+		dirs:  map[string]bool{".": true},
+	}
+	sub, err := fs.Sub(d.fsys, d.path)
+	if err != nil {
+		// d.path was already walked successfully in Init.
+		sub = d.fsys
+	}
+	mfs.fsys = sub
+
+	for version, ok := d.migrations.First(); ok; version, ok = d.migrations.Next(version) {
+		if m, ok := d.migrations.Up(version); ok {
+			mfs.add(d.relative(m.Raw))
+		}
+		if m, ok := d.migrations.Down(version); ok {
+			mfs.add(d.relative(m.Raw))
+		}
+	}
+	return mfs
+}
+
+func (d *PartialDriver) relative(raw string) string {
+	if d.stripped != "" || d.path == "." || d.path == "" {
+		return raw
+	}
+	return strings.TrimPrefix(raw, d.path+"/")
+}
+
+// migrationFS filters an fs.FS down to a set of files and their parent
+// directories.
+type migrationFS struct {
+	fsys  fs.FS
+	files map[string]bool
+	dirs  map[string]bool
+}
+
+func (f *migrationFS) add(name string) {
+	f.files[name] = true
+	for dir := path.Dir(name); dir != "."; dir = path.Dir(dir) {
+		f.dirs[dir] = true
+	}
+}
+
+func (f *migrationFS) has(name string) bool {
+	return f.files[name] || f.dirs[name]
+}
+
+// Open implements fs.FS.
+func (f *migrationFS) Open(name string) (fs.File, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrInvalid}
+	}
+	if !f.has(name) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	}
+	file, err := f.fsys.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	if f.files[name] {
+		return file, nil
+	}
+	entries, err := f.ReadDir(name)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	return &migrationDir{File: file, entries: entries}, nil
+}
+
+// ReadDir implements fs.ReadDirFS.
+func (f *migrationFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	if !f.dirs[name] {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: fs.ErrNotExist}
+	}
+	entries, err := fs.ReadDir(f.fsys, name)
+	if err != nil {
+		return nil, err
+	}
+	filtered := entries[:0]
+	for _, e := range entries {
+		if f.has(path.Join(name, e.Name())) {
+			filtered = append(filtered, e)
+		}
+	}
+	return filtered, nil
+}
+
+// migrationDir is a directory of a migrationFS, listing filtered entries.
+type migrationDir struct {
+	fs.File
+	entries []fs.DirEntry
+	offset  int
+}
+
+// ReadDir implements fs.ReadDirFile.
+func (d *migrationDir) ReadDir(n int) ([]fs.DirEntry, error) {
+	rest := d.entries[d.offset:]
+	if n <= 0 {
+		d.offset = len(d.entries)
+		return rest, nil
+	}
+	if len(rest) == 0 {
+		return nil, io.EOF
+	}
+	if n > len(rest) {
+		n = len(rest)
+	}
+	d.offset += n
+	return rest[:n], nil
+}
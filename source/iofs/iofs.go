@@ -4,12 +4,16 @@
 package iofs
 
 import (
+	"bytes"
+	"context"
 	"errors"
 	"fmt"
 	"io"
 	"io/fs"
-	"path/filepath"
+	pathpkg "path"
+	"reflect"
 	"strconv"
+	"strings"
 
 	"github.com/nokia/migrate/v4/source"
 )
@@ -20,8 +24,26 @@ type driver struct {
 
 // New returns a new Driver from io/fs#FS and a relative path.
 func New(fsys fs.FS, path string) (source.Driver, error) {
+	return NewWithParser(fsys, path, source.DefaultParse)
+}
+
+// NewWithParser returns a new Driver from io/fs#FS and a relative path,
+// recognizing migration files with parse instead of source.DefaultParse.
+func NewWithParser(fsys fs.FS, path string, parse source.Parser) (source.Driver, error) {
 	var i driver
-	if err := i.Init(fsys, path); err != nil {
+	if err := i.InitWithParser(fsys, path, parse); err != nil {
+		return nil, fmt.Errorf("failed to init driver with path %s: %w", path, err)
+	}
+	return &i, nil
+}
+
+// NewVersionDirs returns a new Driver from io/fs#FS and a relative path,
+// for migrations laid out in a directory per version like 0001/up.sql and
+// 0001/down.sql, see source.ParseVersionDir. Go migration functions are
+// registered by file name, so they are not supported in this layout.
+func NewVersionDirs(fsys fs.FS, path string) (source.Driver, error) {
+	var i driver
+	if err := i.InitVersionDirs(fsys, path); err != nil {
 		return nil, fmt.Errorf("failed to init driver with path %s: %w", path, err)
 	}
 	return &i, nil
@@ -40,48 +62,323 @@ func (d *driver) Open(url string) (source.Driver, error) {
 //
 // To prepare PartialDriver for use Init() function.
 type PartialDriver struct {
+	// OnSkip, if set before Init, is called with the path of each file
+	// that is left out because its name doesn't parse as a migration.
+	// Files matching Ignored are not reported.
+	OnSkip func(path string, err error)
+
+	// CountBytes makes ReadUp and ReadDown record the number of bytes read
+	// from a migration in its Bytes once the body is closed, as reported by
+	// SummaryJSON, see source.CountBytes.
+	CountBytes bool
+
+	// Combined, if set before Init, makes Init also read files named like
+	// 1_create_users.sql holding both directions, separated by
+	// source.UpMarker and source.DownMarker. ReadUp and ReadDown return the
+	// section of the direction, a file without a down section has no down
+	// migration. See source.ParseCombined.
+	Combined bool
+
+	// StripPath, if set before Init, makes Init record the Raw path of
+	// each migration relative to the path it was given, e.g. 1_init.up.sql
+	// instead of internal/db/migrations/1_init.up.sql, so summaries and
+	// locations are short. Files are still opened by their full path.
+	// It has no effect for the path "." and for several paths of
+	// InitMulti, whose files could not be told apart otherwise.
+	StripPath bool
+
+	// MaxParseSize bounds the size of a body DryRunParse keeps in memory to
+	// hand to the parser. Larger bodies are drained without being kept and
+	// reported with ErrParseSize. Zero means DefaultMaxParseSize.
+	MaxParseSize int64
+
 	migrations *source.Migrations
 	fsys       fs.FS
-	path       string
+	// path is the directory FS is relative to, "." if the migrations were
+	// read from several paths, which are kept in paths.
+	path  string
+	paths []string
+	// stripped is the path removed from the Raw path of the migrations,
+	// empty if StripPath had no effect.
+	stripped string
 }
 
 // Init prepares not initialized IoFS instance to read migrations from a
 // io/fs#FS instance and a relative path.
 func (d *PartialDriver) Init(fsys fs.FS, path string) error {
+	return d.InitWithParser(fsys, path, source.DefaultParse)
+}
+
+// InitWithParser is like Init, but recognizes migration files with parse
+// instead of source.DefaultParse.
+func (d *PartialDriver) InitWithParser(fsys fs.FS, path string, parse source.Parser) error {
+	return d.init(fsys, []string{path}, func(p string) (*source.Migration, error) {
+		return parse(pathpkg.Base(p))
+	})
+}
+
+// InitMulti is like Init, but merges the migrations below each of paths
+// into one set ordered by version, e.g. core and feature migrations kept in
+// sibling directories. A version and direction found in several paths is
+// reported as source.ErrDuplicateMigration naming both files. FS holds the
+// migrations relative to the root of fsys if there is more than one path.
+func (d *PartialDriver) InitMulti(fsys fs.FS, paths ...string) error {
+	if len(paths) == 0 {
+		return errors.New("no path to read migrations from")
+	}
+	return d.init(fsys, paths, func(p string) (*source.Migration, error) {
+		return source.DefaultParse(pathpkg.Base(p))
+	})
+}
+
+// InitVersionDirs is like Init, but for migrations laid out in a directory
+// per version, see NewVersionDirs.
+func (d *PartialDriver) InitVersionDirs(fsys fs.FS, path string) error {
+	return d.init(fsys, []string{path}, func(p string) (*source.Migration, error) {
+		return source.ParseVersionDir(pathpkg.Base(pathpkg.Dir(p)) + "/" + pathpkg.Base(p))
+	})
+}
+
+// Ignored lists the patterns, as understood by path.Match, of the names of
+// files and directories that are never read as migrations: hidden ones
+// and the temporary and backup files of editors, which may otherwise
+// shadow the real migration, e.g. 1_init.up.sql~. Init and New read it.
+var Ignored = []string{".*", "*~", "#*#", "*.swp", "*.swo", "*.bak", "*.orig", "*.tmp"}
+
+func ignored(name string) bool {
+	for _, pattern := range Ignored {
+		if ok, _ := pathpkg.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// IgnoreFile is the name of the file in a migrations directory listing
+// further patterns of files and directories not to read, one per line.
+// Blank lines and lines starting with # are skipped. A pattern without a
+// slash is matched against the name of every file and directory, e.g.
+// *.draft.sql, otherwise against the slash separated path relative to the
+// migrations directory, e.g. archive/2019_*. A trailing slash restricts a
+// pattern to directories, e.g. archive/. Patterns are understood by
+// path.Match, a matching directory is skipped with all its content.
+const IgnoreFile = ".migrateignore"
+
+// ignoreList holds the patterns of an IgnoreFile.
+type ignoreList []string
+
+// readIgnoreFile returns the patterns of the IgnoreFile in dir of fsys,
+// none if there is no such file.
+func readIgnoreFile(fsys fs.FS, dir string) (ignoreList, error) {
+	name := pathpkg.Join(dir, IgnoreFile)
+	b, err := fs.ReadFile(fsys, name)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unable to read %v: %w", name, err)
+	}
+	var patterns ignoreList
+	for _, line := range strings.Split(string(b), "\n") {
+		pattern := strings.TrimSpace(line)
+		if pattern == "" || strings.HasPrefix(pattern, "#") {
+			continue
+		}
+		if _, err := pathpkg.Match(strings.TrimSuffix(pattern, "/"), ""); err != nil {
+			return nil, fmt.Errorf("invalid pattern %q in %v: %w", pattern, name, err)
+		}
+		patterns = append(patterns, pattern)
+	}
+	return patterns, nil
+}
+
+// ignores reports whether the file or directory at path below root is
+// the IgnoreFile of root or matches a pattern of l.
+func (l ignoreList) ignores(root, path string, dir bool) bool {
+	rel := path
+	if root != "." {
+		rel = strings.TrimPrefix(path, root+"/")
+	}
+	if rel == IgnoreFile {
+		return true
+	}
+	for _, pattern := range l {
+		if strings.HasSuffix(pattern, "/") {
+			if !dir {
+				continue
+			}
+			pattern = strings.TrimSuffix(pattern, "/")
+		}
+		name := rel
+		if !strings.Contains(pattern, "/") {
+			name = pathpkg.Base(rel)
+		}
+		if ok, _ := pathpkg.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// init reads the migrations below paths of fsys, parse is passed the slash
+// separated path of each file.
+func (d *PartialDriver) init(fsys fs.FS, paths []string, parse func(path string) (*source.Migration, error)) error {
+	var stripped string
+	if d.StripPath && len(paths) == 1 && paths[0] != "." {
+		stripped = paths[0]
+	}
 	ms := source.NewMigrations()
+	for _, path := range paths {
+		if err := d.walk(ms, fsys, path, stripped, parse); err != nil {
+			return err
+		}
+	}
+
+	old := d.fsys
+	d.fsys = fsys
+	d.path = "."
+	if len(paths) == 1 {
+		d.path = paths[0]
+	}
+	d.paths = paths
+	d.stripped = stripped
+	d.migrations = ms
+
+	// release the file system of a previous Init
+	if c, ok := old.(io.Closer); ok && !sameFS(old, fsys) {
+		return c.Close()
+	}
+	return nil
+}
+
+// walk adds the migrations below root of fsys to ms, leaving out the
+// files listed in the IgnoreFile of root. Their Raw path is relative to
+// stripped if set.
+func (d *PartialDriver) walk(ms *source.Migrations, fsys fs.FS, root, stripped string, parse func(path string) (*source.Migration, error)) error {
+	ignoreList, err := readIgnoreFile(fsys, root)
+	if err != nil {
+		return err
+	}
 	// Read all migrations recursively.
-	err := fs.WalkDir(fsys, path, func(path string, e fs.DirEntry, err error) error {
+	return fs.WalkDir(fsys, root, func(path string, e fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if path != root && (ignored(e.Name()) || ignoreList.ignores(root, path, e.IsDir())) {
+			if e.IsDir() {
+				return fs.SkipDir
+			}
+			return nil
+		}
 		if !e.IsDir() {
-			m, err := source.DefaultParse(e.Name())
+			m, err := parse(path)
+			if errors.Is(err, source.ErrParse) && d.Combined {
+				m, err = source.ParseCombined(pathpkg.Base(path))
+			}
+			if errors.Is(err, strconv.ErrRange) {
+				return fmt.Errorf("unable to parse %v: %w", path, err)
+			}
 			if err != nil {
-				return nil // ignore parse errors,
+				// ignore parse errors
+				if d.OnSkip != nil {
+					d.OnSkip(path, err)
+				}
+				return nil
 			}
 			// set relative path
 			m.Raw = path
+			if stripped != "" {
+				m.Raw = strings.TrimPrefix(path, stripped+"/")
+			}
 			file, err := e.Info()
 			if err != nil {
 				return err
 			}
-
-			if !ms.Append(m) {
-				return source.ErrDuplicateMigration{
-					Migration: *m,
-					FileInfo:  file,
+			m.ModTime = file.ModTime()
+			if m.Combined {
+				return d.appendCombined(ms, fsys, path, m, file)
+			}
+			if m.Direction == source.Down {
+				if m.Empty, m.Irreversible, err = inspect(fsys, path, file.Size()); err != nil {
+					return err
 				}
 			}
+			return appendFile(ms, m, file)
 		}
 		return nil
 	})
-	if err != nil {
+}
+
+// full returns the path of the file of a migration with the given Raw
+// path in the file system.
+func (d *PartialDriver) full(raw string) string {
+	if d.stripped == "" {
+		return raw
+	}
+	return d.stripped + "/" + raw
+}
+
+// location names the paths the migrations were read from in errors.
+func (d *PartialDriver) location() string {
+	return strings.Join(d.paths, ", ")
+}
+
+// appendFile adds m read from file to ms.
+func appendFile(ms *source.Migrations, m *source.Migration, file fs.FileInfo) error {
+	if err := ms.AppendErr(m); err != nil {
+		if dup, ok := err.(source.ErrDuplicateMigration); ok {
+			dup.FileInfo = file
+			return dup
+		}
 		return err
 	}
+	return nil
+}
 
-	d.fsys = fsys
-	d.path = path
-	d.migrations = ms
+// appendCombined adds a migration to ms for each section of the combined
+// file of m at path. Files without any section are skipped like names that
+// don't parse.
+func (d *PartialDriver) appendCombined(ms *source.Migrations, fsys fs.FS, path string, m *source.Migration, file fs.FileInfo) error {
+	f, err := fsys.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	up, down, err := source.Sections(f)
+	if errors.Is(err, source.ErrParse) {
+		if d.OnSkip != nil {
+			d.OnSkip(path, err)
+		}
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("unable to read sections of %v: %w", path, err)
+	}
+	if up != nil {
+		upMigration := *m
+		if err := appendFile(ms, &upMigration, file); err != nil {
+			return err
+		}
+	}
+	if down != nil {
+		downMigration := *m
+		downMigration.Direction = source.Down
+		down = bytes.TrimSpace(down)
+		downMigration.Empty = len(down) == 0
+		downMigration.Irreversible = string(down) == source.IrreversibleMarker
+		if err := appendFile(ms, &downMigration, file); err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
+// sameFS reports whether a and b are the same file system. File systems
+// of uncomparable types, like fstest.MapFS, are never the same.
+func sameFS(a, b fs.FS) bool {
+	return reflect.TypeOf(a) == reflect.TypeOf(b) && reflect.TypeOf(a).Comparable() && a == b
+}
+
 // Close is part of source.Driver interface implementation.
 // Closes the file system if possible.
 func (d *PartialDriver) Close() error {
@@ -99,7 +396,7 @@ func (d *PartialDriver) First() (version uint, err error) {
 	}
 	return 0, &fs.PathError{
 		Op:   "first",
-		Path: d.path,
+		Path: d.location(),
 		Err:  fs.ErrNotExist,
 	}
 }
@@ -111,7 +408,7 @@ func (d *PartialDriver) Prev(version uint) (prevVersion uint, err error) {
 	}
 	return 0, &fs.PathError{
 		Op:   "prev for version " + strconv.FormatUint(uint64(version), 10),
-		Path: d.path,
+		Path: d.location(),
 		Err:  fs.ErrNotExist,
 	}
 }
@@ -123,55 +420,196 @@ func (d *PartialDriver) Next(version uint) (nextVersion uint, err error) {
 	}
 	return 0, &fs.PathError{
 		Op:   "next for version " + strconv.FormatUint(uint64(version), 10),
-		Path: d.path,
+		Path: d.location(),
 		Err:  fs.ErrNotExist,
 	}
 }
 
 // ReadUp is part of source.Driver interface implementation.
 func (d *PartialDriver) ReadUp(version uint) (r io.ReadCloser, identifier string, location string, fn source.MigrationFunc, err error) {
+	return d.ReadUpCtx(context.Background(), version)
+}
+
+// ReadUpCtx is like ReadUp, but gives up once ctx is done. Reads of the
+// returned body honor ctx too, see ContextReader.
+func (d *PartialDriver) ReadUpCtx(ctx context.Context, version uint) (r io.ReadCloser, identifier string, location string, fn source.MigrationFunc, err error) {
+	if err := ctx.Err(); err != nil {
+		return nil, "", "", nil, err
+	}
 	if m, ok := d.migrations.Up(version); ok {
 		// read if migration function registered with this file
-		basename := filepath.Base(m.Raw)
-		if fn, ok := source.MgrFunctions[basename]; ok {
+		fn, err := source.FuncMigration(m)
+		if err != nil {
+			return nil, "", "", nil, err
+		}
+		if fn != nil {
+			d.count(m, nil)
 			return nil, m.Identifier, m.Raw, fn, nil
 		}
 		// read content of file and return
-		body, err := d.open(m.Raw)
+		body, err := d.body(ctx, m)
 		if err != nil {
 			return nil, "", "", nil, err
 		}
-		return body, m.Identifier, m.Raw, nil, nil
+		return d.count(m, body), m.Identifier, m.Raw, nil, nil
 	}
 	return nil, "", "", nil, &fs.PathError{
 		Op:   "read up for version " + strconv.FormatUint(uint64(version), 10),
-		Path: d.path,
+		Path: d.location(),
 		Err:  fs.ErrNotExist,
 	}
 }
 
 // ReadDown is part of source.Driver interface implementation.
 func (d *PartialDriver) ReadDown(version uint) (r io.ReadCloser, identifier string, location string, fn source.MigrationFunc, err error) {
+	return d.ReadDownCtx(context.Background(), version)
+}
+
+// ReadDownCtx is like ReadDown, but gives up once ctx is done. Reads of
+// the returned body honor ctx too, see ContextReader.
+func (d *PartialDriver) ReadDownCtx(ctx context.Context, version uint) (r io.ReadCloser, identifier string, location string, fn source.MigrationFunc, err error) {
+	if err := ctx.Err(); err != nil {
+		return nil, "", "", nil, err
+	}
 	if m, ok := d.migrations.Down(version); ok {
 		// read if migration function registered with this file
-		basename := filepath.Base(m.Raw)
-		if fn, ok := source.MgrFunctions[basename]; ok {
+		fn, err := source.FuncMigration(m)
+		if err != nil {
+			return nil, "", "", nil, err
+		}
+		if m.Irreversible || source.IsIrreversible(fn) {
+			return nil, "", "", nil, fmt.Errorf("%w: %v", source.ErrIrreversibleMigration, m.Raw)
+		}
+		if fn != nil {
+			d.count(m, nil)
 			return nil, m.Identifier, m.Raw, fn, nil
 		}
 		// read content of file and return
-		body, err := d.open(m.Raw)
+		body, err := d.body(ctx, m)
 		if err != nil {
 			return nil, "", "", nil, err
 		}
-		return body, m.Identifier, m.Raw, nil, nil
+		return d.count(m, body), m.Identifier, m.Raw, nil, nil
+	}
+	// down function registered together with the up migration
+	if m, ok := d.migrations.Up(version); ok {
+		if fn, ok := source.DownFuncMigration(m.Raw); ok {
+			if source.IsIrreversible(fn) {
+				return nil, "", "", nil, fmt.Errorf("%w: %v", source.ErrIrreversibleMigration, m.Raw)
+			}
+			return nil, m.Identifier, m.Raw, fn, nil
+		}
 	}
 	return nil, "", "", nil, &fs.PathError{
 		Op:   "read down for version " + strconv.FormatUint(uint64(version), 10),
-		Path: d.path,
+		Path: d.location(),
 		Err:  fs.ErrNotExist,
 	}
 }
 
+// body opens the file of m, reads of it honor ctx. Of a combined file only
+// the section of the direction of m is returned.
+func (d *PartialDriver) body(ctx context.Context, m *source.Migration) (io.ReadCloser, error) {
+	f, err := d.open(d.full(m.Raw))
+	if err != nil {
+		return nil, err
+	}
+	if !m.Combined {
+		return withContext(ctx, f), nil
+	}
+	defer f.Close()
+	up, down, err := source.Sections(withContext(ctx, f))
+	if err != nil {
+		return nil, &fs.PathError{Op: "read sections", Path: m.Raw, Err: err}
+	}
+	section := up
+	if m.Direction == source.Down {
+		section = down
+	}
+	if section == nil {
+		// the section was removed since Init
+		return nil, &fs.PathError{Op: "read " + string(m.Direction) + " section", Path: m.Raw, Err: fs.ErrNotExist}
+	}
+	return io.NopCloser(bytes.NewReader(section)), nil
+}
+
+// count wraps body to record its size in m if CountBytes is set.
+func (d *PartialDriver) count(m *source.Migration, body io.ReadCloser) io.ReadCloser {
+	if !d.CountBytes {
+		return body
+	}
+	return source.CountBytes(m, body)
+}
+
+// DefaultMaxParseSize is the largest body DryRunParse hands to the parser
+// if MaxParseSize is not set, like the default maximum size of a
+// multi-statement migration of the database drivers.
+var DefaultMaxParseSize int64 = 10 << 20
+
+// ErrParseSize is returned by DryRunParse for a body larger than
+// MaxParseSize, which is not parsed.
+var ErrParseSize = errors.New("body too large to parse")
+
+// DryRunParse reads the body of every migration in the given direction and
+// runs it through parse, without applying anything. Bodies are read one at a
+// time and Go migration functions are skipped. All read and parse errors are
+// returned, annotated with the version and location of the migration.
+// At most MaxParseSize bytes of a body are held in memory, see parseBody.
+func (d *PartialDriver) DryRunParse(dir source.Direction, parse func(sql string) error) []error {
+	lookup, read := d.migrations.Up, d.ReadUp
+	if dir == source.Down {
+		lookup, read = d.migrations.Down, d.ReadDown
+	}
+
+	var errs []error
+	for version, ok := d.migrations.First(); ok; version, ok = d.migrations.Next(version) {
+		m, ok := lookup(version)
+		if !ok {
+			continue
+		}
+		r, _, _, fn, err := read(version)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("version %v (%v): %w", version, m.Raw, err))
+			continue
+		}
+		if fn != nil {
+			continue
+		}
+		body, err := d.parseBody(r)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("version %v (%v): %w", version, m.Raw, err))
+			continue
+		}
+		if err := parse(body); err != nil {
+			errs = append(errs, fmt.Errorf("version %v (%v): %w", version, m.Raw, err))
+		}
+	}
+	return errs
+}
+
+// parseBody reads and closes the body r for DryRunParse. Only the first
+// MaxParseSize bytes are kept, the rest of a larger body is counted and
+// discarded, so memory stays bounded whatever the size of the migrations.
+func (d *PartialDriver) parseBody(r io.ReadCloser) (string, error) {
+	max := d.MaxParseSize
+	if max <= 0 {
+		max = DefaultMaxParseSize
+	}
+	counted := &source.CountingReadCloser{ReadCloser: r}
+	defer counted.Close()
+	var body strings.Builder
+	if _, err := io.Copy(&body, io.LimitReader(counted, max)); err != nil {
+		return "", err
+	}
+	if _, err := io.Copy(io.Discard, counted); err != nil {
+		return "", err
+	}
+	if counted.N > max {
+		return "", fmt.Errorf("%w: %v bytes, at most %v", ErrParseSize, counted.N, max)
+	}
+	return body.String(), nil
+}
+
 func (d *PartialDriver) open(path string) (fs.File, error) {
 	f, err := d.fsys.Open(path)
 	if err == nil {
@@ -189,6 +627,65 @@ func (d *PartialDriver) open(path string) (fs.File, error) {
 	return nil, err
 }
 
+// ContextReader is implemented by files that can abort a pending read,
+// e.g. of file systems doing I/O over RPC. Bodies returned by ReadUpCtx
+// and ReadDownCtx use it to stop reading once their context is done.
+type ContextReader interface {
+	ReadContext(ctx context.Context, p []byte) (n int, err error)
+}
+
+// withContext makes reads of f honor ctx. A context that is never done
+// leaves f as is.
+func withContext(ctx context.Context, f fs.File) io.ReadCloser {
+	if ctx.Done() == nil {
+		return f
+	}
+	return &ctxFile{File: f, ctx: ctx}
+}
+
+// ctxFile checks its context before every read and passes it on to files
+// implementing ContextReader.
+type ctxFile struct {
+	fs.File
+	ctx context.Context
+}
+
+func (f *ctxFile) Read(p []byte) (int, error) {
+	if err := f.ctx.Err(); err != nil {
+		return 0, err
+	}
+	if cr, ok := f.File.(ContextReader); ok {
+		return cr.ReadContext(f.ctx, p)
+	}
+	return f.File.Read(p)
+}
+
+// inspectLimit is the largest file inspect reads to look at its content.
+const inspectLimit = 4096
+
+// inspect reports whether the file at path holds whitespace only, or
+// nothing but source.IrreversibleMarker. Files larger than inspectLimit
+// are neither.
+func inspect(fsys fs.FS, path string, size int64) (blank, irreversible bool, err error) {
+	if size == 0 {
+		return true, false, nil
+	}
+	if size > inspectLimit {
+		return false, false, nil
+	}
+	body, err := fs.ReadFile(fsys, path)
+	if err != nil {
+		return false, false, err
+	}
+	body = bytes.TrimSpace(body)
+	return len(body) == 0, string(body) == source.IrreversibleMarker, nil
+}
+
+// IsEmptyDown reports whether the down migration for version is blank.
+func (d *PartialDriver) IsEmptyDown(version uint) bool {
+	return d.migrations.IsEmptyDown(version)
+}
+
 func (d *PartialDriver) MarkSkipMigrations(version uint, dir source.Direction) {
 	d.migrations.MarkSkipMigrations(version, dir)
 }
@@ -197,6 +694,88 @@ func (d *PartialDriver) UpdateStatus(version uint, status source.Status, errstr
 	d.migrations.UpdateStatus(version, status, errstr)
 }
 
+// UpdateStatusDir is like UpdateStatus, but only updates the migration of
+// direction dir.
+func (d *PartialDriver) UpdateStatusDir(version uint, dir source.Direction, status source.Status, errstr string) {
+	d.migrations.UpdateStatusDir(version, dir, status, errstr)
+}
+
 func (d *PartialDriver) PrintSummary(dir source.Direction) {
 	d.migrations.PrintSummary(dir)
 }
+
+// SummaryJSON returns the summary printed by PrintSummary as JSON.
+// See source.Migrations.SummaryJSON.
+func (d *PartialDriver) SummaryJSON(dir source.Direction) ([]byte, error) {
+	return d.migrations.SummaryJSON(dir)
+}
+
+// ComputeChecksums reads every migration and records the SHA-256 of its
+// body, which is reported by SummaryJSON.
+func (d *PartialDriver) ComputeChecksums() error {
+	return d.migrations.ComputeChecksums(d)
+}
+
+// Versions returns all versions available to the driver in ascending order.
+func (d *PartialDriver) Versions() []uint {
+	return d.migrations.Versions()
+}
+
+// IsFunc reports whether the migration of version in direction dir is a
+// go migration function rather than a file, without reading it.
+// See source.Migrations.IsFunc.
+func (d *PartialDriver) IsFunc(version uint, dir source.Direction) bool {
+	return d.migrations.IsFunc(version, dir)
+}
+
+// Identifier returns the identifier of the migration of version in
+// direction dir without reading it.
+func (d *PartialDriver) Identifier(version uint, dir source.Direction) (string, bool) {
+	return d.migrations.Identifier(version, dir)
+}
+
+// FindByIdentifier returns a copy of the first migration in direction dir
+// named identifier, see source.Migrations.FindByIdentifier.
+func (d *PartialDriver) FindByIdentifier(identifier string, dir source.Direction) (*source.Migration, bool) {
+	return d.migrations.FindByIdentifier(identifier, dir)
+}
+
+// FindByIdentifierFold is like FindByIdentifier, but matches identifier
+// case insensitively.
+func (d *PartialDriver) FindByIdentifierFold(identifier string, dir source.Direction) (*source.Migration, bool) {
+	return d.migrations.FindByIdentifierFold(identifier, dir)
+}
+
+// Walk calls fn with a copy of each migration of direction dir in the
+// order they would be applied, see source.Migrations.Walk.
+func (d *PartialDriver) Walk(dir source.Direction, fn func(m *source.Migration) error) error {
+	return d.migrations.Walk(dir, fn)
+}
+
+// Counts returns how many migrations of direction dir are in each status.
+func (d *PartialDriver) Counts(dir source.Direction) map[source.Status]int {
+	return d.migrations.Counts(dir)
+}
+
+// HasFailures reports whether a migration has failed.
+func (d *PartialDriver) HasFailures() bool {
+	return d.migrations.HasFailures()
+}
+
+// Validate checks that every version has an up and a down migration, or
+// only an up migration if downOptional is set, see source.Migrations.Validate.
+func (d *PartialDriver) Validate(downOptional bool) error {
+	return d.migrations.Validate(downOptional)
+}
+
+// MissingVersions returns the versions absent from the sequence start,
+// start+step, ... up to the highest version of the driver.
+// See source.Migrations.MissingVersions.
+func (d *PartialDriver) MissingVersions(start, step uint) []uint {
+	return d.migrations.MissingVersions(start, step)
+}
+
+// Reset sets the status of all migrations back to pending.
+func (d *PartialDriver) Reset() {
+	d.migrations.Reset()
+}
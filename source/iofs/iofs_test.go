@@ -4,8 +4,21 @@
 package iofs_test
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	stdfs "io/fs"
+	"io/ioutil"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
 	"testing"
+	"testing/fstest"
+	"time"
 
+	"github.com/nokia/migrate/v4/source"
 	"github.com/nokia/migrate/v4/source/iofs"
 	st "github.com/nokia/migrate/v4/source/testing"
 )
@@ -19,3 +32,1067 @@ func Test(t *testing.T) {
 
 	st.Test(t, d)
 }
+
+// unreadableDirFS fails to list the contents of a single directory.
+type unreadableDirFS struct {
+	fstest.MapFS
+	dir string
+	err error
+}
+
+func (f unreadableDirFS) ReadDir(name string) ([]stdfs.DirEntry, error) {
+	if name == f.dir {
+		return nil, &stdfs.PathError{Op: "readdir", Path: name, Err: f.err}
+	}
+	return f.MapFS.ReadDir(name)
+}
+
+func TestInitReadDirError(t *testing.T) {
+	fsys := unreadableDirFS{
+		MapFS: fstest.MapFS{
+			"migrations/1_foobar.up.sql":        &fstest.MapFile{Data: []byte("1 up")},
+			"migrations/locked/2_foobar.up.sql": &fstest.MapFile{Data: []byte("2 up")},
+		},
+		dir: "migrations/locked",
+		err: stdfs.ErrPermission,
+	}
+
+	if _, err := iofs.New(fsys, "migrations"); !errors.Is(err, stdfs.ErrPermission) {
+		t.Fatalf("expected %v, got %v", stdfs.ErrPermission, err)
+	}
+}
+
+func TestReadFuncMigrationWithDown(t *testing.T) {
+	errUp, errDown := errors.New("up"), errors.New("down")
+	source.MgrFunctions["1_foobar.up.go"] = func(ctx context.Context, db interface{}) error { return errUp }
+	source.MgrDownFunctions["1_foobar.up.go"] = func(ctx context.Context, db interface{}) error { return errDown }
+	defer delete(source.MgrFunctions, "1_foobar.up.go")
+	defer delete(source.MgrDownFunctions, "1_foobar.up.go")
+
+	d, err := iofs.New(fstest.MapFS{
+		"migrations/1_foobar.up.go": &fstest.MapFile{},
+	}, "migrations")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r, _, _, fn, err := d.ReadUp(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r != nil || fn == nil {
+		t.Fatal("ReadUp: expected migration function")
+	}
+	if err := fn(context.Background(), nil); err != errUp {
+		t.Errorf("ReadUp: expected %v, got %v", errUp, err)
+	}
+
+	r, _, _, fn, err = d.ReadDown(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r != nil || fn == nil {
+		t.Fatal("ReadDown: expected migration function")
+	}
+	if err := fn(context.Background(), nil); err != errDown {
+		t.Errorf("ReadDown: expected %v, got %v", errDown, err)
+	}
+}
+
+func TestIsFunc(t *testing.T) {
+	fn := func(ctx context.Context, db interface{}) error { return nil }
+	source.MgrFunctions["1_foobar.up.go"] = fn
+	source.MgrDownFunctions["1_foobar.up.go"] = fn
+	source.MgrFunctions["2_foobar.down.go"] = fn
+	defer delete(source.MgrFunctions, "1_foobar.up.go")
+	defer delete(source.MgrDownFunctions, "1_foobar.up.go")
+	defer delete(source.MgrFunctions, "2_foobar.down.go")
+
+	d, err := iofs.New(fstest.MapFS{
+		"migrations/1_foobar.up.go":    &fstest.MapFile{},
+		"migrations/2_foobar.up.sql":   &fstest.MapFile{Data: []byte("2 up")},
+		"migrations/2_foobar.down.go":  &fstest.MapFile{},
+		"migrations/3_foobar.up.sql":   &fstest.MapFile{Data: []byte("3 up")},
+		"migrations/3_foobar.down.sql": &fstest.MapFile{Data: []byte("3 down")},
+	}, "migrations")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fd := d.(source.FuncReporter)
+	for _, tc := range []struct {
+		version uint
+		dir     source.Direction
+		isFunc  bool
+	}{
+		{1, source.Up, true},
+		{1, source.Down, true},
+		{2, source.Up, false},
+		{2, source.Down, true},
+		{3, source.Up, false},
+		{3, source.Down, false},
+		{4, source.Up, false},
+	} {
+		if got := fd.IsFunc(tc.version, tc.dir); got != tc.isFunc {
+			t.Errorf("expected IsFunc(%v, %v) to be %v, got %v", tc.version, tc.dir, tc.isFunc, got)
+		}
+		if tc.version == 4 {
+			continue
+		}
+		read := d.ReadUp
+		if tc.dir == source.Down {
+			read = d.ReadDown
+		}
+		r, _, _, fn, err := read(tc.version)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if r != nil {
+			r.Close()
+		}
+		if (fn != nil) != tc.isFunc {
+			t.Errorf("expected IsFunc(%v, %v) to match the read, got function %v", tc.version, tc.dir, fn != nil)
+		}
+	}
+}
+
+func TestRegisterFuncMigrationNamed(t *testing.T) {
+	errUp := errors.New("up")
+	register := func(name string) {
+		source.RegisterFuncMigrationNamed(name, func(ctx context.Context, db interface{}) error { return errUp })
+	}
+	register("db/migrations/3_named.up.go")
+	defer delete(source.MgrFunctions, "3_named.up.go")
+
+	d, err := iofs.New(fstest.MapFS{
+		"migrations/3_named.up.go": &fstest.MapFile{Data: []byte("package migrations")},
+	}, "migrations")
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, _, location, fn, err := d.ReadUp(3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r != nil || fn == nil {
+		t.Fatal("expected migration function")
+	}
+	if err := fn(context.Background(), nil); err != errUp {
+		t.Errorf("expected %v, got %v", errUp, err)
+	}
+	if location != "migrations/3_named.up.go" {
+		t.Errorf("unexpected location %q", location)
+	}
+}
+
+func TestDryRunParse(t *testing.T) {
+	fsys := fstest.MapFS{
+		"migrations/1_foobar.up.sql":   &fstest.MapFile{Data: []byte("CREATE TABLE foo (id int);")},
+		"migrations/1_foobar.down.sql": &fstest.MapFile{Data: []byte("DROP TABLE foo;")},
+		"migrations/2_foobar.up.sql":   &fstest.MapFile{Data: []byte("CREAT TABLE bar (id int);")},
+		"migrations/3_foobar.up.sql":   &fstest.MapFile{Data: []byte("ALTER TABLE foo ADD x int;")},
+		"migrations/3_foobar.down.sql": &fstest.MapFile{Data: []byte("ALTER TABLE foo DROP x")},
+	}
+	d, err := iofs.New(fsys, "migrations")
+	if err != nil {
+		t.Fatal(err)
+	}
+	errSyntax := errors.New("syntax error")
+	parse := func(sql string) error {
+		if strings.HasPrefix(sql, "CREAT ") || !strings.HasSuffix(sql, ";") {
+			return errSyntax
+		}
+		return nil
+	}
+
+	dr := d.(interface {
+		DryRunParse(dir source.Direction, parse func(sql string) error) []error
+	})
+
+	errs := dr.DryRunParse(source.Up, parse)
+	if len(errs) != 1 {
+		t.Fatalf("Up: expected 1 error, got %v", errs)
+	}
+	if !errors.Is(errs[0], errSyntax) || !strings.Contains(errs[0].Error(), "migrations/2_foobar.up.sql") {
+		t.Errorf("Up: expected syntax error for version 2, got %v", errs[0])
+	}
+
+	errs = dr.DryRunParse(source.Down, parse)
+	if len(errs) != 1 {
+		t.Fatalf("Down: expected 1 error, got %v", errs)
+	}
+	if !errors.Is(errs[0], errSyntax) || !strings.Contains(errs[0].Error(), "version 3") {
+		t.Errorf("Down: expected syntax error for version 3, got %v", errs[0])
+	}
+
+	// bodies larger than MaxParseSize are not parsed
+	limited := &iofs.PartialDriver{MaxParseSize: 16}
+	if err := limited.Init(fsys, "migrations"); err != nil {
+		t.Fatal(err)
+	}
+	var parsed []string
+	errs = limited.DryRunParse(source.Up, func(sql string) error {
+		parsed = append(parsed, sql)
+		return nil
+	})
+	if len(errs) != 3 || len(parsed) != 0 {
+		t.Fatalf("expected 3 errors and nothing parsed, got %v, %v", errs, parsed)
+	}
+	if !errors.Is(errs[0], iofs.ErrParseSize) || !strings.Contains(errs[0].Error(), "26 bytes") {
+		t.Errorf("expected %v naming the size, got %v", iofs.ErrParseSize, errs[0])
+	}
+}
+
+func TestReadAmbiguousMigration(t *testing.T) {
+	source.MgrFunctions["1_foobar.up.go"] = func(ctx context.Context, db interface{}) error { return nil }
+	defer delete(source.MgrFunctions, "1_foobar.up.go")
+
+	d, err := iofs.New(fstest.MapFS{
+		"migrations/1_foobar.up.sql":   &fstest.MapFile{Data: []byte("1 up")},
+		"migrations/1_foobar.down.sql": &fstest.MapFile{Data: []byte("1 down")},
+	}, "migrations")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var ambiguous source.ErrAmbiguousMigration
+	if _, _, _, _, err := d.ReadUp(1); !errors.As(err, &ambiguous) {
+		t.Errorf("ReadUp: expected ErrAmbiguousMigration, got %v", err)
+	}
+	r, _, _, fn, err := d.ReadDown(1)
+	if err != nil {
+		t.Fatalf("ReadDown: expected no error, got %v", err)
+	}
+	defer r.Close()
+	if fn != nil {
+		t.Error("ReadDown: expected file body, got migration function")
+	}
+}
+
+var flywayRegex = regexp.MustCompile(`^([VU])([0-9]+)__(.*)\.sql$`)
+
+// parseFlyway recognizes Flyway-style versioned (V1__name.sql) and
+// undo (U1__name.sql) migrations.
+func parseFlyway(raw string) (*source.Migration, error) {
+	m := flywayRegex.FindStringSubmatch(raw)
+	if m == nil {
+		return nil, source.ErrParse
+	}
+	version, err := strconv.ParseUint(m[2], 10, 64)
+	if err != nil {
+		return nil, err
+	}
+	dir := source.Up
+	if m[1] == "U" {
+		dir = source.Down
+	}
+	return &source.Migration{
+		Version:    uint(version),
+		Identifier: m[3],
+		Direction:  dir,
+		Raw:        raw,
+		Status:     source.Pending,
+	}, nil
+}
+
+func TestNewWithParser(t *testing.T) {
+	d, err := iofs.NewWithParser(fstest.MapFS{
+		"migrations/V1__create_users.sql": &fstest.MapFile{Data: []byte("1 up")},
+		"migrations/U1__create_users.sql": &fstest.MapFile{Data: []byte("1 down")},
+		"migrations/V2__add_email.sql":    &fstest.MapFile{Data: []byte("2 up")},
+		"migrations/1_foobar.up.sql":      &fstest.MapFile{Data: []byte("ignored")},
+	}, "migrations", parseFlyway)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tt := []struct {
+		version    uint
+		dir        source.Direction
+		identifier string
+		expectErr  error
+	}{
+		{version: 1, dir: source.Up, identifier: "create_users"},
+		{version: 1, dir: source.Down, identifier: "create_users"},
+		{version: 2, dir: source.Up, identifier: "add_email"},
+		{version: 2, dir: source.Down, expectErr: stdfs.ErrNotExist},
+	}
+	for i, v := range tt {
+		read := d.ReadUp
+		if v.dir == source.Down {
+			read = d.ReadDown
+		}
+		r, identifier, _, _, err := read(v.version)
+		if v.expectErr != nil {
+			if !errors.Is(err, v.expectErr) {
+				t.Errorf("expected %v, got %v, in %v", v.expectErr, err, i)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("unexpected error %v, in %v", err, i)
+		}
+		r.Close()
+		if identifier != v.identifier {
+			t.Errorf("expected identifier %v, got %v, in %v", v.identifier, identifier, i)
+		}
+	}
+
+	if next, err := d.Next(1); err != nil || next != 2 {
+		t.Errorf("expected next version 2, got %v, %v", next, err)
+	}
+}
+
+func TestVersionDirs(t *testing.T) {
+	d, err := iofs.NewVersionDirs(fstest.MapFS{
+		"migrations/0001/up.sql":             &fstest.MapFile{Data: []byte("1 up")},
+		"migrations/0001/down.sql":           &fstest.MapFile{Data: []byte("1 down")},
+		"migrations/0002_add_email/up.sql":   &fstest.MapFile{Data: []byte("2 up")},
+		"migrations/0002_add_email/notes.md": &fstest.MapFile{Data: []byte("ignored")},
+		"migrations/0010/down.sql":           &fstest.MapFile{Data: []byte("10 down")},
+		"migrations/README.md":               &fstest.MapFile{Data: []byte("ignored")},
+	}, "migrations")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tt := []struct {
+		version    uint
+		dir        source.Direction
+		body       string
+		identifier string
+		location   string
+	}{
+		{1, source.Up, "1 up", "0001", "migrations/0001/up.sql"},
+		{1, source.Down, "1 down", "0001", "migrations/0001/down.sql"},
+		{2, source.Up, "2 up", "add_email", "migrations/0002_add_email/up.sql"},
+		{10, source.Down, "10 down", "0010", "migrations/0010/down.sql"},
+	}
+	for _, v := range tt {
+		read := source.ReadUpString
+		if v.dir == source.Down {
+			read = source.ReadDownString
+		}
+		body, _, identifier, location, err := read(d, v.version)
+		if err != nil {
+			t.Fatalf("unexpected error %v for %v %v", err, v.version, v.dir)
+		}
+		if body != v.body || identifier != v.identifier || location != v.location {
+			t.Errorf("unexpected read %q, %q, %q of %v %v", body, identifier, location, v.version, v.dir)
+		}
+	}
+	if _, _, _, _, err := d.ReadDown(2); !errors.Is(err, stdfs.ErrNotExist) {
+		t.Errorf("expected %v, got %v", stdfs.ErrNotExist, err)
+	}
+	if next, err := d.Next(2); err != nil || next != 10 {
+		t.Errorf("expected next version 10, got %v, %v", next, err)
+	}
+}
+
+func TestIgnored(t *testing.T) {
+	fsys := fstest.MapFS{
+		"migrations/1_init.up.sql":                 &fstest.MapFile{Data: []byte("1 up")},
+		"migrations/1_init.up.sql~":                &fstest.MapFile{Data: []byte("old 1 up")},
+		"migrations/.1_init.up.sql.swp":            &fstest.MapFile{Data: []byte("swap")},
+		"migrations/.DS_Store":                     &fstest.MapFile{},
+		"migrations/2_users.up.sql":                &fstest.MapFile{Data: []byte("2 up")},
+		"migrations/2_users.down.sql.orig":         &fstest.MapFile{Data: []byte("merge leftover")},
+		"migrations/.git/3_hidden.up.sql":          &fstest.MapFile{Data: []byte("hidden")},
+		"migrations/nested/4_nested.up.sql":        &fstest.MapFile{Data: []byte("4 up")},
+		"migrations/nested/#4_nested.down.sql#":    &fstest.MapFile{Data: []byte("autosave")},
+		"migrations/nested/4_nested.down.sql.bak":  &fstest.MapFile{Data: []byte("backup")},
+		"migrations/nested/4_nested.down.sql.tmp":  &fstest.MapFile{Data: []byte("temporary")},
+		"migrations/nested/4_nested.down.sql.swo":  &fstest.MapFile{Data: []byte("swap")},
+		"migrations/nested/.4_nested.down.sql.swp": &fstest.MapFile{Data: []byte("swap")},
+	}
+	d, err := iofs.New(fsys, "migrations")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var versions []uint
+	for v, err := d.First(); err == nil; v, err = d.Next(v) {
+		versions = append(versions, v)
+	}
+	if !reflect.DeepEqual(versions, []uint{1, 2, 4}) {
+		t.Errorf("expected versions [1 2 4], got %v", versions)
+	}
+	if body, _, _, _, err := source.ReadUpString(d, 1); err != nil || body != "1 up" {
+		t.Errorf("expected %q, got %q, %v", "1 up", body, err)
+	}
+	for _, version := range []uint{2, 4} {
+		if _, _, _, _, err := d.ReadDown(version); !errors.Is(err, stdfs.ErrNotExist) {
+			t.Errorf("expected no down migration of version %v, got %v", version, err)
+		}
+	}
+
+	// a hidden root is read anyway, and the list can be changed
+	defer func(ignored []string) { iofs.Ignored = ignored }(iofs.Ignored)
+	iofs.Ignored = []string{"*.orig"}
+	d, err = iofs.New(fstest.MapFS{
+		".migrations/1_init.up.sql":   &fstest.MapFile{Data: []byte("1 up")},
+		".migrations/1_init.down.sql": &fstest.MapFile{Data: []byte("1 down")},
+		".migrations/2_init.up.sql~":  &fstest.MapFile{Data: []byte("2 up")},
+	}, ".migrations")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := d.Next(1); err != nil {
+		t.Errorf("expected version 2 to be read with a custom list, got %v", err)
+	}
+}
+
+func TestIgnoreFile(t *testing.T) {
+	ignore := "# drafts and old migrations\n*.draft.sql\narchive/\nnested/2_skip.up.sql\n\n"
+	fsys := fstest.MapFS{
+		"migrations/.migrateignore":            &fstest.MapFile{Data: []byte(ignore)},
+		"migrations/1_init.up.sql":             &fstest.MapFile{Data: []byte("1 up")},
+		"migrations/1_init.down.draft.sql":     &fstest.MapFile{Data: []byte("draft")},
+		"migrations/archive/3_old.up.sql":      &fstest.MapFile{Data: []byte("3 up")},
+		"migrations/nested/2_skip.up.sql":      &fstest.MapFile{Data: []byte("2 up")},
+		"migrations/nested/4_nested.up.sql":    &fstest.MapFile{Data: []byte("4 up")},
+		"migrations/nested/5_nested.draft.sql": &fstest.MapFile{Data: []byte("draft")},
+		"migrations/2_skip.up.sql":             &fstest.MapFile{Data: []byte("2 up")},
+	}
+	var skipped []string
+	d := &iofs.PartialDriver{OnSkip: func(path string, err error) {
+		skipped = append(skipped, path)
+	}}
+	if err := d.Init(fsys, "migrations"); err != nil {
+		t.Fatal(err)
+	}
+	if versions := d.Versions(); !reflect.DeepEqual(versions, []uint{1, 2, 4}) {
+		t.Errorf("expected versions [1 2 4], got %v", versions)
+	}
+	if _, _, location, _, err := d.ReadUp(2); err != nil || location != "migrations/2_skip.up.sql" {
+		t.Errorf("expected version 2 to be read from the root, got %v, %v", location, err)
+	}
+	if _, _, _, _, err := d.ReadDown(1); !errors.Is(err, stdfs.ErrNotExist) {
+		t.Errorf("expected the draft down migration to be ignored, got %v", err)
+	}
+	if len(skipped) != 0 {
+		t.Errorf("expected ignored files not to be reported, got %v", skipped)
+	}
+
+	// without an ignore file every migration is read
+	delete(fsys, "migrations/.migrateignore")
+	if err := d.Init(fsys, "migrations"); !errors.As(err, new(source.ErrDuplicateMigration)) {
+		t.Errorf("expected the duplicate version 2 to be read, got %v", err)
+	}
+
+	fsys["migrations/.migrateignore"] = &fstest.MapFile{Data: []byte("[\n")}
+	if err := d.Init(fsys, "migrations"); err == nil || !strings.Contains(err.Error(), ".migrateignore") {
+		t.Errorf("expected invalid pattern to be reported, got %v", err)
+	}
+}
+
+func TestOnSkip(t *testing.T) {
+	fsys := fstest.MapFS{
+		"migrations/1_init.up.sql":       &fstest.MapFile{Data: []byte("1 up")},
+		"migrations/two_users.up.sql":    &fstest.MapFile{Data: []byte("2 up")},
+		"migrations/README.md":           &fstest.MapFile{},
+		"migrations/1_init.up.sql~":      &fstest.MapFile{Data: []byte("old 1 up")},
+		"migrations/nested/3_x.sideways": &fstest.MapFile{},
+	}
+	skipped := make(map[string]error)
+	d := &iofs.PartialDriver{OnSkip: func(path string, err error) {
+		skipped[path] = err
+	}}
+	if err := d.Init(fsys, "migrations"); err != nil {
+		t.Fatal(err)
+	}
+	if len(skipped) != 3 {
+		t.Errorf("expected 3 skipped files, got %v", skipped)
+	}
+	for _, path := range []string{"migrations/two_users.up.sql", "migrations/README.md", "migrations/nested/3_x.sideways"} {
+		if err, ok := skipped[path]; !ok || !errors.Is(err, source.ErrParse) {
+			t.Errorf("expected %v to be skipped with %v, got %v", path, source.ErrParse, err)
+		}
+	}
+}
+
+func TestInitMulti(t *testing.T) {
+	fsys := fstest.MapFS{
+		"migrations/core/1_users.up.sql":      &fstest.MapFile{Data: []byte("1 up")},
+		"migrations/core/1_users.down.sql":    &fstest.MapFile{Data: []byte("1 down")},
+		"migrations/core/4_orders.up.sql":     &fstest.MapFile{Data: []byte("4 up")},
+		"migrations/features/2_flags.up.sql":  &fstest.MapFile{Data: []byte("2 up")},
+		"migrations/features/5_beta.up.sql":   &fstest.MapFile{Data: []byte("5 up")},
+		"migrations/features/5_beta.down.sql": &fstest.MapFile{Data: []byte("5 down")},
+		"migrations/other/3_skipped.up.sql":   &fstest.MapFile{Data: []byte("3 up")},
+	}
+	d := &iofs.PartialDriver{}
+	if err := d.InitMulti(fsys, "migrations/core", "migrations/features"); err != nil {
+		t.Fatal(err)
+	}
+	var versions []uint
+	for v, err := d.First(); err == nil; v, err = d.Next(v) {
+		versions = append(versions, v)
+	}
+	if !reflect.DeepEqual(versions, []uint{1, 2, 4, 5}) {
+		t.Errorf("expected versions [1 2 4 5], got %v", versions)
+	}
+	r, _, location, _, err := d.ReadDown(5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, err := ioutil.ReadAll(r)
+	r.Close()
+	if err != nil || string(body) != "5 down" || location != "migrations/features/5_beta.down.sql" {
+		t.Errorf("unexpected read %q, %q, %v", body, location, err)
+	}
+	if err := fstest.TestFS(d.FS(), "migrations/core/1_users.up.sql", "migrations/features/2_flags.up.sql"); err != nil {
+		t.Error(err)
+	}
+	if _, err := d.Next(5); !strings.Contains(err.Error(), "migrations/core, migrations/features") {
+		t.Errorf("expected error to name both paths, got %v", err)
+	}
+
+	fsys["migrations/features/4_invoices.up.sql"] = &fstest.MapFile{Data: []byte("4 up")}
+	err = (&iofs.PartialDriver{}).InitMulti(fsys, "migrations/core", "migrations/features")
+	var dup source.ErrDuplicateMigration
+	if !errors.As(err, &dup) {
+		t.Fatalf("expected ErrDuplicateMigration, got %v", err)
+	}
+	for _, name := range []string{"migrations/core/4_orders.up.sql", "migrations/features/4_invoices.up.sql"} {
+		if !strings.Contains(err.Error(), name) {
+			t.Errorf("expected error to name %v, got %v", name, err)
+		}
+	}
+}
+
+func TestCombined(t *testing.T) {
+	fsys := fstest.MapFS{
+		"migrations/1_users.sql": &fstest.MapFile{Data: []byte(
+			"-- +migrate Up\nCREATE TABLE users ();\n-- +migrate Down\nDROP TABLE users;\n")},
+		"migrations/2_seed.sql": &fstest.MapFile{Data: []byte(
+			"-- +migrate Up\nINSERT INTO users VALUES (1);\n")},
+		"migrations/3_index.up.sql":   &fstest.MapFile{Data: []byte("CREATE INDEX ...;")},
+		"migrations/3_index.down.sql": &fstest.MapFile{Data: []byte("DROP INDEX ...;")},
+		"migrations/4_notes.sql":      &fstest.MapFile{Data: []byte("no sections")},
+	}
+	var skipped []string
+	d := &iofs.PartialDriver{Combined: true, OnSkip: func(path string, err error) {
+		skipped = append(skipped, path)
+	}}
+	if err := d.Init(fsys, "migrations"); err != nil {
+		t.Fatal(err)
+	}
+	if versions := d.Versions(); !reflect.DeepEqual(versions, []uint{1, 2, 3}) {
+		t.Errorf("expected versions [1 2 3], got %v", versions)
+	}
+	if !reflect.DeepEqual(skipped, []string{"migrations/4_notes.sql"}) {
+		t.Errorf("expected the file without sections to be skipped, got %v", skipped)
+	}
+
+	for _, tc := range []struct {
+		read     func(uint) (io.ReadCloser, string, string, source.MigrationFunc, error)
+		version  uint
+		expected string
+	}{
+		{d.ReadUp, 1, "CREATE TABLE users ();\n"},
+		{d.ReadDown, 1, "DROP TABLE users;\n"},
+		{d.ReadUp, 2, "INSERT INTO users VALUES (1);\n"},
+		{d.ReadUp, 3, "CREATE INDEX ...;"},
+		{d.ReadDown, 3, "DROP INDEX ...;"},
+	} {
+		r, _, location, _, err := tc.read(tc.version)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, err := ioutil.ReadAll(r)
+		r.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(body) != tc.expected {
+			t.Errorf("expected %q for version %v, got %q", tc.expected, tc.version, body)
+		}
+		if tc.version == 1 && location != "migrations/1_users.sql" {
+			t.Errorf("unexpected location %q", location)
+		}
+	}
+
+	// the missing down section is a missing down migration
+	if _, _, _, _, err := d.ReadDown(2); !errors.Is(err, stdfs.ErrNotExist) {
+		t.Errorf("expected %v, got %v", stdfs.ErrNotExist, err)
+	}
+
+	// without the option combined files are not migrations
+	plain, err := iofs.New(fsys, "migrations")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, _, _, err := plain.ReadUp(1); !errors.Is(err, stdfs.ErrNotExist) {
+		t.Errorf("expected %v, got %v", stdfs.ErrNotExist, err)
+	}
+}
+
+func TestCountBytes(t *testing.T) {
+	source.MgrFunctions["2_count.up.go"] = func(ctx context.Context, db interface{}) error { return nil }
+	defer delete(source.MgrFunctions, "2_count.up.go")
+
+	d := &iofs.PartialDriver{CountBytes: true}
+	if err := d.Init(fstest.MapFS{
+		"migrations/1_count.up.sql": &fstest.MapFile{Data: []byte("CREATE TABLE foo (id int);")},
+		"migrations/2_count.up.go":  &fstest.MapFile{Data: []byte("package migrations")},
+		"migrations/3_count.up.sql": &fstest.MapFile{Data: []byte("SELECT 1;")},
+	}, "migrations"); err != nil {
+		t.Fatal(err)
+	}
+	for _, version := range []uint{1, 2} {
+		r, _, _, _, err := d.ReadUp(version)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if r != nil {
+			if _, err := ioutil.ReadAll(r); err != nil {
+				t.Fatal(err)
+			}
+			r.Close()
+		}
+	}
+	b, err := d.SummaryJSON(source.Up)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var entries []source.SummaryEntry
+	if err := json.Unmarshal(b, &entries); err != nil {
+		t.Fatal(err)
+	}
+	got := make(map[uint]int64)
+	for _, e := range entries {
+		got[e.Version] = e.Bytes
+	}
+	// version 3 is never read
+	if expected := map[uint]int64{1: 26, 2: 0, 3: 0}; !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected %v, got %v", expected, got)
+	}
+}
+
+func TestStripPath(t *testing.T) {
+	fsys := fstest.MapFS{
+		"internal/db/migrations/1_users.up.sql":   &fstest.MapFile{Data: []byte("CREATE TABLE users ();")},
+		"internal/db/migrations/1_users.down.sql": &fstest.MapFile{Data: []byte("DROP TABLE users;")},
+		"internal/db/migrations/v2/2_seed.sql": &fstest.MapFile{Data: []byte(
+			"-- +migrate Up\nINSERT INTO users VALUES (1);\n")},
+	}
+	d := &iofs.PartialDriver{StripPath: true, Combined: true}
+	if err := d.Init(fsys, "internal/db/migrations"); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		read     func(uint) (io.ReadCloser, string, string, source.MigrationFunc, error)
+		version  uint
+		location string
+		expected string
+	}{
+		{d.ReadUp, 1, "1_users.up.sql", "CREATE TABLE users ();"},
+		{d.ReadDown, 1, "1_users.down.sql", "DROP TABLE users;"},
+		{d.ReadUp, 2, "v2/2_seed.sql", "INSERT INTO users VALUES (1);\n"},
+	} {
+		r, _, location, _, err := tc.read(tc.version)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, err := ioutil.ReadAll(r)
+		r.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if location != tc.location || string(body) != tc.expected {
+			t.Errorf("expected %q from %v, got %q from %v", tc.expected, tc.location, body, location)
+		}
+	}
+
+	b, err := d.SummaryJSON(source.Up)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var entries []source.SummaryEntry
+	if err := json.Unmarshal(b, &entries); err != nil {
+		t.Fatal(err)
+	}
+	var raws []string
+	for _, e := range entries {
+		raws = append(raws, e.Raw)
+	}
+	if expected := []string{"1_users.up.sql", "v2/2_seed.sql"}; !reflect.DeepEqual(raws, expected) {
+		t.Errorf("expected summary paths %v, got %v", expected, raws)
+	}
+
+	if err := fstest.TestFS(d.FS(), "1_users.up.sql", "1_users.down.sql", "v2/2_seed.sql"); err != nil {
+		t.Error(err)
+	}
+
+	// there is nothing to strip from "."
+	d = &iofs.PartialDriver{StripPath: true}
+	if err := d.Init(fsys, "."); err != nil {
+		t.Fatal(err)
+	}
+	r, _, location, _, err := d.ReadUp(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.Close()
+	if location != "internal/db/migrations/1_users.up.sql" {
+		t.Errorf("unexpected location %q", location)
+	}
+}
+
+func TestIsEmptyDown(t *testing.T) {
+	d, err := iofs.New(fstest.MapFS{
+		"migrations/1_foobar.up.sql":   &fstest.MapFile{Data: []byte("1 up")},
+		"migrations/1_foobar.down.sql": &fstest.MapFile{Data: []byte(" \n\t\n")},
+		"migrations/2_foobar.up.sql":   &fstest.MapFile{},
+		"migrations/2_foobar.down.sql": &fstest.MapFile{},
+		"migrations/3_foobar.up.sql":   &fstest.MapFile{Data: []byte("3 up")},
+		"migrations/3_foobar.down.sql": &fstest.MapFile{Data: []byte("3 down")},
+	}, "migrations")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ed := d.(interface{ IsEmptyDown(version uint) bool })
+
+	for version, expected := range map[uint]bool{1: true, 2: true, 3: false, 4: false} {
+		if got := ed.IsEmptyDown(version); got != expected {
+			t.Errorf("expected IsEmptyDown(%v) to be %v, got %v", version, expected, got)
+		}
+	}
+}
+
+func TestFS(t *testing.T) {
+	d, err := iofs.New(fstest.MapFS{
+		"migrations/1_foobar.up.sql":        &fstest.MapFile{Data: []byte("1 up")},
+		"migrations/1_foobar.down.sql":      &fstest.MapFile{Data: []byte("1 down")},
+		"migrations/README.md":              &fstest.MapFile{Data: []byte("docs")},
+		"migrations/v2/3_foobar.up.sql":     &fstest.MapFile{Data: []byte("3 up")},
+		"migrations/v2/3_foobar.checksum":   &fstest.MapFile{Data: []byte("sidecar")},
+		"migrations/assets/not-a-migration": &fstest.MapFile{Data: []byte("ignored")},
+	}, "migrations")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fsys := d.(interface{ FS() stdfs.FS }).FS()
+
+	if err := fstest.TestFS(fsys, "1_foobar.up.sql", "1_foobar.down.sql", "v2/3_foobar.up.sql"); err != nil {
+		t.Fatal(err)
+	}
+
+	var names []string
+	if err := stdfs.WalkDir(fsys, ".", func(path string, e stdfs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !e.IsDir() {
+			names = append(names, path)
+		}
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{"1_foobar.down.sql", "1_foobar.up.sql", "v2/3_foobar.up.sql"}
+	if strings.Join(names, ",") != strings.Join(expected, ",") {
+		t.Errorf("expected %v, got %v", expected, names)
+	}
+
+	for _, name := range []string{"README.md", "assets", "v2/3_foobar.checksum"} {
+		if _, err := fsys.Open(name); !errors.Is(err, stdfs.ErrNotExist) {
+			t.Errorf("expected %v to be hidden, got %v", name, err)
+		}
+	}
+}
+
+type closableFS struct {
+	fstest.MapFS
+	closed *int
+}
+
+func (f closableFS) Close() error {
+	*f.closed++
+	return nil
+}
+
+func TestReInit(t *testing.T) {
+	files := fstest.MapFS{
+		"migrations/1_foobar.up.sql": &fstest.MapFile{Data: []byte("1 up")},
+	}
+	var firstClosed, secondClosed int
+	first := closableFS{MapFS: files, closed: &firstClosed}
+	second := closableFS{MapFS: files, closed: &secondClosed}
+
+	var d iofs.PartialDriver
+	if err := d.Init(first, "migrations"); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Init(second, "migrations"); err != nil {
+		t.Fatal(err)
+	}
+	if firstClosed != 1 || secondClosed != 0 {
+		t.Errorf("expected only the first FS to be closed, got %v and %v", firstClosed, secondClosed)
+	}
+	if err := d.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if secondClosed != 1 {
+		t.Errorf("expected Close to close the second FS, got %v", secondClosed)
+	}
+}
+
+func TestErrNotExist(t *testing.T) {
+	d, err := iofs.New(fs, "testdata/migrations")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, prevErr := d.Prev(1)
+	_, nextErr := d.Next(7)
+	_, _, _, _, readErr := d.ReadUp(5)
+	for _, err := range []error{prevErr, nextErr, readErr} {
+		if !errors.Is(err, stdfs.ErrNotExist) {
+			t.Errorf("expected error to wrap %v, got %v", stdfs.ErrNotExist, err)
+		}
+	}
+	if !strings.Contains(nextErr.Error(), "version 7") {
+		t.Errorf("expected error to name the version, got %v", nextErr)
+	}
+
+	empty, err := iofs.New(fstest.MapFS{"migrations/README.md": &fstest.MapFile{}}, "migrations")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := empty.First(); !errors.Is(err, stdfs.ErrNotExist) {
+		t.Errorf("expected error to wrap %v, got %v", stdfs.ErrNotExist, err)
+	}
+}
+
+func TestDuplicateMigration(t *testing.T) {
+	older := time.Date(2021, 3, 1, 12, 0, 0, 0, time.UTC)
+	newer := time.Date(2021, 3, 2, 12, 0, 0, 0, time.UTC)
+	_, err := iofs.New(fstest.MapFS{
+		"migrations/1_foo.up.sql": &fstest.MapFile{Data: []byte("1 up"), ModTime: newer},
+		"migrations/1_bar.up.sql": &fstest.MapFile{Data: []byte("1 up"), ModTime: older},
+	}, "migrations")
+	var dup source.ErrDuplicateMigration
+	if !errors.As(err, &dup) {
+		t.Fatalf("expected ErrDuplicateMigration, got %v", err)
+	}
+	for _, path := range []string{"migrations/1_bar.up.sql", "migrations/1_foo.up.sql"} {
+		if !strings.Contains(err.Error(), path) {
+			t.Errorf("expected error to name %v, got %v", path, err)
+		}
+	}
+	if !dup.Migration.ModTime.Equal(newer) || !dup.ExistingModTime.Equal(older) {
+		t.Errorf("expected mod times %v and %v, got %v and %v", newer, older, dup.Migration.ModTime, dup.ExistingModTime)
+	}
+	if !strings.Contains(err.Error(), "(modified 2021-03-01T12:00:00Z)") {
+		t.Errorf("expected error to name the mod times, got %v", err)
+	}
+}
+
+func TestModTime(t *testing.T) {
+	modTime := time.Date(2021, 3, 1, 12, 0, 0, 0, time.UTC)
+	d := &iofs.PartialDriver{}
+	if err := d.Init(fstest.MapFS{
+		"migrations/1_foo.up.sql": &fstest.MapFile{Data: []byte("1 up"), ModTime: modTime},
+	}, "migrations"); err != nil {
+		t.Fatal(err)
+	}
+	if m, ok := d.FindByIdentifier("foo", source.Up); !ok || !m.ModTime.Equal(modTime) {
+		t.Errorf("expected mod time %v, got %#v, %v", modTime, m, ok)
+	}
+}
+
+func TestReadDownIrreversible(t *testing.T) {
+	source.MgrFunctions["2_foobar.up.go"] = func(ctx context.Context, db interface{}) error { return nil }
+	source.MgrDownFunctions["2_foobar.up.go"] = source.IrreversibleMigration
+	defer delete(source.MgrFunctions, "2_foobar.up.go")
+	defer delete(source.MgrDownFunctions, "2_foobar.up.go")
+
+	d, err := iofs.New(fstest.MapFS{
+		"migrations/1_foobar.up.sql":   &fstest.MapFile{Data: []byte("ALTER TABLE foo DROP COLUMN bar;")},
+		"migrations/1_foobar.down.sql": &fstest.MapFile{Data: []byte("-- irreversible\n")},
+		"migrations/2_foobar.up.go":    &fstest.MapFile{},
+		"migrations/3_foobar.up.sql":   &fstest.MapFile{Data: []byte("3 up")},
+		"migrations/3_foobar.down.sql": &fstest.MapFile{Data: []byte("-- irreversible? not quite\n")},
+	}, "migrations")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, version := range []uint{1, 2} {
+		if _, _, _, _, err := d.ReadDown(version); !errors.Is(err, source.ErrIrreversibleMigration) {
+			t.Errorf("expected %v for version %v, got %v", source.ErrIrreversibleMigration, version, err)
+		}
+	}
+	r, _, _, _, err := d.ReadDown(3)
+	if err != nil {
+		t.Fatalf("expected version 3 to be reversible, got %v", err)
+	}
+	r.Close()
+}
+
+func TestMissingVersions(t *testing.T) {
+	d, err := iofs.New(fstest.MapFS{
+		"migrations/1_foobar.up.sql": &fstest.MapFile{Data: []byte("1 up")},
+		"migrations/2_foobar.up.sql": &fstest.MapFile{Data: []byte("2 up")},
+		"migrations/4_foobar.up.sql": &fstest.MapFile{Data: []byte("4 up")},
+	}, "migrations")
+	if err != nil {
+		t.Fatal(err)
+	}
+	mv := d.(interface{ MissingVersions(start, step uint) []uint })
+	if missing := mv.MissingVersions(1, 1); len(missing) != 1 || missing[0] != 3 {
+		t.Errorf("expected [3], got %v", missing)
+	}
+}
+
+func TestComputeChecksums(t *testing.T) {
+	source.MgrFunctions["2_checksum.up.go"] = func(ctx context.Context, db interface{}) error { return nil }
+	defer delete(source.MgrFunctions, "2_checksum.up.go")
+
+	fsys := fstest.MapFS{
+		"migrations/1_checksum.up.sql":   &fstest.MapFile{Data: []byte("CREATE TABLE foo (id int);")},
+		"migrations/1_checksum.down.sql": &fstest.MapFile{Data: []byte("DROP TABLE foo;")},
+		"migrations/2_checksum.up.go":    &fstest.MapFile{Data: []byte("package migrations")},
+		"migrations/3_checksum.up.sql":   &fstest.MapFile{Data: []byte("CREATE TABLE foo (id int);")},
+	}
+	checksums := func() map[string]string {
+		d, err := iofs.New(fsys, "migrations")
+		if err != nil {
+			t.Fatal(err)
+		}
+		cs := d.(interface {
+			ComputeChecksums() error
+			SummaryJSON(dir source.Direction) ([]byte, error)
+		})
+		if err := cs.ComputeChecksums(); err != nil {
+			t.Fatal(err)
+		}
+		sums := make(map[string]string)
+		for _, dir := range []source.Direction{source.Up, source.Down} {
+			b, err := cs.SummaryJSON(dir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var entries []source.SummaryEntry
+			if err := json.Unmarshal(b, &entries); err != nil {
+				t.Fatal(err)
+			}
+			for _, e := range entries {
+				sums[e.Raw] = e.Checksum
+			}
+		}
+		return sums
+	}
+
+	before := checksums()
+	if before["migrations/1_checksum.up.sql"] == "" || before["migrations/1_checksum.down.sql"] == "" {
+		t.Fatalf("expected checksums for sql migrations, got %v", before)
+	}
+	if before["migrations/1_checksum.up.sql"] != before["migrations/3_checksum.up.sql"] {
+		t.Errorf("expected identical content to have identical checksums, got %v", before)
+	}
+	if sum, ok := before["migrations/2_checksum.up.go"]; !ok || sum != "" {
+		t.Errorf("expected empty checksum for go migration, got %q, %v", sum, ok)
+	}
+
+	fsys["migrations/1_checksum.up.sql"] = &fstest.MapFile{Data: []byte("CREATE TABLE foo (id bigint);")}
+	after := checksums()
+	if after["migrations/1_checksum.up.sql"] == before["migrations/1_checksum.up.sql"] {
+		t.Error("expected edited migration to change its checksum")
+	}
+	if after["migrations/1_checksum.down.sql"] != before["migrations/1_checksum.down.sql"] {
+		t.Error("expected unchanged migration to keep its checksum")
+	}
+}
+
+// blockingFS serves files whose reads block until the context of the read
+// is done.
+type blockingFS struct {
+	fstest.MapFS
+}
+
+func (f blockingFS) Open(name string) (stdfs.File, error) {
+	file, err := f.MapFS.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	return &blockingFile{File: file}, nil
+}
+
+type blockingFile struct {
+	stdfs.File
+}
+
+func (f *blockingFile) ReadContext(ctx context.Context, p []byte) (int, error) {
+	<-ctx.Done()
+	return 0, ctx.Err()
+}
+
+func TestReadCtx(t *testing.T) {
+	d, err := iofs.New(blockingFS{fstest.MapFS{
+		"migrations/1_foobar.up.sql":   &fstest.MapFile{Data: []byte("1 up")},
+		"migrations/1_foobar.down.sql": &fstest.MapFile{Data: []byte("1 down")},
+	}}, "migrations")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rd := d.(interface {
+		ReadUpCtx(ctx context.Context, version uint) (io.ReadCloser, string, string, source.MigrationFunc, error)
+		ReadDownCtx(ctx context.Context, version uint) (io.ReadCloser, string, string, source.MigrationFunc, error)
+	})
+
+	t.Run("cancelled before open", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		if _, _, _, _, err := rd.ReadUpCtx(ctx, 1); !errors.Is(err, context.Canceled) {
+			t.Errorf("expected %v, got %v", context.Canceled, err)
+		}
+		if _, _, _, _, err := rd.ReadDownCtx(ctx, 1); !errors.Is(err, context.Canceled) {
+			t.Errorf("expected %v, got %v", context.Canceled, err)
+		}
+	})
+
+	t.Run("cancelled while reading", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		r, _, _, _, err := rd.ReadUpCtx(ctx, 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer r.Close()
+
+		done := make(chan error, 1)
+		go func() {
+			_, err := ioutil.ReadAll(r)
+			done <- err
+		}()
+		select {
+		case err := <-done:
+			t.Fatalf("expected read to block until cancelled, got %v", err)
+		case <-time.After(10 * time.Millisecond):
+		}
+		cancel()
+		select {
+		case err := <-done:
+			if !errors.Is(err, context.Canceled) {
+				t.Errorf("expected %v, got %v", context.Canceled, err)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("read not cancelled")
+		}
+	})
+
+	t.Run("deadline exceeded", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+		r, _, _, _, err := rd.ReadDownCtx(ctx, 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer r.Close()
+		if _, err := ioutil.ReadAll(r); !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("expected %v, got %v", context.DeadlineExceeded, err)
+		}
+	})
+}
@@ -0,0 +1,43 @@
+package source
+
+import (
+	"fmt"
+	"sync"
+)
+
+// Logger receives the messages the source package prints, e.g. when
+// PrintSummary fails to write the summary.
+type Logger interface {
+	Printf(format string, args ...interface{})
+}
+
+// stdLogger prints to stdout with fmt.Printf.
+type stdLogger struct{}
+
+func (stdLogger) Printf(format string, args ...interface{}) {
+	fmt.Printf(format, args...)
+}
+
+var (
+	loggerMu sync.RWMutex
+	logger   Logger = stdLogger{}
+)
+
+// SetLogger routes the messages of the source package to l, e.g. to
+// integrate them with a structured logger. A nil l restores the default,
+// which prints to stdout.
+func SetLogger(l Logger) {
+	if l == nil {
+		l = stdLogger{}
+	}
+	loggerMu.Lock()
+	defer loggerMu.Unlock()
+	logger = l
+}
+
+func logf(format string, args ...interface{}) {
+	loggerMu.RLock()
+	l := logger
+	loggerMu.RUnlock()
+	l.Printf(format, args...)
+}
@@ -0,0 +1,38 @@
+package source
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+type captureLogger []string
+
+func (c *captureLogger) Printf(format string, args ...interface{}) {
+	*c = append(*c, fmt.Sprintf(format, args...))
+}
+
+func TestSetLogger(t *testing.T) {
+	var logged captureLogger
+	SetLogger(&logged)
+	defer SetLogger(nil)
+
+	// a closed stdout makes writing the summary fail
+	f, err := os.Create(filepath.Join(t.TempDir(), "stdout"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+	defer func(stdout *os.File) { os.Stdout = stdout }(os.Stdout)
+	os.Stdout = f
+
+	i := NewMigrations()
+	i.Append(&Migration{Version: 1, Direction: Up, Raw: "1_foo.up.sql"})
+	i.PrintSummary(Up)
+
+	if len(logged) != 1 || !strings.HasPrefix(logged[0], "error in closing formatter: ") {
+		t.Errorf("expected the flush error to be logged, got %q", logged)
+	}
+}
@@ -0,0 +1,187 @@
+// Package memory provides a source driver that holds migration bodies and
+// go migration functions in memory. It is meant for testing code built on
+// top of source.Driver.
+//
+//  d := memory.New().
+//  	Add(1, source.Up, "CREATE TABLE users (id int);").
+//  	Add(1, source.Down, "DROP TABLE users;").
+//  	AddFunc(2, source.Up, seedUsers)
+package memory
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+
+	"github.com/nokia/migrate/v4/source"
+)
+
+func init() {
+	source.Register("memory", &Memory{})
+}
+
+type entry struct {
+	Body string
+	Fn   source.MigrationFunc
+}
+
+// Memory is an in memory source driver. Migrations are added with Add and
+// AddFunc.
+type Memory struct {
+	migrations *source.Migrations
+	entries    map[uint]map[source.Direction]entry
+}
+
+// New returns an empty Memory driver.
+func New() *Memory {
+	return &Memory{
+		migrations: source.NewMigrations(),
+		entries:    make(map[uint]map[source.Direction]entry),
+	}
+}
+
+// Open is part of source.Driver interface implementation.
+// It returns a new, empty Memory driver.
+func (m *Memory) Open(url string) (source.Driver, error) {
+	return New(), nil
+}
+
+// Add adds a migration with body for version and direction, replacing
+// any migration added before for both.
+func (m *Memory) Add(version uint, dir source.Direction, body string) *Memory {
+	return m.add(version, dir, entry{Body: body})
+}
+
+// AddFunc adds a go migration function for version and direction,
+// replacing any migration added before for both.
+func (m *Memory) AddFunc(version uint, dir source.Direction, fn source.MigrationFunc) *Memory {
+	return m.add(version, dir, entry{Fn: fn})
+}
+
+func (m *Memory) add(version uint, dir source.Direction, e entry) *Memory {
+	if m.entries[version] == nil {
+		m.entries[version] = make(map[source.Direction]entry)
+	}
+	m.entries[version][dir] = e
+	m.migrations.Append(&source.Migration{
+		Version:    version,
+		Identifier: fmt.Sprintf("%v.%v.memory", version, dir),
+		Direction:  dir,
+		Raw:        fmt.Sprintf("%v.%v.memory", version, dir),
+		Status:     source.Pending,
+	})
+	return m
+}
+
+// Close is part of source.Driver interface implementation. This is a no-op.
+func (m *Memory) Close() error {
+	return nil
+}
+
+// First is part of source.Driver interface implementation.
+func (m *Memory) First() (version uint, err error) {
+	if v, ok := m.migrations.First(); ok {
+		return v, nil
+	}
+	return 0, &os.PathError{Op: "first", Path: "memory", Err: os.ErrNotExist}
+}
+
+// Prev is part of source.Driver interface implementation.
+func (m *Memory) Prev(version uint) (prevVersion uint, err error) {
+	if v, ok := m.migrations.Prev(version); ok {
+		return v, nil
+	}
+	return 0, &os.PathError{Op: fmt.Sprintf("prev for version %v", version), Path: "memory", Err: os.ErrNotExist}
+}
+
+// Next is part of source.Driver interface implementation.
+func (m *Memory) Next(version uint) (nextVersion uint, err error) {
+	if v, ok := m.migrations.Next(version); ok {
+		return v, nil
+	}
+	return 0, &os.PathError{Op: fmt.Sprintf("next for version %v", version), Path: "memory", Err: os.ErrNotExist}
+}
+
+// ReadUp is part of source.Driver interface implementation.
+func (m *Memory) ReadUp(version uint) (r io.ReadCloser, identifier string, location string, fn source.MigrationFunc, err error) {
+	return m.read(version, source.Up)
+}
+
+// ReadDown is part of source.Driver interface implementation.
+func (m *Memory) ReadDown(version uint) (r io.ReadCloser, identifier string, location string, fn source.MigrationFunc, err error) {
+	return m.read(version, source.Down)
+}
+
+func (m *Memory) read(version uint, dir source.Direction) (io.ReadCloser, string, string, source.MigrationFunc, error) {
+	e, ok := m.entries[version][dir]
+	if !ok {
+		return nil, "", "", nil, &os.PathError{Op: fmt.Sprintf("read %v version %v", dir, version), Path: "memory", Err: os.ErrNotExist}
+	}
+	identifier := fmt.Sprintf("%v.%v.memory", version, dir)
+	if e.Fn != nil {
+		return nil, identifier, identifier, e.Fn, nil
+	}
+	return ioutil.NopCloser(bytes.NewBufferString(e.Body)), identifier, identifier, nil, nil
+}
+
+func (m *Memory) MarkSkipMigrations(version uint, dir source.Direction) {
+	m.migrations.MarkSkipMigrations(version, dir)
+}
+
+func (m *Memory) UpdateStatus(version uint, status source.Status, errstr string) {
+	m.migrations.UpdateStatus(version, status, errstr)
+}
+
+// UpdateStatusDir is like UpdateStatus, but only updates the migration of
+// direction dir.
+func (m *Memory) UpdateStatusDir(version uint, dir source.Direction, status source.Status, errstr string) {
+	m.migrations.UpdateStatusDir(version, dir, status, errstr)
+}
+
+func (m *Memory) PrintSummary(dir source.Direction) {
+	m.migrations.PrintSummary(dir)
+}
+
+// SummaryJSON returns the summary printed by PrintSummary as JSON.
+// See source.Migrations.SummaryJSON.
+func (m *Memory) SummaryJSON(dir source.Direction) ([]byte, error) {
+	return m.migrations.SummaryJSON(dir)
+}
+
+// ComputeChecksums reads every migration and records the SHA-256 of its
+// body, which is reported by SummaryJSON.
+func (m *Memory) ComputeChecksums() error {
+	return m.migrations.ComputeChecksums(m)
+}
+
+// Validate checks that every version has an up and a down migration, or
+// only an up migration if downOptional is set, see source.Migrations.Validate.
+func (m *Memory) Validate(downOptional bool) error {
+	return m.migrations.Validate(downOptional)
+}
+
+// Identifier returns the identifier of the migration of version in
+// direction dir without reading it.
+func (m *Memory) Identifier(version uint, dir source.Direction) (string, bool) {
+	return m.migrations.Identifier(version, dir)
+}
+
+// FindByIdentifier returns a copy of the first migration in direction dir
+// named identifier, see source.Migrations.FindByIdentifier.
+func (m *Memory) FindByIdentifier(identifier string, dir source.Direction) (*source.Migration, bool) {
+	return m.migrations.FindByIdentifier(identifier, dir)
+}
+
+// FindByIdentifierFold is like FindByIdentifier, but matches identifier
+// case insensitively.
+func (m *Memory) FindByIdentifierFold(identifier string, dir source.Direction) (*source.Migration, bool) {
+	return m.migrations.FindByIdentifierFold(identifier, dir)
+}
+
+// Walk calls fn with a copy of each migration of direction dir in the
+// order they would be applied, see source.Migrations.Walk.
+func (m *Memory) Walk(dir source.Direction, fn func(m *source.Migration) error) error {
+	return m.migrations.Walk(dir, fn)
+}
@@ -0,0 +1,73 @@
+package memory
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"testing"
+
+	"github.com/nokia/migrate/v4/source"
+	st "github.com/nokia/migrate/v4/source/testing"
+)
+
+func Test(t *testing.T) {
+	d := New().
+		Add(1, source.Up, "1 up").
+		Add(1, source.Down, "1 down").
+		Add(3, source.Up, "3 up").
+		Add(4, source.Up, "4 up").
+		Add(4, source.Down, "4 down").
+		Add(5, source.Down, "5 down").
+		Add(7, source.Up, "7 up").
+		Add(7, source.Down, "7 down")
+
+	st.Test(t, d)
+}
+
+func TestOpen(t *testing.T) {
+	d, err := source.Open("memory://")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := d.First(); err == nil {
+		t.Error("expected opened driver to be empty")
+	}
+}
+
+func TestReadBodyAndFunc(t *testing.T) {
+	errFn := errors.New("fn")
+	d := New().
+		Add(2, source.Up, "2 up").
+		AddFunc(1, source.Up, func(ctx context.Context, db interface{}) error { return errFn }).
+		Add(1, source.Down, "1 down")
+
+	if v, err := d.First(); err != nil || v != 1 {
+		t.Fatalf("expected first version 1, got %v, %v", v, err)
+	}
+
+	r, _, _, fn, err := d.ReadUp(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r != nil || fn == nil {
+		t.Fatal("expected migration function for version 1 up")
+	}
+	if err := fn(context.Background(), nil); err != errFn {
+		t.Errorf("expected %v, got %v", errFn, err)
+	}
+
+	r, _, _, fn, err = d.ReadDown(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fn != nil {
+		t.Error("expected body for version 1 down")
+	}
+	body, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(body) != "1 down" {
+		t.Errorf("expected %q, got %q", "1 down", body)
+	}
+}
@@ -2,12 +2,21 @@ package source
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
+	"reflect"
 	"runtime"
 	"sort"
+	"strings"
+	"sync"
 	"text/tabwriter"
+	"time"
 )
 
 // Direction is either up or down.
@@ -25,12 +34,54 @@ const (
 	Pending Status = "pending"
 	Done    Status = "done"
 	Failed  Status = "failed"
+	// Planned is recorded instead of Done by a Migrations in DryRun mode,
+	// for migrations that would have been applied.
+	Planned Status = "planned"
 )
 
+// ParseStatus returns the Status named s, ignoring case, e.g. when reading
+// a summary back from disk. Unknown statuses are an error.
+func ParseStatus(s string) (Status, error) {
+	status := Status(strings.ToLower(strings.TrimSpace(s)))
+	if !status.Valid() {
+		return "", fmt.Errorf("invalid status %q", s)
+	}
+	return status, nil
+}
+
+// Valid reports whether s is one of the known statuses.
+func (s Status) Valid() bool {
+	switch s {
+	case Skipped, Pending, Done, Failed, Planned:
+		return true
+	}
+	return false
+}
+
+// EmptyDownReason is reported for down migrations skipped because
+// their body is empty.
+const EmptyDownReason = "empty down, nothing to roll back"
+
+// IrreversibleMarker is the body of a down migration that marks the
+// migration as irreversible.
+const IrreversibleMarker = "-- irreversible"
+
 type MigrationFunc func(ctx context.Context, db interface{}) error
 
 var MgrFunctions = make(map[string]MigrationFunc) // map of filename and functions                           // current release
 
+// MgrDownFunctions holds the down counterparts of Go migration functions
+// registered with RegisterFuncMigrationWithDown, keyed by filename.
+var MgrDownFunctions = make(map[string]MigrationFunc)
+
+// versionFuncs holds the go migration functions registered with
+// RegisterFuncForVersion by version and direction.
+var versionFuncs = make(map[uint]map[Direction]MigrationFunc)
+
+// funcsMu guards MgrFunctions, MgrDownFunctions and versionFuncs against
+// registrations running concurrently with lookups.
+var funcsMu sync.RWMutex
+
 // Migration is a helper struct for source drivers that need to
 // build the full directory tree in memory.
 // Migration is fully independent from migrate.Migration.
@@ -45,6 +96,11 @@ type Migration struct {
 	// Direction is either Up or Down.
 	Direction Direction
 
+	// Description is Identifier made readable for display, e.g. "add user
+	// index" for add_user_index. Parse sets it, other parsers may leave it
+	// empty.
+	Description string
+
 	// Raw holds the raw location path to this migration in source.
 	// ReadUp and ReadDown will use this.
 	Raw string
@@ -53,13 +109,82 @@ type Migration struct {
 	Status Status
 
 	Error string
+
+	// Empty is set by source drivers for down migrations whose body
+	// holds nothing but whitespace.
+	Empty bool
+
+	// Irreversible is set by source drivers for down migrations whose
+	// body is IrreversibleMarker.
+	Irreversible bool
+
+	// Checksum is the hex encoded SHA-256 of the migration body, set by
+	// ComputeChecksums. It stays empty for go migrations, which have no
+	// body.
+	Checksum string
+
+	// Bytes is the size of the body the migration was last read with, set
+	// by source drivers counting bytes, see CountBytes. It stays zero for
+	// go migrations.
+	Bytes int64
+
+	// ModTime is the modification time of the migration file, set by
+	// source drivers that know it. It tells which of two migrations of
+	// the same version is newer, see ErrDuplicateMigration.
+	ModTime time.Time
+
+	// Parallel is set for migrations that don't depend on the migrations
+	// next to them, so they may run concurrently, see ParallelMarker.
+	Parallel bool
+
+	// Combined is set for migrations read from a section of a file
+	// holding both directions, see ParseCombined and Sections.
+	Combined bool
+
+	// labels restrict the migration to environments, e.g. prod-only.
+	// Parse reads them from the file name, see Regex. They are kept sorted
+	// and joined by commas so Migration stays comparable, see Labels.
+	labels string
+}
+
+// Labels returns the labels of m in ascending order, nil if m applies to
+// every environment.
+func (m Migration) Labels() []string {
+	if m.labels == "" {
+		return nil
+	}
+	return strings.Split(m.labels, ",")
 }
 
 // Migrations wraps Migration and has an internal index
 // to keep track of Migration order.
 type Migrations struct {
+	// DryRun makes UpdateStatus record Planned instead of Done, so the
+	// summary shows a plan rather than claiming the migrations ran.
+	DryRun bool
+
 	index      uintSlice
 	migrations map[uint]map[Direction]*Migration
+
+	// less orders the index if set, see SetLess.
+	less func(a, b *Migration) bool
+
+	// rejected holds the migrations AppendErr refused as duplicates, see
+	// Conflicts.
+	rejected []Migration
+
+	// onStatusChange is called with a copy of every migration whose
+	// status is changed.
+	onStatusChange func(m Migration)
+
+	// preHook and postHook run around a batch of migrations, see
+	// SetPreHook and SetPostHook.
+	preHook, postHook MigrationFunc
+
+	// progress receives a copy of every migration whose status is
+	// changed, guarded by progressMu so it can be closed concurrently.
+	progressMu sync.Mutex
+	progress   chan Migration
 }
 
 func NewMigrations() *Migrations {
@@ -70,23 +195,93 @@ func NewMigrations() *Migrations {
 }
 
 func (i *Migrations) Append(m *Migration) (ok bool) {
+	return i.AppendErr(m) == nil
+}
+
+// AppendErr is like Append, but tells why m was rejected: ErrNilMigration
+// for a nil migration, or ErrDuplicateMigration naming the Raw of the
+// migration that already exists with the same version and direction.
+func (i *Migrations) AppendErr(m *Migration) error {
 	if m == nil {
-		return false
+		return ErrNilMigration
 	}
 
-	if i.migrations[m.Version] == nil {
-		i.migrations[m.Version] = make(map[Direction]*Migration)
+	// reject duplicate versions
+	if existing, dup := i.migrations[m.Version][m.Direction]; dup {
+		i.rejected = append(i.rejected, *m)
+		return ErrDuplicateMigration{Migration: *m, ExistingRaw: existing.Raw, ExistingModTime: existing.ModTime}
 	}
 
-	// reject duplicate versions
-	if _, dup := i.migrations[m.Version][m.Direction]; dup {
-		return false
+	added := i.migrations[m.Version] == nil
+	if added {
+		i.migrations[m.Version] = make(map[Direction]*Migration)
 	}
 
 	i.migrations[m.Version][m.Direction] = m
+
+	switch {
+	case added:
+		i.insertIndex(m.Version)
+	case i.less != nil && m.Direction == Up:
+		// m replaces the down migration in the comparisons of SetLess
+		i.removeIndex(m.Version)
+		i.insertIndex(m.Version)
+	}
+
+	return nil
+}
+
+// SetLess orders the versions by less instead of ascending, e.g. by
+// identifier or ModTime. less is called with the up migration of each
+// version, or the down migration if it has none; versions it considers
+// equal stay in ascending order. First, Next, Prev, Walk and the summary
+// follow the new order. Finding the position of a version is linear
+// instead of logarithmic then. A nil less restores the ascending order.
+func (i *Migrations) SetLess(less func(a, b *Migration) bool) {
+	i.less = less
 	i.buildIndex()
+}
+
+// lessVersion reports whether version a is ordered before version b.
+func (i *Migrations) lessVersion(a, b uint) bool {
+	if i.less == nil {
+		return a < b
+	}
+	ma, mb := i.orderedBy(a), i.orderedBy(b)
+	if i.less(ma, mb) {
+		return true
+	}
+	if i.less(mb, ma) {
+		return false
+	}
+	return a < b
+}
+
+// orderedBy returns the migration of version passed to less.
+func (i *Migrations) orderedBy(version uint) *Migration {
+	if m, ok := i.migrations[version][Up]; ok {
+		return m
+	}
+	return i.migrations[version][Down]
+}
+
+// insertIndex adds the new version to the sorted index. Shifting the
+// greater versions is linear, while rebuilding and sorting the index on
+// every append made loading n migrations O(n² log n).
+func (i *Migrations) insertIndex(version uint) {
+	pos := sort.Search(len(i.index), func(x int) bool {
+		return !i.lessVersion(i.index[x], version)
+	})
+	i.index = append(i.index, 0)
+	copy(i.index[pos+1:], i.index[pos:])
+	i.index[pos] = version
+}
 
-	return true
+// removeIndex removes version from the index.
+func (i *Migrations) removeIndex(version uint) {
+	if pos := i.findPos(version); pos >= 0 {
+		i.index = append(i.index[:pos], i.index[pos+1:]...)
+	}
 }
 
 func (i *Migrations) buildIndex() {
@@ -95,10 +290,57 @@ func (i *Migrations) buildIndex() {
 		i.index = append(i.index, version)
 	}
 	sort.Slice(i.index, func(x, y int) bool {
-		return i.index[x] < i.index[y]
+		return i.lessVersion(i.index[x], i.index[y])
 	})
 }
 
+// Versions returns all known versions in ascending order, or in the order
+// set by SetLess.
+// The returned slice is a copy and may be modified by the caller.
+func (i *Migrations) Versions() []uint {
+	versions := make([]uint, len(i.index))
+	copy(versions, i.index)
+	return versions
+}
+
+// DownOrder returns all known versions in descending order, or in the
+// reverse of the order set by SetLess, the order a rollback visits them.
+// The returned slice is a copy and may be modified by the caller.
+func (i *Migrations) DownOrder() []uint {
+	versions := make([]uint, len(i.index))
+	for n, version := range i.index {
+		versions[len(versions)-1-n] = version
+	}
+	return versions
+}
+
+// MissingVersions returns the versions start, start+step, start+2*step, ...
+// up to the highest known version that have no migration. It assumes the
+// versions are meant to form such a sequence, so it is only meaningful for
+// sequential numbering, not for sparse e.g. timestamp based versions.
+// A step of 0 returns nil.
+func (i *Migrations) MissingVersions(start, step uint) []uint {
+	if len(i.index) == 0 || step == 0 {
+		return nil
+	}
+	last := i.index[0]
+	for _, version := range i.index {
+		if version > last {
+			last = version
+		}
+	}
+	var missing []uint
+	for v := start; v <= last; v += step {
+		if _, ok := i.migrations[v]; !ok {
+			missing = append(missing, v)
+		}
+		if v+step < v {
+			break // overflow
+		}
+	}
+	return missing
+}
+
 func (i *Migrations) First() (version uint, ok bool) {
 	if len(i.index) == 0 {
 		return 0, false
@@ -106,6 +348,15 @@ func (i *Migrations) First() (version uint, ok bool) {
 	return i.index[0], true
 }
 
+// Last returns the highest known version, or the last one in the order
+// set by SetLess.
+func (i *Migrations) Last() (version uint, ok bool) {
+	if len(i.index) == 0 {
+		return 0, false
+	}
+	return i.index[len(i.index)-1], true
+}
+
 func (i *Migrations) Prev(version uint) (prevVersion uint, ok bool) {
 	pos := i.findPos(version)
 	if pos >= 1 && len(i.index) > pos-1 {
@@ -122,6 +373,62 @@ func (i *Migrations) Next(version uint) (nextVersion uint, ok bool) {
 	return 0, false
 }
 
+// FirstDir is like First, but returns the lowest version that has a
+// migration in direction dir.
+func (i *Migrations) FirstDir(dir Direction) (version uint, ok bool) {
+	return i.nextDir(0, dir)
+}
+
+// NextDir is like Next, but skips the versions without a migration in
+// direction dir. It returns false if version is unknown.
+func (i *Migrations) NextDir(version uint, dir Direction) (nextVersion uint, ok bool) {
+	pos := i.findPos(version)
+	if pos < 0 {
+		return 0, false
+	}
+	return i.nextDir(pos+1, dir)
+}
+
+// nextDir returns the first version from position pos of the index on
+// that has a migration in direction dir.
+func (i *Migrations) nextDir(pos int, dir Direction) (uint, bool) {
+	for ; pos < len(i.index); pos++ {
+		if _, ok := i.migrations[i.index[pos]][dir]; ok {
+			return i.index[pos], true
+		}
+	}
+	return 0, false
+}
+
+// PeekNext returns a copy of the migration in direction dir of the version
+// following version. It returns false if version is the last one or
+// unknown, or if the following version has no migration in direction dir.
+func (i *Migrations) PeekNext(version uint, dir Direction) (*Migration, bool) {
+	next, ok := i.Next(version)
+	if !ok {
+		return nil, false
+	}
+	return i.peek(next, dir)
+}
+
+// PeekPrev is like PeekNext for the version preceding version.
+func (i *Migrations) PeekPrev(version uint, dir Direction) (*Migration, bool) {
+	prev, ok := i.Prev(version)
+	if !ok {
+		return nil, false
+	}
+	return i.peek(prev, dir)
+}
+
+func (i *Migrations) peek(version uint, dir Direction) (*Migration, bool) {
+	m, ok := i.migrations[version][dir]
+	if !ok {
+		return nil, false
+	}
+	mc := *m
+	return &mc, true
+}
+
 func (i *Migrations) Up(version uint) (m *Migration, ok bool) {
 	if _, ok := i.migrations[version]; ok {
 		if mx, ok := i.migrations[version][Up]; ok {
@@ -140,7 +447,69 @@ func (i *Migrations) Down(version uint) (m *Migration, ok bool) {
 	return nil, false
 }
 
+// Identifier returns the Identifier of the migration of version in
+// direction dir, without reading it.
+func (i *Migrations) Identifier(version uint, dir Direction) (string, bool) {
+	if _, ok := i.migrations[version]; ok {
+		if m, ok := i.migrations[version][dir]; ok {
+			return m.Identifier, true
+		}
+	}
+	return "", false
+}
+
+// FindByIdentifier returns a copy of the first migration in direction dir,
+// in version order, whose Identifier is identifier.
+func (i *Migrations) FindByIdentifier(identifier string, dir Direction) (*Migration, bool) {
+	return i.find(dir, func(m *Migration) bool { return m.Identifier == identifier })
+}
+
+// FindByIdentifierFold is like FindByIdentifier, but matches identifier
+// case insensitively.
+func (i *Migrations) FindByIdentifierFold(identifier string, dir Direction) (*Migration, bool) {
+	return i.find(dir, func(m *Migration) bool { return strings.EqualFold(m.Identifier, identifier) })
+}
+
+func (i *Migrations) find(dir Direction, match func(m *Migration) bool) (*Migration, bool) {
+	for _, version := range i.index {
+		if m, ok := i.migrations[version][dir]; ok && match(m) {
+			mc := *m
+			return &mc, true
+		}
+	}
+	return nil, false
+}
+
+// IsEmptyDown reports whether the down migration of version is flagged
+// as Empty.
+func (i *Migrations) IsEmptyDown(version uint) bool {
+	m, ok := i.Down(version)
+	return ok && m.Empty
+}
+
+// EmptyDownReporter is implemented by source drivers that detect blank
+// down migrations while loading. It is an optional method of source
+// drivers, checked with a type assertion, see IsEmptyDown.
+type EmptyDownReporter interface {
+	IsEmptyDown(version uint) bool
+}
+
+// IsEmptyDown reports whether d flags the down migration of version as
+// empty, false if d is not an EmptyDownReporter.
+func IsEmptyDown(d Driver, version uint) bool {
+	ed, ok := d.(EmptyDownReporter)
+	return ok && ed.IsEmptyDown(version)
+}
+
 func (i *Migrations) findPos(version uint) int {
+	if i.less != nil {
+		for pos, v := range i.index {
+			if v == version {
+				return pos
+			}
+		}
+		return -1
+	}
 	if len(i.index) > 0 {
 		ix := i.index.Search(version)
 		if ix < len(i.index) && i.index[ix] == version {
@@ -150,48 +519,709 @@ func (i *Migrations) findPos(version uint) int {
 	return -1
 }
 
+// OnStatusChange registers fn to be called whenever the status of a
+// migration changes through UpdateStatus or MarkSkipMigrations.
+// fn receives a copy of the migration. Passing nil removes the callback.
+func (i *Migrations) OnStatusChange(fn func(m Migration)) {
+	i.onStatusChange = fn
+}
+
+// ProgressChan returns a channel receiving a copy of every migration whose
+// status changes, like the callback of OnStatusChange, e.g. to drive a
+// progress bar. Up to buffer changes are queued, further ones are dropped
+// until the receiver catches up, so a slow receiver never blocks the
+// migrations. A channel returned before is closed and replaced.
+func (i *Migrations) ProgressChan(buffer int) <-chan Migration {
+	i.progressMu.Lock()
+	defer i.progressMu.Unlock()
+	if i.progress != nil {
+		close(i.progress)
+	}
+	i.progress = make(chan Migration, buffer)
+	return i.progress
+}
+
+// CloseProgress closes the channel returned by ProgressChan once the
+// migrations are done, ending a range over it. No further changes are
+// sent.
+func (i *Migrations) CloseProgress() {
+	i.progressMu.Lock()
+	defer i.progressMu.Unlock()
+	if i.progress != nil {
+		close(i.progress)
+		i.progress = nil
+	}
+}
+
+func (i *Migrations) setStatus(m *Migration, status Status, errstr string) {
+	changed := m.Status != status
+	m.Status = status
+	m.Error = errstr
+	if !changed {
+		return
+	}
+	if i.onStatusChange != nil {
+		i.onStatusChange(*m)
+	}
+	i.progressMu.Lock()
+	defer i.progressMu.Unlock()
+	if i.progress != nil {
+		select {
+		case i.progress <- *m:
+		default:
+		}
+	}
+}
+
 func (i *Migrations) MarkSkipMigrations(version uint, dir Direction) {
+	i.markSkip(version, dir, true)
+}
+
+// MarkSkipMigrationsExclusive is like MarkSkipMigrations, but leaves the
+// migration of version itself as it is, so only the versions below it for
+// Up or above it for Down are marked as skipped.
+func (i *Migrations) MarkSkipMigrationsExclusive(version uint, dir Direction) {
+	i.markSkip(version, dir, false)
+}
+
+// markSkip marks the migrations of direction dir up to version for Up or
+// from version on for Down as skipped, version itself only if inclusive
+// is set.
+func (i *Migrations) markSkip(version uint, dir Direction, inclusive bool) {
 	for idx := range i.index {
-		if dir == Up && i.index[idx] <= version {
+		v := i.index[idx]
+		m, ok := i.migrations[v][dir]
+		if !ok {
+			continue
+		}
+		if v == version && !inclusive {
+			continue
+		}
+		if dir == Up && v <= version {
 			// mark all older version as skipped.
-			i.migrations[i.index[idx]][dir].Status = Skipped
-		} else if dir == Down && i.index[idx] >= version {
+			i.setStatus(m, Skipped, m.Error)
+		} else if dir == Down && v >= version {
 			// mark all newer version as skipped.
-			i.migrations[i.index[idx]][dir].Status = Skipped
+			i.setStatus(m, Skipped, m.Error)
 		}
 	}
 }
 
+// UpdateStatus sets status and errstr of the migrations of version in
+// both directions. Use UpdateStatusDir to update a single direction.
 func (i *Migrations) UpdateStatus(version uint, status Status, errstr string) {
-	if _, ok := i.migrations[version]; ok {
-		if mx, ok := i.migrations[version][Up]; ok {
-			mx.Status = status
-			mx.Error = errstr
+	i.UpdateStatusDir(version, Up, status, errstr)
+	i.UpdateStatusDir(version, Down, status, errstr)
+}
+
+// UpdateStatusDir sets status and errstr of the migration of version in
+// direction dir only.
+func (i *Migrations) UpdateStatusDir(version uint, dir Direction, status Status, errstr string) {
+	if i.DryRun && status == Done {
+		status = Planned
+	}
+	if m, ok := i.migrations[version][dir]; ok {
+		i.setStatus(m, status, errstr)
+	}
+}
+
+// StatusDirUpdater is implemented by source drivers that track the status
+// of up and down migrations separately. It is an optional method of source
+// drivers, checked with a type assertion, see UpdateStatusDir.
+type StatusDirUpdater interface {
+	UpdateStatusDir(version uint, dir Direction, status Status, errstr string)
+}
+
+// UpdateStatusDir records status and errstr for the migration of version in
+// direction dir with d, or for both directions of version if d is not a
+// StatusDirUpdater.
+func UpdateStatusDir(d Driver, version uint, dir Direction, status Status, errstr string) {
+	if sd, ok := d.(StatusDirUpdater); ok {
+		sd.UpdateStatusDir(version, dir, status, errstr)
+		return
+	}
+	d.UpdateStatus(version, status, errstr)
+}
+
+// ApplyHistory sets the status of the migrations of direction dir from the
+// versions applied to a database: Done for the versions in applied and
+// Pending for the rest. Applied versions without a migration in direction
+// dir are ignored. Unlike UpdateStatus, DryRun doesn't turn Done into
+// Planned, as the history is not a plan.
+func (i *Migrations) ApplyHistory(applied []uint, dir Direction) {
+	done := make(map[uint]bool, len(applied))
+	for _, version := range applied {
+		done[version] = true
+	}
+	for _, version := range i.index {
+		m, ok := i.migrations[version][dir]
+		if !ok {
+			continue
 		}
-		if mx, ok := i.migrations[version][Down]; ok {
-			mx.Status = status
-			mx.Error = errstr
+		if done[version] {
+			i.setStatus(m, Done, "")
+		} else {
+			i.setStatus(m, Pending, "")
+		}
+	}
+}
+
+// Conflicts returns the versions, in ascending order, of which a migration
+// was rejected by Append or AppendErr because its version and direction
+// were already taken, e.g. by two files with different identifiers. It
+// tells about duplicates even if the error of AppendErr was ignored.
+func (i *Migrations) Conflicts() []uint {
+	seen := make(map[uint]bool)
+	var versions []uint
+	for _, m := range i.rejected {
+		if !seen[m.Version] {
+			seen[m.Version] = true
+			versions = append(versions, m.Version)
+		}
+	}
+	sort.Slice(versions, func(x, y int) bool {
+		return versions[x] < versions[y]
+	})
+	return versions
+}
+
+// Pending returns the versions whose migration of direction dir is
+// Pending, in the order they would be applied, see Walk. Together with
+// ApplyHistory it yields the migrations left to run. Versions without a
+// migration in direction dir are left out.
+func (i *Migrations) Pending(dir Direction) []uint {
+	var versions []uint
+	i.Walk(dir, func(m *Migration) error {
+		if m.Status == Pending {
+			versions = append(versions, m.Version)
+		}
+		return nil
+	})
+	return versions
+}
+
+// Counts returns how many migrations of direction dir are in each status.
+// Versions without a migration in direction dir are not counted.
+func (i *Migrations) Counts(dir Direction) map[Status]int {
+	counts := make(map[Status]int)
+	for _, version := range i.index {
+		if m, ok := i.migrations[version][dir]; ok {
+			counts[m.Status]++
+		}
+	}
+	return counts
+}
+
+// HasFailures reports whether a migration in either direction has failed.
+func (i *Migrations) HasFailures() bool {
+	for _, version := range i.index {
+		for _, m := range i.migrations[version] {
+			if m.Status == Failed {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Validate checks that every version has an up and a down migration. If
+// downOptional is set, versions without a down migration are accepted.
+// All offending versions are reported as ErrMissingDirection in an
+// ErrInvalidMigrations.
+func (i *Migrations) Validate(downOptional bool) error {
+	var errs ErrInvalidMigrations
+	for _, version := range i.index {
+		if _, ok := i.migrations[version][Up]; !ok {
+			errs = append(errs, ErrMissingDirection{Version: version, Direction: Up})
+		}
+		if _, ok := i.migrations[version][Down]; !ok && !downOptional {
+			errs = append(errs, ErrMissingDirection{Version: version, Direction: Down})
+		}
+	}
+	if len(errs) == 0 {
+		return nil
+	}
+	return errs
+}
+
+// Reset sets every migration in both directions back to Pending and
+// clears its error, so the same Migrations can be used for another run.
+func (i *Migrations) Reset() {
+	for _, version := range i.index {
+		for _, m := range i.migrations[version] {
+			i.setStatus(m, Pending, "")
 		}
 	}
 }
 
 func (i *Migrations) PrintSummary(dir Direction) {
+	if err := i.PrintSummaryTo(os.Stdout, dir); err != nil {
+		logf("error in closing formatter: %v\n", err)
+	}
+}
+
+// PrintSummaryTo writes the summary of the migrations in the given
+// direction to out. Versions without a migration in that direction are
+// listed as <none>.
+func (i *Migrations) PrintSummaryTo(out io.Writer, dir Direction) error {
+	return i.PrintSummaryWith(out, dir, SummaryOptions{})
+}
+
+// SummaryFormat holds the tabwriter.Writer settings used to align the
+// columns of the summary, see tabwriter.Writer.Init.
+type SummaryFormat struct {
+	MinWidth int
+	TabWidth int
+	Padding  int
+	PadChar  byte
+	Flags    uint
+}
+
+var (
+	// DefaultSummaryFormat aligns the columns with tabs.
+	DefaultSummaryFormat = SummaryFormat{MinWidth: 8, TabWidth: 8, Padding: 0, PadChar: '\t'}
+	// CompactSummaryFormat aligns the columns with a single space between
+	// them, for terminals that don't render tabs well.
+	CompactSummaryFormat = SummaryFormat{MinWidth: 0, TabWidth: 8, Padding: 1, PadChar: ' '}
+	// WideSummaryFormat aligns the columns with spaces, leaving room
+	// between them for long migration paths.
+	WideSummaryFormat = SummaryFormat{MinWidth: 16, TabWidth: 8, Padding: 4, PadChar: ' '}
+)
+
+// SummaryOptions select and order the rows of PrintSummaryWith.
+type SummaryOptions struct {
+	// Format defaults to DefaultSummaryFormat.
+	Format *SummaryFormat
+	// GroupByStatus lists failed migrations first, followed by pending,
+	// planned, skipped and done ones and finally any other status, each
+	// group ordered by version.
+	GroupByStatus bool
+	// Only restricts the summary to migrations in one of the statuses.
+	Only []Status
+	// Description adds a column with the Description of each migration.
+	Description bool
+}
+
+// summaryGroups is the order of the groups of SummaryOptions.GroupByStatus.
+var summaryGroups = []Status{Failed, Pending, Planned, Skipped, Done}
+
+// PrintSummaryWith is like PrintSummaryTo, but only writes the migrations
+// selected by opts, formatted as opts say. Versions without a migration in
+// direction dir are only listed as <none> if no migrations are filtered or
+// grouped, as they have no status.
+func (i *Migrations) PrintSummaryWith(out io.Writer, dir Direction, opts SummaryOptions) error {
+	format := DefaultSummaryFormat
+	if opts.Format != nil {
+		format = *opts.Format
+	}
 	w := new(tabwriter.Writer)
-	w.Init(os.Stdout, 8, 8, 0, '\t', 0)
+	w.Init(out, format.MinWidth, format.TabWidth, format.Padding, format.PadChar, format.Flags)
+	row := func(source, description string, status Status, errstr string) {
+		if opts.Description {
+			fmt.Fprintf(w, "\t%s\t%s\t%s\t%s\t\n", source, description, status, errstr)
+		} else {
+			fmt.Fprintf(w, "\t%s\t%s\t%s\t\n", source, status, errstr)
+		}
+	}
 	fmt.Fprintf(w, "\n\t\t%s\n\n", "+++++ Migration Summary +++++")
-	fmt.Fprintf(w, "\t%s\t%s\t%s\t\n", "Migration Source", "Status", "Error")
-	fmt.Fprintf(w, "\t%s\t%s\t%s\t\n", "----------------", "------", "-----")
-	for idx := range i.index {
-		fmt.Fprintf(w, "\t%s\t%s\t%s\t\n",
-			i.migrations[i.index[idx]][dir].Raw,
-			i.migrations[i.index[idx]][dir].Status,
-			i.migrations[i.index[idx]][dir].Error)
+	row("Migration Source", "Description", "Status", "Error")
+	row("----------------", "-----------", "------", "-----")
+	if !opts.GroupByStatus && len(opts.Only) == 0 {
+		for idx := range i.index {
+			m, ok := i.migrations[i.index[idx]][dir]
+			if !ok {
+				row("<none>", "", "", "")
+				continue
+			}
+			row(m.Raw, m.Description, m.Status, m.Error)
+		}
+	} else {
+		selected := func(status Status) bool {
+			return len(opts.Only) == 0 || containsStatus(opts.Only, status)
+		}
+		groups := []func(Status) bool{selected}
+		if opts.GroupByStatus {
+			groups = nil
+			for _, group := range summaryGroups {
+				group := group
+				groups = append(groups, func(status Status) bool {
+					return status == group && selected(status)
+				})
+			}
+			// statuses of no group, e.g. unset ones, come last
+			groups = append(groups, func(status Status) bool {
+				return !containsStatus(summaryGroups, status) && selected(status)
+			})
+		}
+		for _, inGroup := range groups {
+			for _, version := range i.index {
+				m, ok := i.migrations[version][dir]
+				if ok && inGroup(m.Status) {
+					row(m.Raw, m.Description, m.Status, m.Error)
+				}
+			}
+		}
+	}
+
+	row("----------------", "-----------", "------", "-----")
+	return w.Flush()
+}
+
+func containsStatus(statuses []Status, status Status) bool {
+	for _, s := range statuses {
+		if s == status {
+			return true
+		}
+	}
+	return false
+}
+
+// SummaryEntry is the JSON representation of a migration in SummaryJSON.
+type SummaryEntry struct {
+	Version     uint      `json:"version"`
+	Direction   Direction `json:"direction"`
+	Identifier  string    `json:"identifier"`
+	Description string    `json:"description,omitempty"`
+	Raw         string    `json:"raw"`
+	Status      Status    `json:"status"`
+	Error       string    `json:"error,omitempty"`
+	Checksum    string    `json:"checksum,omitempty"`
+	Bytes       int64     `json:"bytes"`
+}
+
+// SummaryJSON returns the summary printed by PrintSummary as a JSON array
+// of SummaryEntry, ordered by version. Versions without a migration in
+// direction dir are left out.
+func (i *Migrations) SummaryJSON(dir Direction) ([]byte, error) {
+	entries := make([]SummaryEntry, 0, len(i.index))
+	for _, version := range i.index {
+		m, ok := i.migrations[version][dir]
+		if !ok {
+			continue
+		}
+		entries = append(entries, SummaryEntry{
+			Version:     m.Version,
+			Direction:   m.Direction,
+			Identifier:  m.Identifier,
+			Description: m.Description,
+			Raw:         m.Raw,
+			Status:      m.Status,
+			Error:       m.Error,
+			Checksum:    m.Checksum,
+			Bytes:       m.Bytes,
+		})
+	}
+	return json.Marshal(entries)
+}
+
+// LoadStatus restores the statuses and errors of a summary returned by
+// SummaryJSON, e.g. to resume after a crashed run without running the
+// migrations again that were done. Each entry sets the status of the
+// migration of its version and direction, entries without a status are
+// skipped. Entries of
+// migrations i doesn't have are ignored with a warning, as the migrations
+// may have changed since the summary was written. Nothing is restored if
+// data is not a summary or holds an invalid status. Like ApplyHistory,
+// DryRun doesn't turn a restored Done into Planned.
+func (i *Migrations) LoadStatus(data []byte) error {
+	var entries []SummaryEntry
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return fmt.Errorf("unable to read summary: %w", err)
+	}
+	for _, e := range entries {
+		if e.Status != "" && !e.Status.Valid() {
+			return fmt.Errorf("invalid status %q of %v migration %v in summary", e.Status, e.Direction, e.Version)
+		}
+	}
+	for _, e := range entries {
+		if e.Status == "" {
+			continue
+		}
+		m, ok := i.migrations[e.Version][e.Direction]
+		if !ok {
+			logf("ignoring status of unknown %v migration %v in summary\n", e.Direction, e.Version)
+			continue
+		}
+		i.setStatus(m, e.Status, e.Error)
+	}
+	return nil
+}
+
+// MigrationReader reads the body of migrations, every source driver
+// implements it.
+type MigrationReader interface {
+	ReadUp(version uint) (r io.ReadCloser, identifier string, location string, fn MigrationFunc, err error)
+	ReadDown(version uint) (r io.ReadCloser, identifier string, location string, fn MigrationFunc, err error)
+}
+
+// ComputeChecksums reads every migration with r and sets its Checksum.
+// Go migrations and irreversible down migrations have no body to hash,
+// their Checksum is left empty.
+func (i *Migrations) ComputeChecksums(r MigrationReader) error {
+	for _, version := range i.index {
+		for dir, m := range i.migrations[version] {
+			read := r.ReadUp
+			if dir == Down {
+				read = r.ReadDown
+			}
+			rc, _, _, fn, err := read(version)
+			if errors.Is(err, ErrIrreversibleMigration) {
+				m.Checksum = ""
+				continue
+			}
+			if err != nil {
+				return fmt.Errorf("unable to compute checksum of %v: %w", m.Raw, err)
+			}
+			if rc == nil {
+				m.Checksum = ""
+				continue
+			}
+			if fn != nil {
+				rc.Close()
+				m.Checksum = ""
+				continue
+			}
+			m.Checksum, err = Checksum(rc)
+			rc.Close()
+			if err != nil {
+				return fmt.Errorf("unable to compute checksum of %v: %w", m.Raw, err)
+			}
+		}
+	}
+	return nil
+}
+
+// Checksum returns the hex encoded SHA-256 of everything read from r.
+func Checksum(r io.Reader) (string, error) {
+	h := sha256.New()
+	if _, err := io.Copy(h, r); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// GroupBy returns the migrations of the given direction grouped by key.
+// Within each group migrations are ordered by version. The returned
+// migrations are copies, changing them does not affect i.
+func (i *Migrations) GroupBy(dir Direction, key func(*Migration) string) map[string][]*Migration {
+	groups := make(map[string][]*Migration)
+	for _, version := range i.index {
+		m, ok := i.migrations[version][dir]
+		if !ok {
+			continue
+		}
+		mc := *m
+		k := key(&mc)
+		groups[k] = append(groups[k], &mc)
 	}
+	return groups
+}
 
-	fmt.Fprintf(w, "\t%s\t%s\t%s\t\n", "----------------", "------", "-----")
-	if err := w.Flush(); err != nil {
-		fmt.Printf("error in closing formatter: %v\n", err)
+// Subset returns a new Migrations holding copies of the migrations with
+// versions in [min, max], in both directions. i is not modified.
+func (i *Migrations) Subset(min, max uint) *Migrations {
+	sub := i.newDerived()
+	for _, version := range i.index {
+		if version < min || version > max {
+			continue
+		}
+		sub.migrations[version] = make(map[Direction]*Migration, len(i.migrations[version]))
+		for dir, m := range i.migrations[version] {
+			sub.migrations[version][dir] = copyMigration(m)
+		}
 	}
+	sub.buildIndex()
+	return sub
+}
+
+// newDerived returns an empty Migrations for the copies Subset, Clone,
+// Offset and FilterByLabel make of i. It keeps DryRun, the OnStatusChange
+// callback, the hooks and the order of i, but not the ProgressChan channel.
+func (i *Migrations) newDerived() *Migrations {
+	d := NewMigrations()
+	d.DryRun = i.DryRun
+	d.onStatusChange = i.onStatusChange
+	d.preHook, d.postHook = i.preHook, i.postHook
+	d.less = i.less
+	return d
+}
+
+// copyMigration returns a copy of m, changing it doesn't affect m.
+func copyMigration(m *Migration) *Migration {
+	mc := *m
+	return &mc
+}
+
+// Clone returns a deep copy of i, e.g. to compare the statuses before and
+// after a run. Changing the clone doesn't affect i. The clone keeps DryRun,
+// the OnStatusChange callback and the hooks, but not the ProgressChan
+// channel.
+func (i *Migrations) Clone() *Migrations {
+	c := i.newDerived()
+	for version, dirs := range i.migrations {
+		c.migrations[version] = make(map[Direction]*Migration, len(dirs))
+		for dir, m := range dirs {
+			c.migrations[version][dir] = copyMigration(m)
+		}
+	}
+	c.buildIndex()
+	c.rejected = append([]Migration(nil), i.rejected...)
+	return c
+}
+
+// Walk calls fn with a copy of each migration of direction dir, in
+// ascending order of versions for Up and descending order for Down, so in
+// the order they would be applied. Versions without a migration in
+// direction dir are skipped. Walk stops at and returns the first error of
+// fn.
+func (i *Migrations) Walk(dir Direction, fn func(m *Migration) error) error {
+	for n := range i.index {
+		version := i.index[n]
+		if dir == Down {
+			version = i.index[len(i.index)-1-n]
+		}
+		m, ok := i.migrations[version][dir]
+		if !ok {
+			continue
+		}
+		mc := *m
+		if err := fn(&mc); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// WalkDown calls fn with a copy of each down migration from the highest
+// version to the lowest, skipping versions without a down migration. It is
+// Walk(Down, fn).
+func (i *Migrations) WalkDown(fn func(m *Migration) error) error {
+	return i.Walk(Down, fn)
+}
+
+// ParallelGroups partitions the versions with a migration in direction dir
+// into groups, in the order they would be applied, see Walk. Consecutive
+// parallel migrations share a group, which may run concurrently, every
+// other migration is a group of its own. Each group must be done before
+// the next one starts.
+func (i *Migrations) ParallelGroups(dir Direction) [][]uint {
+	var groups [][]uint
+	parallel := false
+	i.Walk(dir, func(m *Migration) error {
+		if m.Parallel && parallel {
+			last := len(groups) - 1
+			groups[last] = append(groups[last], m.Version)
+		} else {
+			groups = append(groups, []uint{m.Version})
+		}
+		parallel = m.Parallel
+		return nil
+	})
+	return groups
+}
+
+// Diff compares the versions of i with those of other, e.g. of a new
+// release against the deployed one: added are the versions only i has,
+// removed the versions only other has, both in ascending order.
+func (i *Migrations) Diff(other *Migrations) (added, removed []uint) {
+	for _, version := range i.index {
+		if _, ok := other.migrations[version]; !ok {
+			added = append(added, version)
+		}
+	}
+	for _, version := range other.index {
+		if _, ok := i.migrations[version]; !ok {
+			removed = append(removed, version)
+		}
+	}
+	return added, removed
+}
+
+// Changed returns the versions of both i and other whose migration in
+// either direction has a different Checksum, in ascending order. Only
+// migrations with a checksum in both sets are compared, see
+// ComputeChecksums.
+func (i *Migrations) Changed(other *Migrations) []uint {
+	var changed []uint
+	for _, version := range i.index {
+		for dir, m := range i.migrations[version] {
+			o, ok := other.migrations[version][dir]
+			if ok && m.Checksum != "" && o.Checksum != "" && m.Checksum != o.Checksum {
+				changed = append(changed, version)
+				break
+			}
+		}
+	}
+	return changed
+}
+
+// Offset returns a new Migrations holding copies of the migrations with
+// every version shifted by delta, e.g. to give each tenant its own range
+// of versions. Raw is unchanged, so the migrations are read from the same
+// files. Like Clone, the copy keeps DryRun, the OnStatusChange callback and
+// the hooks. i is not modified. Offset returns an error if a version would
+// overflow.
+func (i *Migrations) Offset(delta uint) (*Migrations, error) {
+	o := i.newDerived()
+	for _, version := range i.index {
+		shifted := version + delta
+		if shifted < version {
+			return nil, fmt.Errorf("offset %v overflows version %v", delta, version)
+		}
+		o.migrations[shifted] = make(map[Direction]*Migration, len(i.migrations[version]))
+		for dir, m := range i.migrations[version] {
+			mc := copyMigration(m)
+			mc.Version = shifted
+			o.migrations[shifted][dir] = mc
+		}
+	}
+	o.buildIndex()
+	return o, nil
+}
+
+// FilterByLabel returns a new Migrations holding copies of the migrations
+// labeled with label and of those without any label, which apply to every
+// environment. Like Subset, it keeps DryRun, the OnStatusChange callback
+// and the hooks. i is not modified.
+func (i *Migrations) FilterByLabel(label string) *Migrations {
+	sub := i.newDerived()
+	for _, version := range i.index {
+		for dir, m := range i.migrations[version] {
+			if !m.HasLabel(label) && m.labels != "" {
+				continue
+			}
+			if sub.migrations[version] == nil {
+				sub.migrations[version] = make(map[Direction]*Migration)
+			}
+			sub.migrations[version][dir] = copyMigration(m)
+		}
+	}
+	sub.buildIndex()
+	return sub
+}
+
+// HasLabel reports whether m is labeled with label.
+func (m Migration) HasLabel(label string) bool {
+	for _, l := range m.Labels() {
+		if l == label {
+			return true
+		}
+	}
+	return false
+}
+
+// String renders m as version/direction identifier (status), e.g.
+// "1/up create_users (done)", with the error appended to the status if
+// there is one. Migrations without a status are shown as pending.
+func (m Migration) String() string {
+	status := string(m.Status)
+	if status == "" {
+		status = string(Pending)
+	}
+	if m.Error != "" {
+		status += ": " + m.Error
+	}
+	return fmt.Sprintf("%v/%v %v (%v)", m.Version, m.Direction, m.Identifier, status)
 }
 
 type uintSlice []uint
@@ -200,9 +1230,165 @@ func (s uintSlice) Search(x uint) int {
 	return sort.Search(len(s), func(i int) bool { return s[i] >= x })
 }
 
+// IrreversibleMigration marks the down direction of a go migration as
+// irreversible, e.g. RegisterFuncMigrationWithDown(up, IrreversibleMigration).
+// Running it returns ErrIrreversibleMigration.
+func IrreversibleMigration(ctx context.Context, db interface{}) error {
+	return ErrIrreversibleMigration
+}
+
+// IsIrreversible reports whether fn is IrreversibleMigration.
+func IsIrreversible(fn MigrationFunc) bool {
+	return fn != nil && reflect.ValueOf(fn).Pointer() == reflect.ValueOf(IrreversibleMigration).Pointer()
+}
+
+// FuncMigration returns the go migration function registered for m, or nil
+// if m is a plain file migration. If m is not a go file but a function is
+// registered for the go file of the same name, ErrAmbiguousMigration is
+// returned instead of silently preferring one of them.
+func FuncMigration(m *Migration) (MigrationFunc, error) {
+	funcsMu.RLock()
+	defer funcsMu.RUnlock()
+	name := filepath.Base(m.Raw)
+	if fn, ok := MgrFunctions[name]; ok {
+		return fn, nil
+	}
+	goName := strings.TrimSuffix(name, filepath.Ext(name)) + ".go"
+	if _, ok := MgrFunctions[goName]; ok {
+		return nil, ErrAmbiguousMigration{Migration: *m, Func: goName}
+	}
+	return nil, nil
+}
+
+// FuncReporter tells go migration functions apart from file migrations
+// without reading them. It is an optional method of source drivers, checked
+// with a type assertion, see IsFunc. The iofs based drivers, the google
+// cloud storage driver, the func driver and the multi, caching and env
+// expanding drivers wrapping them implement it.
+type FuncReporter interface {
+	IsFunc(version uint, dir Direction) bool
+}
+
+// IsFunc reports whether the migration of version in direction dir is a go
+// migration function according to d, false if d is not a FuncReporter.
+func IsFunc(d Driver, version uint, dir Direction) bool {
+	fr, ok := d.(FuncReporter)
+	return ok && fr.IsFunc(version, dir)
+}
+
+// IsFunc reports whether a go migration function is registered for the
+// migration of version in direction dir, see FuncMigration, without
+// reading it. A version without a down migration falls back to the down
+// function registered with RegisterFuncMigrationWithDown for its up
+// migration.
+func (i *Migrations) IsFunc(version uint, dir Direction) bool {
+	if m, ok := i.migrations[version][dir]; ok {
+		fn, err := FuncMigration(m)
+		return err == nil && fn != nil
+	}
+	m, ok := i.migrations[version][Up]
+	if !ok || dir != Down {
+		return false
+	}
+	_, ok = DownFuncMigration(m.Raw)
+	return ok
+}
+
+// DownFuncMigration returns the down function registered with
+// RegisterFuncMigrationWithDown for the migration file name, if any. Only
+// the base of name is used, like for RegisterFuncMigrationNamed.
+func DownFuncMigration(name string) (MigrationFunc, bool) {
+	funcsMu.RLock()
+	defer funcsMu.RUnlock()
+	fn, ok := MgrDownFunctions[filepath.Base(name)]
+	return fn, ok
+}
+
 // register go migration function
 func RegisterFuncMigration(fn MigrationFunc) {
+	_, file, _, _ := runtime.Caller(1)
+	RegisterFuncMigrationNamed(file, fn)
+}
+
+// RegisterFuncMigrationNamed is like RegisterFuncMigration, but registers
+// fn for the migration file name instead of the calling file, e.g. when
+// registering from a helper function or for generated migrations. Only the
+// base of name is used, so it matches the Raw of the migration.
+func RegisterFuncMigrationNamed(name string, fn MigrationFunc) {
+	funcsMu.Lock()
+	defer funcsMu.Unlock()
+	MgrFunctions[filepath.Base(name)] = fn
+}
+
+// RegisteredFuncMigrations returns the sorted file names go migration
+// functions are registered for, e.g. to log them at startup and compare
+// them with the migration files.
+func RegisteredFuncMigrations() []string {
+	funcsMu.RLock()
+	defer funcsMu.RUnlock()
+	names := make([]string, 0, len(MgrFunctions))
+	for name := range MgrFunctions {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// RegisterFuncMigrationWithDown registers go migration functions for both
+// directions, so a single go file can hold the up and the down migration.
+// The down function is used for the version of the calling file whenever
+// there is no separate down migration.
+func RegisterFuncMigrationWithDown(up, down MigrationFunc) {
 	_, file, _, _ := runtime.Caller(1)
 	name := filepath.Base(file)
-	MgrFunctions[name] = fn
+	funcsMu.Lock()
+	defer funcsMu.Unlock()
+	MgrFunctions[name] = up
+	MgrDownFunctions[name] = down
+}
+
+// RegisterFuncForVersion registers fn as the migration of version in
+// direction dir, independent of any file name, e.g. for migration plans
+// generated at runtime. Such functions are run by the driver returned by
+// NewRegisteredFuncDriver. Registering nil removes the function.
+func RegisterFuncForVersion(version uint, dir Direction, fn MigrationFunc) {
+	funcsMu.Lock()
+	defer funcsMu.Unlock()
+	if fn == nil {
+		delete(versionFuncs[version], dir)
+		if len(versionFuncs[version]) == 0 {
+			delete(versionFuncs, version)
+		}
+		return
+	}
+	if versionFuncs[version] == nil {
+		versionFuncs[version] = make(map[Direction]MigrationFunc)
+	}
+	versionFuncs[version][dir] = fn
+}
+
+// VersionFuncMigration returns the go migration function registered with
+// RegisterFuncForVersion for version and direction dir, if any.
+func VersionFuncMigration(version uint, dir Direction) (MigrationFunc, bool) {
+	funcsMu.RLock()
+	defer funcsMu.RUnlock()
+	fn, ok := versionFuncs[version][dir]
+	return fn, ok
+}
+
+// WithTimeout wraps fn so it runs with a context that is canceled after d,
+// e.g. RegisterFuncMigration(source.WithTimeout(30*time.Second, fn)).
+// If fn fails once d has passed, the error is reported as a timeout
+// wrapping context.DeadlineExceeded. A fn ignoring its context is not
+// stopped by the timeout, and its result is returned as is.
+func WithTimeout(d time.Duration, fn MigrationFunc) MigrationFunc {
+	return func(ctx context.Context, db interface{}) error {
+		ctx, cancel := context.WithTimeout(ctx, d)
+		defer cancel()
+		err := fn(ctx, db)
+		if err != nil && errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			return fmt.Errorf("go migration timed out after %v: %w", d, ctx.Err())
+		}
+		return err
+	}
 }
@@ -1,7 +1,20 @@
 package source
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 )
 
 func TestNewMigrations(t *testing.T) {
@@ -9,13 +22,50 @@ func TestNewMigrations(t *testing.T) {
 }
 
 func TestAppend(t *testing.T) {
-	// TODO
+	i := NewMigrations()
+	for _, v := range rand.New(rand.NewSource(1)).Perm(500) {
+		for _, dir := range []Direction{Up, Down} {
+			if err := i.AppendErr(&Migration{Version: uint(v), Direction: dir}); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	if len(i.index) != 500 || !sort.SliceIsSorted(i.index, func(x, y int) bool { return i.index[x] < i.index[y] }) {
+		t.Fatalf("expected 500 sorted versions, got %v", i.index)
+	}
+
+	// the same order buildIndex creates from scratch
+	index := append(uintSlice(nil), i.index...)
+	i.buildIndex()
+	if !reflect.DeepEqual(index, i.index) {
+		t.Errorf("expected %v, got %v", i.index, index)
+	}
 }
 
 func TestBuildIndex(t *testing.T) {
 	// TODO
 }
 
+func BenchmarkAppend(b *testing.B) {
+	for name, versions := range map[string][]int{
+		"ascending": rand.New(rand.NewSource(1)).Perm(5000),
+		"shuffled":  rand.New(rand.NewSource(1)).Perm(5000),
+	} {
+		if name == "ascending" {
+			sort.Ints(versions)
+		}
+		b.Run(name, func(b *testing.B) {
+			for n := 0; n < b.N; n++ {
+				i := NewMigrations()
+				for _, v := range versions {
+					i.Append(&Migration{Version: uint(v), Direction: Up})
+					i.Append(&Migration{Version: uint(v), Direction: Down})
+				}
+			}
+		})
+	}
+}
+
 func TestFirst(t *testing.T) {
 	// TODO
 }
@@ -44,3 +94,1512 @@ func TestFindPos(t *testing.T) {
 		t.Errorf("expected 2, got %v", p)
 	}
 }
+
+func TestSetLess(t *testing.T) {
+	i := NewMigrations()
+	for _, m := range []*Migration{
+		{Version: 1, Direction: Up, Identifier: "c"},
+		{Version: 2, Direction: Down, Identifier: "a"},
+		{Version: 3, Direction: Up, Identifier: "b"},
+		{Version: 4, Direction: Up, Identifier: "b"},
+	} {
+		if err := i.AppendErr(m); err != nil {
+			t.Fatal(err)
+		}
+	}
+	i.SetLess(func(a, b *Migration) bool { return a.Identifier < b.Identifier })
+
+	// 3 and 4 tie and stay in ascending order
+	expectOrder := func(want []uint) {
+		t.Helper()
+		var got []uint
+		for v, ok := i.First(); ok; v, ok = i.Next(v) {
+			got = append(got, v)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("expected %v, got %v", want, got)
+		}
+		last := want[len(want)-1]
+		if v, ok := i.Prev(last); !ok || v != want[len(want)-2] {
+			t.Errorf("expected prev of %v to be %v, got %v, %v", last, want[len(want)-2], v, ok)
+		}
+	}
+	expectOrder([]uint{2, 3, 4, 1})
+
+	// appended migrations are inserted in order, an up migration takes
+	// the place of the down migration of its version
+	for _, m := range []*Migration{
+		{Version: 5, Direction: Up, Identifier: "a"},
+		{Version: 2, Direction: Up, Identifier: "d"},
+	} {
+		if err := i.AppendErr(m); err != nil {
+			t.Fatal(err)
+		}
+	}
+	expectOrder([]uint{5, 3, 4, 1, 2})
+
+	if c := i.Clone(); !reflect.DeepEqual(c.Versions(), i.Versions()) {
+		t.Errorf("expected clone to keep the order %v, got %v", i.Versions(), c.Versions())
+	}
+
+	i.SetLess(nil)
+	expectOrder([]uint{1, 2, 3, 4, 5})
+}
+
+func TestGroupBy(t *testing.T) {
+	ms := NewMigrations()
+	for _, m := range []*Migration{
+		{Version: 1, Identifier: "schema_a", Direction: Up},
+		{Version: 1, Identifier: "schema_a", Direction: Down},
+		{Version: 2, Identifier: "schema_b", Direction: Up},
+		{Version: 3, Identifier: "schema_a", Direction: Up},
+		{Version: 4, Identifier: "schema_b", Direction: Down},
+	} {
+		if !ms.Append(m) {
+			t.Fatalf("failed to append %#v", m)
+		}
+	}
+
+	groups := ms.GroupBy(Up, func(m *Migration) string { return m.Identifier })
+	if len(groups) != 2 {
+		t.Fatalf("expected 2 groups, got %v", len(groups))
+	}
+	expected := map[string][]uint{"schema_a": {1, 3}, "schema_b": {2}}
+	for k, versions := range expected {
+		if len(groups[k]) != len(versions) {
+			t.Fatalf("expected %v migrations in group %v, got %v", len(versions), k, len(groups[k]))
+		}
+		for x, v := range versions {
+			if groups[k][x].Version != v {
+				t.Errorf("expected version %v at position %v of group %v, got %v", v, x, k, groups[k][x].Version)
+			}
+		}
+	}
+
+	// returned migrations must not alias the internal ones
+	groups["schema_a"][0].Status = Failed
+	if m, _ := ms.Up(1); m.Status == Failed {
+		t.Error("expected GroupBy to return copies")
+	}
+}
+
+func TestRegisterFuncMigrationWithDown(t *testing.T) {
+	errUp, errDown := errors.New("up"), errors.New("down")
+	RegisterFuncMigrationWithDown(
+		func(ctx context.Context, db interface{}) error { return errUp },
+		func(ctx context.Context, db interface{}) error { return errDown },
+	)
+	defer delete(MgrFunctions, "migration_test.go")
+	defer delete(MgrDownFunctions, "migration_test.go")
+
+	up, ok := MgrFunctions["migration_test.go"]
+	if !ok {
+		t.Fatal("expected up function to be registered by caller file")
+	}
+	if err := up(context.Background(), nil); err != errUp {
+		t.Errorf("expected %v, got %v", errUp, err)
+	}
+	down, ok := MgrDownFunctions["migration_test.go"]
+	if !ok {
+		t.Fatal("expected down function to be registered by caller file")
+	}
+	if err := down(context.Background(), nil); err != errDown {
+		t.Errorf("expected %v, got %v", errDown, err)
+	}
+}
+
+func TestRegisteredFuncMigrations(t *testing.T) {
+	noop := func(ctx context.Context, db interface{}) error { return nil }
+	for _, name := range []string{"migrations/3_c.up.go", "1_a.up.go", "2_b.down.go"} {
+		RegisterFuncMigrationNamed(name, noop)
+		defer delete(MgrFunctions, filepath.Base(name))
+	}
+
+	// registrations may run concurrently with listing
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		RegisterFuncMigrationNamed("4_d.up.go", noop)
+	}()
+	RegisteredFuncMigrations()
+	wg.Wait()
+	defer delete(MgrFunctions, "4_d.up.go")
+
+	names := RegisteredFuncMigrations()
+	if !sort.StringsAreSorted(names) {
+		t.Errorf("expected sorted names, got %v", names)
+	}
+	var registered []string
+	for _, name := range names {
+		switch name {
+		case "1_a.up.go", "2_b.down.go", "3_c.up.go", "4_d.up.go":
+			registered = append(registered, name)
+		}
+	}
+	if expected := []string{"1_a.up.go", "2_b.down.go", "3_c.up.go", "4_d.up.go"}; !reflect.DeepEqual(registered, expected) {
+		t.Errorf("expected %v, got %v", expected, registered)
+	}
+}
+
+func TestWithTimeout(t *testing.T) {
+	slow := WithTimeout(10*time.Millisecond, func(ctx context.Context, db interface{}) error {
+		<-ctx.Done()
+		return ctx.Err()
+	})
+	err := slow(context.Background(), nil)
+	if !errors.Is(err, context.DeadlineExceeded) || !strings.Contains(err.Error(), "timed out after 10ms") {
+		t.Errorf("expected timeout error, got %v", err)
+	}
+
+	// a migration ignoring its context and succeeding is not failed
+	ignoring := WithTimeout(10*time.Millisecond, func(ctx context.Context, db interface{}) error {
+		time.Sleep(50 * time.Millisecond)
+		return nil
+	})
+	if err := ignoring(context.Background(), nil); err != nil {
+		t.Errorf("expected no error, got %v", err)
+	}
+
+	errFn := errors.New("fn")
+	fast := WithTimeout(time.Second, func(ctx context.Context, db interface{}) error {
+		if _, ok := ctx.Deadline(); !ok {
+			t.Error("expected context with deadline")
+		}
+		if db != "db" {
+			t.Errorf("expected db to be passed, got %v", db)
+		}
+		return errFn
+	})
+	if err := fast(context.Background(), "db"); err != errFn {
+		t.Errorf("expected %v, got %v", errFn, err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := slow(ctx, nil); err != context.Canceled {
+		t.Errorf("expected %v, got %v", context.Canceled, err)
+	}
+}
+
+func TestFuncMigration(t *testing.T) {
+	MgrFunctions["1_init.up.go"] = func(ctx context.Context, db interface{}) error { return nil }
+	defer delete(MgrFunctions, "1_init.up.go")
+
+	// go migration file
+	fn, err := FuncMigration(&Migration{Version: 1, Direction: Up, Raw: "migrations/1_init.up.go"})
+	if err != nil || fn == nil {
+		t.Errorf("expected registered function, got %v, %v", fn, err)
+	}
+
+	// plain file migration
+	fn, err = FuncMigration(&Migration{Version: 2, Direction: Up, Raw: "migrations/2_other.up.sql"})
+	if err != nil || fn != nil {
+		t.Errorf("expected no function, got %v, %v", fn, err)
+	}
+
+	// file body and registered function for the same migration
+	_, err = FuncMigration(&Migration{Version: 1, Direction: Up, Raw: "migrations/1_init.up.sql"})
+	var ambiguous ErrAmbiguousMigration
+	if !errors.As(err, &ambiguous) {
+		t.Fatalf("expected ErrAmbiguousMigration, got %v", err)
+	}
+	if ambiguous.Version != 1 || ambiguous.Func != "1_init.up.go" {
+		t.Errorf("unexpected error detail: %#v", ambiguous)
+	}
+}
+
+func TestOnStatusChange(t *testing.T) {
+	ms := NewMigrations()
+	for _, m := range []*Migration{
+		{Version: 1, Direction: Up, Status: Pending},
+		{Version: 2, Direction: Up, Status: Pending},
+		{Version: 2, Direction: Down, Status: Pending},
+		{Version: 3, Direction: Up, Status: Pending},
+	} {
+		ms.Append(m)
+	}
+
+	var got []Migration
+	ms.OnStatusChange(func(m Migration) { got = append(got, m) })
+
+	ms.MarkSkipMigrations(1, Up)
+	ms.UpdateStatus(2, Done, "")
+	ms.UpdateStatus(2, Done, "") // no transition
+	ms.UpdateStatus(3, Failed, "boom")
+
+	expected := []Migration{
+		{Version: 1, Direction: Up, Status: Skipped},
+		{Version: 2, Direction: Up, Status: Done},
+		{Version: 2, Direction: Down, Status: Done},
+		{Version: 3, Direction: Up, Status: Failed, Error: "boom"},
+	}
+	if len(got) != len(expected) {
+		t.Fatalf("expected %v callbacks, got %v: %#v", len(expected), len(got), got)
+	}
+	for x := range expected {
+		if !reflect.DeepEqual(got[x], expected[x]) {
+			t.Errorf("expected %#v, got %#v, in %v", expected[x], got[x], x)
+		}
+	}
+
+	// the callback receives copies
+	got[0].Status = Failed
+	if m, _ := ms.Up(1); m.Status != Skipped {
+		t.Error("expected callback to receive a copy")
+	}
+
+	// removing the callback must be safe
+	ms.OnStatusChange(nil)
+	ms.UpdateStatus(1, Done, "")
+}
+
+func TestReset(t *testing.T) {
+	ms := NewMigrations()
+	for _, m := range []*Migration{
+		{Version: 1, Direction: Up, Status: Pending},
+		{Version: 1, Direction: Down, Status: Pending},
+		{Version: 2, Direction: Up, Status: Pending},
+		{Version: 3, Direction: Up, Status: Pending},
+	} {
+		ms.Append(m)
+	}
+	ms.UpdateStatus(1, Done, "")
+	ms.UpdateStatus(2, Failed, "boom")
+	ms.MarkSkipMigrations(3, Up)
+
+	ms.Reset()
+
+	for _, dir := range []Direction{Up, Down} {
+		groups := ms.GroupBy(dir, func(m *Migration) string { return string(m.Status) + m.Error })
+		for k := range groups {
+			if k != string(Pending) {
+				t.Errorf("expected all %v migrations to be pending, got %v", dir, k)
+			}
+		}
+	}
+}
+
+func TestAppendErr(t *testing.T) {
+	ms := NewMigrations()
+
+	if err := ms.AppendErr(nil); err != ErrNilMigration {
+		t.Errorf("expected %v, got %v", ErrNilMigration, err)
+	}
+	if err := ms.AppendErr(&Migration{Version: 1, Direction: Up, Raw: "1_foobar.up.sql"}); err != nil {
+		t.Errorf("expected nil, got %v", err)
+	}
+	if err := ms.AppendErr(&Migration{Version: 1, Direction: Down, Raw: "1_foobar.down.sql"}); err != nil {
+		t.Errorf("expected nil, got %v", err)
+	}
+
+	err := ms.AppendErr(&Migration{Version: 1, Direction: Up, Raw: "1_other.up.sql"})
+	var dup ErrDuplicateMigration
+	if !errors.As(err, &dup) {
+		t.Fatalf("expected ErrDuplicateMigration, got %v", err)
+	}
+	if dup.Raw != "1_other.up.sql" || dup.ExistingRaw != "1_foobar.up.sql" ||
+		dup.Error() != "duplicate migration file: 1_other.up.sql conflicts with 1_foobar.up.sql" {
+		t.Errorf("unexpected error detail: %v", dup)
+	}
+	if m, _ := ms.Up(1); m.Raw != "1_foobar.up.sql" {
+		t.Errorf("expected duplicate to be rejected, got %v", m.Raw)
+	}
+}
+
+func TestSingleDirectionMigrations(t *testing.T) {
+	ms := NewMigrations()
+	for _, m := range []*Migration{
+		{Version: 1, Direction: Up, Status: Pending},
+		{Version: 1, Direction: Down, Status: Pending},
+		{Version: 3, Direction: Up, Status: Pending},
+		{Version: 5, Direction: Down, Status: Pending},
+	} {
+		ms.Append(m)
+	}
+
+	ms.MarkSkipMigrations(5, Up)
+	ms.MarkSkipMigrations(0, Down)
+	for _, v := range []uint{1, 3} {
+		if m, _ := ms.Up(v); m.Status != Skipped {
+			t.Errorf("expected up %v to be skipped, got %v", v, m.Status)
+		}
+	}
+	for _, v := range []uint{1, 5} {
+		if m, _ := ms.Down(v); m.Status != Skipped {
+			t.Errorf("expected down %v to be skipped, got %v", v, m.Status)
+		}
+	}
+
+	ms.PrintSummary(Up)
+	ms.PrintSummary(Down)
+}
+
+func TestMarkSkipMigrationsExclusive(t *testing.T) {
+	newMigrations := func() *Migrations {
+		ms := NewMigrations()
+		for _, m := range []*Migration{
+			{Version: 1, Direction: Up, Status: Pending},
+			{Version: 1, Direction: Down, Status: Pending},
+			{Version: 2, Direction: Up, Status: Pending},
+			{Version: 3, Direction: Up, Status: Pending},
+			{Version: 3, Direction: Down, Status: Pending},
+			{Version: 4, Direction: Down, Status: Pending},
+		} {
+			ms.Append(m)
+		}
+		return ms
+	}
+	statuses := func(ms *Migrations, dir Direction) map[uint]Status {
+		got := make(map[uint]Status)
+		ms.Walk(dir, func(m *Migration) error {
+			got[m.Version] = m.Status
+			return nil
+		})
+		return got
+	}
+
+	for _, tc := range []struct {
+		name      string
+		version   uint
+		dir       Direction
+		exclusive bool
+		expected  map[uint]Status
+	}{
+		{"up inclusive", 2, Up, false, map[uint]Status{1: Skipped, 2: Skipped, 3: Pending}},
+		{"up exclusive", 2, Up, true, map[uint]Status{1: Skipped, 2: Pending, 3: Pending}},
+		{"down inclusive", 3, Down, false, map[uint]Status{1: Pending, 3: Skipped, 4: Skipped}},
+		{"down exclusive", 3, Down, true, map[uint]Status{1: Pending, 3: Pending, 4: Skipped}},
+		// version 2 and 5 have no down migration
+		{"down exclusive without migration", 2, Down, true, map[uint]Status{1: Pending, 3: Skipped, 4: Skipped}},
+		{"up exclusive above all", 5, Up, true, map[uint]Status{1: Skipped, 2: Skipped, 3: Skipped}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			ms := newMigrations()
+			if tc.exclusive {
+				ms.MarkSkipMigrationsExclusive(tc.version, tc.dir)
+			} else {
+				ms.MarkSkipMigrations(tc.version, tc.dir)
+			}
+			if got := statuses(ms, tc.dir); !reflect.DeepEqual(got, tc.expected) {
+				t.Errorf("expected %v, got %v", tc.expected, got)
+			}
+		})
+	}
+}
+
+func TestPrintSummaryTo(t *testing.T) {
+	ms := NewMigrations()
+	for _, m := range []*Migration{
+		{Version: 1, Direction: Up, Raw: "1_foo.up.sql", Status: Done},
+		{Version: 1, Direction: Down, Raw: "1_foo.down.sql", Status: Pending},
+		{Version: 3, Direction: Up, Raw: "3_foo.up.sql", Status: Failed, Error: "boom"},
+	} {
+		ms.Append(m)
+	}
+
+	var up, down bytes.Buffer
+	if err := ms.PrintSummaryTo(&up, Up); err != nil {
+		t.Fatal(err)
+	}
+	if err := ms.PrintSummaryTo(&down, Down); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, s := range []string{"1_foo.up.sql", "3_foo.up.sql", "boom"} {
+		if !strings.Contains(up.String(), s) {
+			t.Errorf("expected up summary to contain %q, got\n%v", s, up.String())
+		}
+	}
+	if strings.Contains(up.String(), "<none>") {
+		t.Errorf("expected no <none> rows in up summary, got\n%v", up.String())
+	}
+	if !strings.Contains(down.String(), "1_foo.down.sql") || strings.Count(down.String(), "<none>") != 1 {
+		t.Errorf("expected version 3 to be rendered as <none> in down summary, got\n%v", down.String())
+	}
+}
+
+func summaryMigrations() *Migrations {
+	ms := NewMigrations()
+	for _, m := range []*Migration{
+		{Version: 1, Direction: Up, Raw: "1_create_users.up.sql", Status: Done},
+		{Version: 2, Direction: Up, Raw: "2_add_a_rather_long_migration_name.up.sql", Status: Failed, Error: "boom"},
+		{Version: 3, Direction: Down, Raw: "3_drop_index.down.sql", Status: Pending},
+		{Version: 4, Direction: Up, Raw: "4_seed.up.sql", Status: Skipped},
+	} {
+		ms.Append(m)
+	}
+	return ms
+}
+
+func TestPrintSummaryGolden(t *testing.T) {
+	var buf bytes.Buffer
+	if err := summaryMigrations().PrintSummaryTo(&buf, Up); err != nil {
+		t.Fatal(err)
+	}
+	golden, err := ioutil.ReadFile("testdata/summary_default.golden")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if buf.String() != string(golden) {
+		t.Errorf("expected\n%s\ngot\n%s", golden, buf.String())
+	}
+}
+
+func TestPrintSummaryFormat(t *testing.T) {
+	var buf bytes.Buffer
+	format := SummaryFormat{TabWidth: 8, Padding: 2, PadChar: ' '}
+	if err := summaryMigrations().PrintSummaryWith(&buf, Up, SummaryOptions{Format: &format}); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(buf.String(), "\t") {
+		t.Errorf("expected no tabs, got\n%q", buf.String())
+	}
+	// the status column starts at the same offset in every row
+	column := -1
+	for _, row := range []string{"1_create_users.up.sql", "2_add_a_rather_long_migration_name.up.sql", "4_seed.up.sql"} {
+		for _, line := range strings.Split(buf.String(), "\n") {
+			if !strings.Contains(line, row) {
+				continue
+			}
+			offset := strings.Index(line, row) + len(row)
+			offset += len(line[offset:]) - len(strings.TrimLeft(line[offset:], " "))
+			if column == -1 {
+				column = offset
+			} else if offset != column {
+				t.Errorf("expected status of %v at column %v, got %v in\n%s", row, column, offset, buf.String())
+			}
+		}
+	}
+}
+
+func TestPrintSummaryDescription(t *testing.T) {
+	ms := NewMigrations()
+	for _, raw := range []string{"1_create_users.up.sql", "2_add_user_index.up.sql"} {
+		m, err := Parse(raw)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ms.Append(m)
+	}
+	var buf bytes.Buffer
+	if err := ms.PrintSummaryWith(&buf, Up, SummaryOptions{Description: true}); err != nil {
+		t.Fatal(err)
+	}
+	for _, row := range []string{"\t1_create_users.up.sql\tcreate users\tpending\t", "\t2_add_user_index.up.sql\tadd user index\tpending\t"} {
+		if !strings.Contains(buf.String(), row) {
+			t.Errorf("expected row %q, got\n%s", row, buf.String())
+		}
+	}
+
+	buf.Reset()
+	if err := ms.PrintSummaryTo(&buf, Up); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(buf.String(), "Description") || strings.Contains(buf.String(), "create users") {
+		t.Errorf("expected no description column by default, got\n%s", buf.String())
+	}
+}
+
+func TestPrintSummaryWith(t *testing.T) {
+	ms := NewMigrations()
+	for _, m := range []*Migration{
+		{Version: 1, Direction: Up, Raw: "1_foo.up.sql", Status: Done},
+		{Version: 2, Direction: Up, Raw: "2_foo.up.sql", Status: Failed, Error: "boom"},
+		{Version: 3, Direction: Up, Raw: "3_foo.up.sql", Status: Done},
+		{Version: 4, Direction: Up, Raw: "4_foo.up.sql", Status: Pending},
+		{Version: 5, Direction: Down, Raw: "5_foo.down.sql", Status: Pending},
+	} {
+		ms.Append(m)
+	}
+
+	var failed bytes.Buffer
+	if err := ms.PrintSummaryWith(&failed, Up, SummaryOptions{Only: []Status{Failed}}); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(failed.String(), "2_foo.up.sql") {
+		t.Errorf("expected failed migration in summary, got\n%v", failed.String())
+	}
+	for _, s := range []string{"1_foo.up.sql", "3_foo.up.sql", "4_foo.up.sql", "<none>", string(Done), string(Pending)} {
+		if strings.Contains(failed.String(), s) {
+			t.Errorf("expected summary of failed migrations not to contain %q, got\n%v", s, failed.String())
+		}
+	}
+
+	var grouped bytes.Buffer
+	if err := ms.PrintSummaryWith(&grouped, Up, SummaryOptions{GroupByStatus: true}); err != nil {
+		t.Fatal(err)
+	}
+	var order []string
+	for _, line := range strings.Split(grouped.String(), "\n") {
+		if fields := strings.Fields(line); len(fields) > 1 && strings.HasSuffix(fields[0], ".sql") {
+			order = append(order, fields[0])
+		}
+	}
+	expected := []string{"2_foo.up.sql", "4_foo.up.sql", "1_foo.up.sql", "3_foo.up.sql"}
+	if !reflect.DeepEqual(order, expected) {
+		t.Errorf("expected rows %v, got %v in\n%v", expected, order, grouped.String())
+	}
+}
+
+func TestProgressChan(t *testing.T) {
+	ms := NewMigrations()
+	for _, m := range []*Migration{
+		{Version: 1, Direction: Up, Raw: "1_foo.up.sql", Status: Pending},
+		{Version: 2, Direction: Up, Raw: "2_foo.up.sql", Status: Pending},
+		{Version: 3, Direction: Up, Raw: "3_foo.up.sql", Status: Pending},
+	} {
+		ms.Append(m)
+	}
+
+	progress := ms.ProgressChan(10)
+	ms.MarkSkipMigrations(1, Up)
+	ms.UpdateStatus(2, Done, "")
+	ms.UpdateStatus(2, Done, "") // no transition
+	ms.UpdateStatus(3, Failed, "boom")
+	ms.CloseProgress()
+	ms.UpdateStatus(3, Done, "") // not sent after close
+
+	var got []string
+	for m := range progress {
+		got = append(got, fmt.Sprintf("%v %v %v", m.Raw, m.Status, m.Error))
+	}
+	expected := []string{"1_foo.up.sql skipped ", "2_foo.up.sql done ", "3_foo.up.sql failed boom"}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected %q, got %q", expected, got)
+	}
+}
+
+func TestProgressChanDrops(t *testing.T) {
+	ms := NewMigrations()
+	ms.Append(&Migration{Version: 1, Direction: Up, Raw: "1_foo.up.sql", Status: Pending})
+	ms.Append(&Migration{Version: 2, Direction: Up, Raw: "2_foo.up.sql", Status: Pending})
+
+	// nobody receives, the second change doesn't fit and must not block
+	progress := ms.ProgressChan(1)
+	ms.UpdateStatus(1, Done, "")
+	ms.UpdateStatus(2, Done, "")
+
+	replaced := ms.ProgressChan(1)
+	var got []uint
+	for m := range progress {
+		got = append(got, m.Version)
+	}
+	if !reflect.DeepEqual(got, []uint{1}) {
+		t.Errorf("expected only version 1 to be queued, got %v", got)
+	}
+
+	ms.CloseProgress()
+	ms.CloseProgress()
+	if _, ok := <-replaced; ok {
+		t.Error("expected replacing channel to be closed without changes")
+	}
+}
+
+func TestVersions(t *testing.T) {
+	ms := NewMigrations()
+	for _, m := range []*Migration{
+		{Version: 7, Direction: Up},
+		{Version: 1, Direction: Up},
+		{Version: 1, Direction: Down},
+		{Version: 5, Direction: Down},
+		{Version: 3, Direction: Up},
+	} {
+		ms.Append(m)
+	}
+
+	versions := ms.Versions()
+	expected := []uint{1, 3, 5, 7}
+	if len(versions) != len(expected) {
+		t.Fatalf("expected %v, got %v", expected, versions)
+	}
+	for x := range expected {
+		if versions[x] != expected[x] {
+			t.Fatalf("expected %v, got %v", expected, versions)
+		}
+	}
+
+	versions[0] = 100
+	if v, _ := ms.First(); v != 1 {
+		t.Errorf("expected Versions to return a copy, first version is now %v", v)
+	}
+}
+
+func TestIsIrreversible(t *testing.T) {
+	if !IsIrreversible(IrreversibleMigration) {
+		t.Error("expected IrreversibleMigration to be irreversible")
+	}
+	if IsIrreversible(func(ctx context.Context, db interface{}) error { return nil }) {
+		t.Error("expected other functions not to be irreversible")
+	}
+	if IsIrreversible(nil) {
+		t.Error("expected nil not to be irreversible")
+	}
+	if err := IrreversibleMigration(context.Background(), nil); err != ErrIrreversibleMigration {
+		t.Errorf("expected %v, got %v", ErrIrreversibleMigration, err)
+	}
+}
+
+func TestSubset(t *testing.T) {
+	i := NewMigrations()
+	for _, v := range []uint{1, 3, 5, 7, 9, 11} {
+		i.Append(&Migration{Version: v, Direction: Up, Raw: fmt.Sprintf("%v.up.sql", v), labels: "prod"})
+		i.Append(&Migration{Version: v, Direction: Down, Raw: fmt.Sprintf("%v.down.sql", v)})
+	}
+
+	sub := i.Subset(5, 9)
+	if first, ok := sub.First(); !ok || first != 5 {
+		t.Errorf("expected first version 5, got %v, %v", first, ok)
+	}
+	if last, ok := sub.Last(); !ok || last != 9 {
+		t.Errorf("expected last version 9, got %v, %v", last, ok)
+	}
+	if got, want := sub.Versions(), []uint{5, 7, 9}; !reflect.DeepEqual(got, want) {
+		t.Errorf("expected versions %v, got %v", want, got)
+	}
+	if _, ok := sub.Down(7); !ok {
+		t.Error("expected down migration of version 7 in subset")
+	}
+	if _, ok := sub.Up(3); ok {
+		t.Error("expected version 3 not to be in subset")
+	}
+
+	sub.UpdateStatus(5, Done, "")
+	if m, _ := sub.Up(5); !m.HasLabel("prod") {
+		t.Errorf("expected subset to keep the labels, got %v", m.Labels())
+	}
+	if m, _ := i.Up(5); m.Status == Done {
+		t.Errorf("expected parent to be untouched, got status %v", m.Status)
+	}
+	if got, want := i.Versions(), []uint{1, 3, 5, 7, 9, 11}; !reflect.DeepEqual(got, want) {
+		t.Errorf("expected parent versions %v, got %v", want, got)
+	}
+
+	if _, ok := i.Subset(20, 30).First(); ok {
+		t.Error("expected empty subset")
+	}
+}
+
+func TestMissingVersions(t *testing.T) {
+	tt := []struct {
+		name     string
+		versions []uint
+		start    uint
+		step     uint
+		expected []uint
+	}{
+		{name: "empty", versions: nil, start: 1, step: 1, expected: nil},
+		{name: "dense", versions: []uint{1, 2, 3, 4}, start: 1, step: 1, expected: nil},
+		{name: "dense with gaps", versions: []uint{1, 2, 4, 7}, start: 1, step: 1, expected: []uint{3, 5, 6}},
+		{name: "missing first", versions: []uint{2, 3}, start: 1, step: 1, expected: []uint{1}},
+		{name: "stepped", versions: []uint{10, 20, 40}, start: 10, step: 10, expected: []uint{30}},
+		{name: "sparse", versions: []uint{20200101120000, 20210315093000}, start: 20200101120000, step: 0, expected: nil},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			i := NewMigrations()
+			for _, v := range tc.versions {
+				i.Append(&Migration{Version: v, Direction: Up})
+			}
+			if got := i.MissingVersions(tc.start, tc.step); !reflect.DeepEqual(got, tc.expected) {
+				t.Errorf("expected %v, got %v", tc.expected, got)
+			}
+		})
+	}
+}
+
+func TestChecksum(t *testing.T) {
+	a, err := Checksum(strings.NewReader("CREATE TABLE foo (id int);"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ := Checksum(strings.NewReader("CREATE TABLE foo (id int);"))
+	c, _ := Checksum(strings.NewReader("CREATE TABLE foo (id bigint);"))
+	if a != b {
+		t.Errorf("expected identical content to have identical checksums, got %v and %v", a, b)
+	}
+	if a == c {
+		t.Errorf("expected edited content to change the checksum %v", a)
+	}
+	if len(a) != 64 {
+		t.Errorf("expected hex encoded SHA-256, got %v", a)
+	}
+}
+
+func TestSummaryJSON(t *testing.T) {
+	i := NewMigrations()
+	i.Append(&Migration{Version: 1, Identifier: "foo", Direction: Up, Raw: "1_foo.up.sql", Checksum: "abc"})
+	i.Append(&Migration{Version: 2, Identifier: "bar_baz", Description: "bar baz", Direction: Up, Raw: "2_bar_baz.up.sql"})
+	i.Append(&Migration{Version: 3, Identifier: "baz", Direction: Down, Raw: "3_baz.down.sql"})
+	i.UpdateStatus(1, Done, "")
+	i.UpdateStatus(2, Failed, "boom")
+
+	b, err := i.SummaryJSON(Up)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var entries []SummaryEntry
+	if err := json.Unmarshal(b, &entries); err != nil {
+		t.Fatal(err)
+	}
+	expected := []SummaryEntry{
+		{Version: 1, Direction: Up, Identifier: "foo", Raw: "1_foo.up.sql", Status: Done, Checksum: "abc"},
+		{Version: 2, Direction: Up, Identifier: "bar_baz", Description: "bar baz", Raw: "2_bar_baz.up.sql", Status: Failed, Error: "boom"},
+	}
+	if !reflect.DeepEqual(entries, expected) {
+		t.Errorf("expected %+v, got %+v", expected, entries)
+	}
+	if strings.Contains(string(b), `"checksum":""`) {
+		t.Errorf("expected empty checksum to be omitted, got %s", b)
+	}
+	if strings.Contains(string(b), `"description":""`) {
+		t.Errorf("expected empty description to be omitted, got %s", b)
+	}
+}
+
+func TestLoadStatus(t *testing.T) {
+	i := NewMigrations()
+	for _, v := range []uint{1, 2, 3} {
+		i.Append(&Migration{Version: v, Direction: Up, Raw: fmt.Sprintf("%v_foo.up.sql", v)})
+		i.Append(&Migration{Version: v, Direction: Down, Raw: fmt.Sprintf("%v_foo.down.sql", v)})
+	}
+	i.UpdateStatusDir(1, Up, Done, "")
+	i.UpdateStatusDir(2, Up, Failed, "boom")
+	i.UpdateStatusDir(3, Down, Skipped, "")
+
+	var summary []SummaryEntry
+	for _, dir := range []Direction{Up, Down} {
+		b, err := i.SummaryJSON(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var entries []SummaryEntry
+		if err := json.Unmarshal(b, &entries); err != nil {
+			t.Fatal(err)
+		}
+		summary = append(summary, entries...)
+	}
+	// a version removed since the summary was written
+	summary = append(summary, SummaryEntry{Version: 4, Direction: Up, Status: Done})
+	data, err := json.Marshal(summary)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var logged captureLogger
+	SetLogger(&logged)
+	defer SetLogger(nil)
+
+	i.Reset()
+	if err := i.LoadStatus(data); err != nil {
+		t.Fatal(err)
+	}
+	for _, tc := range []struct {
+		version uint
+		dir     Direction
+		status  Status
+		errstr  string
+	}{
+		{1, Up, Done, ""},
+		{2, Up, Failed, "boom"},
+		{3, Up, Pending, ""},
+		{1, Down, Pending, ""},
+		{3, Down, Skipped, ""},
+	} {
+		m := i.migrations[tc.version][tc.dir]
+		if m.Status != tc.status || m.Error != tc.errstr {
+			t.Errorf("expected %v migration %v to be %v (%q), got %v (%q)", tc.dir, tc.version, tc.status, tc.errstr, m.Status, m.Error)
+		}
+	}
+	if len(logged) != 1 || !strings.Contains(logged[0], "unknown up migration 4") {
+		t.Errorf("expected a warning about version 4, got %q", logged)
+	}
+
+	i.Reset()
+	for _, data := range []string{`{"version": 1}`, `[{"version": 1, "direction": "up", "status": "done"}, {"version": 2, "direction": "up", "status": "crashed"}]`} {
+		if err := i.LoadStatus([]byte(data)); err == nil {
+			t.Errorf("expected error loading %s", data)
+		}
+	}
+	if m, _ := i.Up(1); m.Status != Pending {
+		t.Errorf("expected nothing to be restored from an invalid summary, got %v", m.Status)
+	}
+
+	// a dry run restores done migrations as done, not as planned
+	i.DryRun = true
+	if err := i.LoadStatus(data); err != nil {
+		t.Fatal(err)
+	}
+	if m, _ := i.Up(1); m.Status != Done {
+		t.Errorf("expected done migration to be restored in a dry run, got %v", m.Status)
+	}
+}
+
+func TestDryRun(t *testing.T) {
+	i := NewMigrations()
+	i.DryRun = true
+	for _, v := range []uint{1, 2, 3, 4} {
+		i.Append(&Migration{Version: v, Direction: Up, Raw: fmt.Sprintf("%v_foo.up.sql", v)})
+	}
+
+	// version 2 is applied already, the rest would run
+	i.MarkSkipMigrations(2, Up)
+	for _, v := range []uint{3, 4} {
+		i.UpdateStatus(v, Done, "")
+	}
+
+	expected := map[uint]Status{1: Skipped, 2: Skipped, 3: Planned, 4: Planned}
+	for v, status := range expected {
+		if m, _ := i.Up(v); m.Status != status {
+			t.Errorf("expected version %v to be %v, got %v", v, status, m.Status)
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := i.PrintSummaryTo(&buf, Up); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(buf.String(), string(Done)) {
+		t.Errorf("expected plan summary not to report done migrations, got\n%s", buf.String())
+	}
+	if n := strings.Count(buf.String(), string(Planned)); n != 2 {
+		t.Errorf("expected 2 planned migrations in summary, got %v\n%s", n, buf.String())
+	}
+
+	i.DryRun = false
+	i.UpdateStatus(3, Done, "")
+	if m, _ := i.Up(3); m.Status != Done {
+		t.Errorf("expected version 3 to be done without dry run, got %v", m.Status)
+	}
+}
+
+func TestUpdateStatusDir(t *testing.T) {
+	i := NewMigrations()
+	i.Append(&Migration{Version: 1, Direction: Up})
+	i.Append(&Migration{Version: 1, Direction: Down})
+	i.Reset()
+
+	i.UpdateStatusDir(1, Up, Done, "")
+	if m, _ := i.Up(1); m.Status != Done {
+		t.Errorf("expected up migration to be done, got %v", m.Status)
+	}
+	if m, _ := i.Down(1); m.Status != Pending {
+		t.Errorf("expected down migration to stay pending, got %v", m.Status)
+	}
+
+	i.UpdateStatusDir(1, Down, Failed, "boom")
+	if m, _ := i.Down(1); m.Status != Failed || m.Error != "boom" {
+		t.Errorf("expected down migration to have failed, got %v, %v", m.Status, m.Error)
+	}
+	if m, _ := i.Up(1); m.Status != Done || m.Error != "" {
+		t.Errorf("expected up migration to be untouched, got %v, %v", m.Status, m.Error)
+	}
+
+	// unknown versions and directions are ignored
+	i.UpdateStatusDir(2, Up, Done, "")
+	i.UpdateStatus(2, Done, "")
+}
+
+func TestCounts(t *testing.T) {
+	i := NewMigrations()
+	for v := uint(1); v <= 6; v++ {
+		i.Append(&Migration{Version: v, Direction: Up})
+	}
+	// version 7 has no up migration
+	i.Append(&Migration{Version: 7, Direction: Down})
+	i.Reset()
+
+	i.MarkSkipMigrations(1, Up)
+	i.UpdateStatusDir(2, Up, Done, "")
+	i.UpdateStatusDir(3, Up, Done, "")
+	i.UpdateStatusDir(4, Up, Failed, "boom")
+
+	expected := map[Status]int{Skipped: 1, Done: 2, Failed: 1, Pending: 2}
+	if got := i.Counts(Up); !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected %v, got %v", expected, got)
+	}
+	if got := i.Counts(Down); !reflect.DeepEqual(got, map[Status]int{Pending: 1}) {
+		t.Errorf("expected one pending down migration, got %v", got)
+	}
+	if !i.HasFailures() {
+		t.Error("expected failures")
+	}
+
+	i.Reset()
+	if i.HasFailures() {
+		t.Error("expected no failures after reset")
+	}
+}
+
+func TestValidate(t *testing.T) {
+	complete := NewMigrations()
+	complete.Append(&Migration{Version: 1, Direction: Up})
+	complete.Append(&Migration{Version: 1, Direction: Down})
+	complete.Append(&Migration{Version: 2, Direction: Up})
+	complete.Append(&Migration{Version: 2, Direction: Down})
+	if err := complete.Validate(false); err != nil {
+		t.Errorf("expected complete set to be valid, got %v", err)
+	}
+
+	missingDown := NewMigrations()
+	missingDown.Append(&Migration{Version: 1, Direction: Up})
+	missingDown.Append(&Migration{Version: 1, Direction: Down})
+	missingDown.Append(&Migration{Version: 2, Direction: Up})
+	missingDown.Append(&Migration{Version: 3, Direction: Up})
+	err := missingDown.Validate(false)
+	expected := ErrInvalidMigrations{
+		ErrMissingDirection{Version: 2, Direction: Down},
+		ErrMissingDirection{Version: 3, Direction: Down},
+	}
+	if !reflect.DeepEqual(err, expected) {
+		t.Errorf("expected %v, got %v", expected, err)
+	}
+	if err := missingDown.Validate(true); err != nil {
+		t.Errorf("expected missing down migrations to be accepted, got %v", err)
+	}
+
+	missingUp := NewMigrations()
+	missingUp.Append(&Migration{Version: 1, Direction: Up})
+	missingUp.Append(&Migration{Version: 1, Direction: Down})
+	missingUp.Append(&Migration{Version: 2, Direction: Down})
+	for _, downOptional := range []bool{false, true} {
+		err := missingUp.Validate(downOptional)
+		var invalid ErrInvalidMigrations
+		if !errors.As(err, &invalid) || len(invalid) != 1 || invalid[0] != (ErrMissingDirection{Version: 2, Direction: Up}) {
+			t.Errorf("expected version 2 to miss the up migration, got %v", err)
+		}
+	}
+	if msg := "version 2 has no up migration"; !strings.Contains(missingUp.Validate(false).Error(), msg) {
+		t.Errorf("expected error to contain %q, got %v", msg, missingUp.Validate(false))
+	}
+}
+
+func TestFilterByLabel(t *testing.T) {
+	ms := NewMigrations()
+	for _, raw := range []string{
+		"1_create_users.up.sql",
+		"1_create_users.down.sql",
+		"2_seed_users@test-seed.up.sql",
+		"3_partition@prod-only.up.sql",
+		"4_tune@prod-only@staging.up.sql",
+	} {
+		m, err := Parse(raw)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ms.Append(m)
+	}
+	ms.DryRun = true
+	ms.SetPostHook(func(ctx context.Context, db interface{}) error { return nil })
+
+	for label, expected := range map[string][]uint{
+		"prod-only": {1, 3, 4},
+		"test-seed": {1, 2},
+		"staging":   {1, 4},
+		"dev":       {1},
+	} {
+		sub := ms.FilterByLabel(label)
+		if !reflect.DeepEqual(sub.Versions(), expected) {
+			t.Errorf("expected versions %v for %v, got %v", expected, label, sub.Versions())
+		}
+		if !sub.DryRun || sub.PostHook() == nil {
+			t.Errorf("expected DryRun and the hooks to be carried over for %v", label)
+		}
+	}
+
+	sub := ms.FilterByLabel("prod-only")
+	sub.UpdateStatus(3, Done, "")
+	if m, _ := ms.Up(3); m.Status != Pending {
+		t.Errorf("expected original to be unchanged, got %v", m.Status)
+	}
+	if _, ok := sub.Down(1); !ok {
+		t.Error("expected both directions of unlabeled version 1")
+	}
+}
+
+func TestIdentifier(t *testing.T) {
+	ms := NewMigrations()
+	for _, raw := range []string{"3_create_users.up.sql", "3_create_users.down.sql", "4_add_email.up.sql"} {
+		m, err := Parse(raw)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ms.Append(m)
+	}
+
+	if identifier, ok := ms.Identifier(3, Up); !ok || identifier != "create_users" {
+		t.Errorf("expected create_users, got %q, %v", identifier, ok)
+	}
+	if identifier, ok := ms.Identifier(3, Down); !ok || identifier != "create_users" {
+		t.Errorf("expected create_users, got %q, %v", identifier, ok)
+	}
+	if identifier, ok := ms.Identifier(4, Down); ok {
+		t.Errorf("expected no down migration of version 4, got %q", identifier)
+	}
+	if identifier, ok := ms.Identifier(5, Up); ok {
+		t.Errorf("expected unknown version 5, got %q", identifier)
+	}
+}
+
+func TestFindByIdentifier(t *testing.T) {
+	ms := NewMigrations()
+	for _, raw := range []string{
+		"1_create_users.up.sql",
+		"2_add_billing_index.up.sql",
+		"2_add_billing_index.down.sql",
+		"3_Add_Billing_Index.up.sql",
+	} {
+		m, err := Parse(raw)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ms.Append(m)
+	}
+
+	m, ok := ms.FindByIdentifier("add_billing_index", Down)
+	if !ok || m.Version != 2 || m.Direction != Down {
+		t.Fatalf("expected down migration of version 2, got %#v, %v", m, ok)
+	}
+	m.Status = Failed
+	if orig, _ := ms.Down(2); orig.Status != Pending {
+		t.Error("expected a copy, the original was modified")
+	}
+
+	if m, ok := ms.FindByIdentifier("Add_Billing_Index", Up); !ok || m.Version != 3 {
+		t.Errorf("expected exact match of version 3, got %#v, %v", m, ok)
+	}
+	if m, ok := ms.FindByIdentifier("drop_users", Up); ok {
+		t.Errorf("expected no match, got %#v", m)
+	}
+	if m, ok := ms.FindByIdentifier("create_users", Down); ok {
+		t.Errorf("expected no down migration, got %#v", m)
+	}
+
+	if m, ok := ms.FindByIdentifierFold("ADD_BILLING_INDEX", Up); !ok || m.Version != 2 {
+		t.Errorf("expected case insensitive match of version 2, got %#v, %v", m, ok)
+	}
+}
+
+func TestClone(t *testing.T) {
+	ms := NewMigrations()
+	ms.Append(&Migration{Version: 1, Direction: Up, Raw: "1_foo.up.sql", Status: Pending, labels: "prod"})
+	ms.Append(&Migration{Version: 1, Direction: Down, Raw: "1_foo.down.sql", Status: Pending})
+	ms.Append(&Migration{Version: 2, Direction: Up, Raw: "2_foo.up.sql", Status: Pending})
+
+	clone := ms.Clone()
+	clone.UpdateStatus(1, Failed, "boom")
+	clone.Append(&Migration{Version: 3, Direction: Up, Raw: "3_foo.up.sql"})
+	if m, _ := clone.Up(1); !m.HasLabel("prod") {
+		t.Errorf("expected clone to keep the labels, got %v", m.Labels())
+	}
+
+	if orig, _ := ms.Down(1); orig.Status != Pending || orig.Error != "" {
+		t.Errorf("expected original to stay pending, got %#v", orig)
+	}
+	if orig, _ := ms.Up(1); orig.Status != Pending || orig.Error != "" {
+		t.Errorf("expected original to be unchanged, got %#v", orig)
+	}
+	if !reflect.DeepEqual(ms.Versions(), []uint{1, 2}) {
+		t.Errorf("expected original versions [1 2], got %v", ms.Versions())
+	}
+	if !reflect.DeepEqual(clone.Versions(), []uint{1, 2, 3}) {
+		t.Errorf("expected cloned versions [1 2 3], got %v", clone.Versions())
+	}
+	if m, _ := clone.Down(1); m.Status != Failed {
+		t.Errorf("expected clone to be failed, got %v", m.Status)
+	}
+}
+
+func TestApplyHistory(t *testing.T) {
+	ms := NewMigrations()
+	ms.DryRun = true
+	for _, v := range []uint{1, 2, 3, 4} {
+		ms.Append(&Migration{Version: v, Direction: Up, Raw: fmt.Sprintf("%v_foo.up.sql", v)})
+	}
+	ms.Append(&Migration{Version: 2, Direction: Down, Raw: "2_foo.down.sql"})
+	ms.UpdateStatusDir(3, Up, Failed, "boom")
+
+	// 7 is unknown
+	ms.ApplyHistory([]uint{1, 2, 7}, Up)
+
+	expected := map[uint]Status{1: Done, 2: Done, 3: Pending, 4: Pending}
+	for version, status := range expected {
+		if m, _ := ms.Up(version); m.Status != status || m.Error != "" {
+			t.Errorf("expected version %v to be %v, got %v (%v)", version, status, m.Status, m.Error)
+		}
+	}
+	if m, _ := ms.Down(2); m.Status != "" {
+		t.Errorf("expected down migration to be untouched, got %v", m.Status)
+	}
+	if _, ok := ms.Up(7); ok {
+		t.Error("expected unknown version not to be added")
+	}
+}
+
+func TestMigrationString(t *testing.T) {
+	for _, tc := range []struct {
+		m        Migration
+		expected string
+	}{
+		{Migration{Version: 1, Direction: Up, Identifier: "create_users", Status: Done}, "1/up create_users (done)"},
+		{Migration{Version: 2, Direction: Down, Identifier: "add_index", Status: Failed, Error: "syntax error"}, "2/down add_index (failed: syntax error)"},
+		{Migration{Version: 3, Direction: Up, Identifier: "foo"}, "3/up foo (pending)"},
+	} {
+		if got := tc.m.String(); got != tc.expected {
+			t.Errorf("expected %q, got %q", tc.expected, got)
+		}
+	}
+	if got := fmt.Sprint(&Migration{Version: 1, Direction: Up, Identifier: "create_users", Status: Done}); got != "1/up create_users (done)" {
+		t.Errorf("expected pointers to format the same, got %q", got)
+	}
+}
+
+func TestFirstNextDir(t *testing.T) {
+	ms := NewMigrations()
+	for _, m := range []*Migration{
+		{Version: 1, Direction: Up},
+		{Version: 2, Direction: Up},
+		{Version: 2, Direction: Down},
+		{Version: 3, Direction: Up},
+		{Version: 4, Direction: Down},
+		{Version: 5, Direction: Up},
+		{Version: 6, Direction: Up},
+		{Version: 6, Direction: Down},
+	} {
+		ms.Append(m)
+	}
+	for dir, expected := range map[Direction][]uint{
+		Up:   {1, 2, 3, 5, 6},
+		Down: {2, 4, 6},
+	} {
+		var versions []uint
+		for v, ok := ms.FirstDir(dir); ok; v, ok = ms.NextDir(v, dir) {
+			versions = append(versions, v)
+		}
+		if !reflect.DeepEqual(versions, expected) {
+			t.Errorf("expected %v versions %v, got %v", dir, expected, versions)
+		}
+	}
+	// starting from a version without a down migration
+	if v, ok := ms.NextDir(3, Down); !ok || v != 4 {
+		t.Errorf("expected 4, got %v, %v", v, ok)
+	}
+	if _, ok := ms.NextDir(7, Up); ok {
+		t.Error("expected unknown version to have no next version")
+	}
+	if _, ok := NewMigrations().FirstDir(Up); ok {
+		t.Error("expected no first version")
+	}
+}
+
+func TestConflicts(t *testing.T) {
+	ms := NewMigrations()
+	for _, m := range []*Migration{
+		{Version: 3, Direction: Up, Identifier: "users", Raw: "3_users.up.sql"},
+		{Version: 3, Direction: Up, Identifier: "accounts", Raw: "3_accounts.up.sql"},
+		{Version: 3, Direction: Down, Identifier: "users", Raw: "3_users.down.sql"},
+		{Version: 1, Direction: Up, Identifier: "init", Raw: "1_init.up.sql"},
+		{Version: 1, Direction: Down, Identifier: "init", Raw: "1_init.down.sql"},
+		{Version: 1, Direction: Down, Identifier: "other", Raw: "1_other.down.sql"},
+		{Version: 3, Direction: Down, Identifier: "accounts", Raw: "3_accounts.down.sql"},
+		{Version: 2, Direction: Up, Identifier: "seed", Raw: "2_seed.up.sql"},
+	} {
+		// the result is ignored on purpose
+		ms.Append(m)
+	}
+	if conflicts := ms.Conflicts(); !reflect.DeepEqual(conflicts, []uint{1, 3}) {
+		t.Errorf("expected conflicts [1 3], got %v", conflicts)
+	}
+	if m, _ := ms.Up(3); m.Identifier != "users" {
+		t.Errorf("expected the first migration to be kept, got %v", m.Identifier)
+	}
+	if conflicts := ms.Clone().Conflicts(); !reflect.DeepEqual(conflicts, []uint{1, 3}) {
+		t.Errorf("expected the clone to keep the conflicts, got %v", conflicts)
+	}
+	if conflicts := NewMigrations().Conflicts(); len(conflicts) != 0 {
+		t.Errorf("expected no conflicts, got %v", conflicts)
+	}
+}
+
+func TestPending(t *testing.T) {
+	ms := NewMigrations()
+	for _, v := range []uint{1, 2, 3, 4, 5, 6} {
+		ms.Append(&Migration{Version: v, Direction: Up, Raw: fmt.Sprintf("%v_foo.up.sql", v)})
+	}
+	for _, v := range []uint{2, 3, 6} {
+		ms.Append(&Migration{Version: v, Direction: Down, Raw: fmt.Sprintf("%v_foo.down.sql", v)})
+	}
+	ms.ApplyHistory([]uint{1, 3}, Up)
+	ms.UpdateStatusDir(4, Up, Failed, "boom")
+	ms.UpdateStatusDir(5, Up, Skipped, "")
+
+	if pending := ms.Pending(Up); !reflect.DeepEqual(pending, []uint{2, 6}) {
+		t.Errorf("expected pending up versions [2 6], got %v", pending)
+	}
+
+	ms.ApplyHistory([]uint{3}, Down)
+	if pending := ms.Pending(Down); !reflect.DeepEqual(pending, []uint{6, 2}) {
+		t.Errorf("expected pending down versions [6 2], got %v", pending)
+	}
+
+	if pending := NewMigrations().Pending(Up); len(pending) != 0 {
+		t.Errorf("expected no pending versions, got %v", pending)
+	}
+}
+
+func TestParseStatus(t *testing.T) {
+	for _, status := range []Status{Skipped, Pending, Done, Failed, Planned} {
+		if !status.Valid() {
+			t.Errorf("expected %v to be valid", status)
+		}
+		parsed, err := ParseStatus(string(status))
+		if err != nil || parsed != status {
+			t.Errorf("expected %v, got %v, %v", status, parsed, err)
+		}
+	}
+	for s, expected := range map[string]Status{"Done": Done, "FAILED": Failed, " pending\n": Pending} {
+		if parsed, err := ParseStatus(s); err != nil || parsed != expected {
+			t.Errorf("expected %q to parse as %v, got %v, %v", s, expected, parsed, err)
+		}
+	}
+	for _, s := range []string{"", "dne", "applied"} {
+		if _, err := ParseStatus(s); err == nil {
+			t.Errorf("expected %q to be invalid", s)
+		}
+		if Status(s).Valid() {
+			t.Errorf("expected %q not to be valid", s)
+		}
+	}
+}
+
+func TestWalk(t *testing.T) {
+	ms := NewMigrations()
+	for _, v := range []uint{5, 1, 3, 7} {
+		ms.Append(&Migration{Version: v, Direction: Up})
+	}
+	for _, v := range []uint{1, 5, 7} {
+		ms.Append(&Migration{Version: v, Direction: Down})
+	}
+
+	walk := func(dir Direction, stopAt uint) ([]uint, error) {
+		var versions []uint
+		err := ms.Walk(dir, func(m *Migration) error {
+			if m.Direction != dir {
+				t.Errorf("expected direction %v, got %v", dir, m.Direction)
+			}
+			versions = append(versions, m.Version)
+			m.Status = Failed
+			if m.Version == stopAt {
+				return errors.New("stop")
+			}
+			return nil
+		})
+		return versions, err
+	}
+
+	if versions, err := walk(Up, 0); err != nil || !reflect.DeepEqual(versions, []uint{1, 3, 5, 7}) {
+		t.Errorf("expected [1 3 5 7], got %v, %v", versions, err)
+	}
+	// version 3 has no down migration
+	if versions, err := walk(Down, 0); err != nil || !reflect.DeepEqual(versions, []uint{7, 5, 1}) {
+		t.Errorf("expected [7 5 1], got %v, %v", versions, err)
+	}
+	if versions, err := walk(Up, 3); err == nil || err.Error() != "stop" || !reflect.DeepEqual(versions, []uint{1, 3}) {
+		t.Errorf("expected to stop after [1 3], got %v, %v", versions, err)
+	}
+	if ms.HasFailures() {
+		t.Error("expected Walk to pass copies")
+	}
+}
+
+func TestDownOrder(t *testing.T) {
+	ms := NewMigrations()
+	for _, v := range []uint{5, 1, 3, 7} {
+		ms.Append(&Migration{Version: v, Direction: Up})
+	}
+	for _, v := range []uint{1, 5, 7} {
+		ms.Append(&Migration{Version: v, Direction: Down})
+	}
+
+	versions := ms.DownOrder()
+	if !reflect.DeepEqual(versions, []uint{7, 5, 3, 1}) {
+		t.Errorf("expected [7 5 3 1], got %v", versions)
+	}
+	versions[0] = 42
+	if last, _ := ms.Last(); last != 7 {
+		t.Error("expected DownOrder to return a copy")
+	}
+
+	var walked []uint
+	err := ms.WalkDown(func(m *Migration) error {
+		if m.Direction != Down {
+			t.Errorf("expected direction %v, got %v", Down, m.Direction)
+		}
+		walked = append(walked, m.Version)
+		return nil
+	})
+	// version 3 has no down migration
+	if err != nil || !reflect.DeepEqual(walked, []uint{7, 5, 1}) {
+		t.Errorf("expected [7 5 1], got %v, %v", walked, err)
+	}
+}
+
+func TestParallelGroups(t *testing.T) {
+	ms := NewMigrations()
+	for _, raw := range []string{
+		"1_create_users.up.sql",
+		"2_index_users+parallel.up.sql",
+		"3_index_orders+parallel.up.sql",
+		"3_index_orders+parallel.down.sql",
+		"4_index_items+parallel@prod.up.sql",
+		"5_backfill.up.sql",
+		"6_index_logs+parallel.up.sql",
+		"6_index_logs+parallel.down.sql",
+		"7_drop_legacy.up.sql",
+		"7_drop_legacy+parallel.down.sql",
+	} {
+		m, err := Parse(raw)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ms.Append(m)
+	}
+	if m, _ := ms.Up(4); !m.Parallel || m.Identifier != "index_items" || !reflect.DeepEqual(m.Labels(), []string{"prod"}) {
+		t.Errorf("unexpected parallel migration %#v", m)
+	}
+
+	if groups, expected := ms.ParallelGroups(Up), [][]uint{{1}, {2, 3, 4}, {5}, {6}, {7}}; !reflect.DeepEqual(groups, expected) {
+		t.Errorf("expected up groups %v, got %v", expected, groups)
+	}
+	// versions 4 and 5 have no down migration to run in between
+	if groups, expected := ms.ParallelGroups(Down), [][]uint{{7, 6, 3}}; !reflect.DeepEqual(groups, expected) {
+		t.Errorf("expected down groups %v, got %v", expected, groups)
+	}
+}
+
+func TestDiff(t *testing.T) {
+	deployed := NewMigrations()
+	deployed.Append(&Migration{Version: 1, Direction: Up, Checksum: "a"})
+	deployed.Append(&Migration{Version: 2, Direction: Up, Checksum: "b"})
+	deployed.Append(&Migration{Version: 2, Direction: Down, Checksum: "c"})
+	deployed.Append(&Migration{Version: 3, Direction: Up, Checksum: "d"})
+	deployed.Append(&Migration{Version: 4, Direction: Up})
+
+	release := NewMigrations()
+	release.Append(&Migration{Version: 1, Direction: Up, Checksum: "a"})
+	release.Append(&Migration{Version: 2, Direction: Up, Checksum: "b"})
+	release.Append(&Migration{Version: 2, Direction: Down, Checksum: "edited"})
+	release.Append(&Migration{Version: 4, Direction: Up, Checksum: "e"})
+	release.Append(&Migration{Version: 5, Direction: Up})
+	release.Append(&Migration{Version: 6, Direction: Up})
+
+	added, removed := release.Diff(deployed)
+	if !reflect.DeepEqual(added, []uint{5, 6}) {
+		t.Errorf("expected added [5 6], got %v", added)
+	}
+	if !reflect.DeepEqual(removed, []uint{3}) {
+		t.Errorf("expected removed [3], got %v", removed)
+	}
+	// version 4 has no checksum in the deployed set
+	if changed := release.Changed(deployed); !reflect.DeepEqual(changed, []uint{2}) {
+		t.Errorf("expected changed [2], got %v", changed)
+	}
+
+	if added, removed := release.Diff(release.Clone()); added != nil || removed != nil {
+		t.Errorf("expected no difference, got %v, %v", added, removed)
+	}
+}
+
+func TestOffset(t *testing.T) {
+	ms := NewMigrations()
+	for _, v := range []uint{1, 3, 5} {
+		ms.Append(&Migration{Version: v, Identifier: "foo", Direction: Up, Raw: fmt.Sprintf("%v_foo.up.sql", v)})
+	}
+	ms.Append(&Migration{Version: 3, Identifier: "foo", Direction: Down, Raw: "3_foo.down.sql"})
+
+	var statusChanges int
+	ms.OnStatusChange(func(m Migration) { statusChanges++ })
+	ms.DryRun = true
+	ms.SetPreHook(func(ctx context.Context, db interface{}) error { return nil })
+	shifted, err := ms.Offset(1000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !shifted.DryRun || shifted.PreHook() == nil {
+		t.Error("expected DryRun and the hooks to be kept")
+	}
+	tenant := shifted.Subset(1002, 1010)
+	if !reflect.DeepEqual(tenant.Versions(), []uint{1003, 1005}) {
+		t.Fatalf("expected versions [1003 1005], got %v", tenant.Versions())
+	}
+	var traversed []uint
+	for v, ok := tenant.First(); ok; v, ok = tenant.Next(v) {
+		traversed = append(traversed, v)
+	}
+	if !reflect.DeepEqual(traversed, []uint{1003, 1005}) {
+		t.Errorf("expected to traverse [1003 1005], got %v", traversed)
+	}
+	if m, ok := tenant.Down(1003); !ok || m.Version != 1003 || m.Raw != "3_foo.down.sql" || m.Identifier != "foo" {
+		t.Errorf("expected shifted down migration of 3_foo.down.sql, got %#v, %v", m, ok)
+	}
+
+	tenant.UpdateStatus(1003, Failed, "")
+	if statusChanges != 2 {
+		t.Errorf("expected the callback to be kept, got %v calls", statusChanges)
+	}
+	if !reflect.DeepEqual(ms.Versions(), []uint{1, 3, 5}) {
+		t.Errorf("expected original versions [1 3 5], got %v", ms.Versions())
+	}
+	if m, _ := ms.Up(3); m.Version != 3 || m.Status == Failed {
+		t.Errorf("expected original to be unchanged, got %#v", m)
+	}
+
+	if _, err := ms.Offset(^uint(0)); err == nil {
+		t.Error("expected overflowing offset to fail")
+	}
+}
+
+func TestPeek(t *testing.T) {
+	ms := NewMigrations()
+	for _, m := range []*Migration{
+		{Version: 1, Direction: Up, Raw: "1_foo.up.sql"},
+		{Version: 1, Direction: Down, Raw: "1_foo.down.sql"},
+		{Version: 3, Direction: Up, Raw: "3_foo.up.sql"},
+		{Version: 5, Direction: Up, Raw: "5_foo.up.sql"},
+		{Version: 5, Direction: Down, Raw: "5_foo.down.sql"},
+	} {
+		ms.Append(m)
+	}
+
+	if m, ok := ms.PeekNext(1, Up); !ok || m.Raw != "3_foo.up.sql" {
+		t.Errorf("expected 3_foo.up.sql, got %#v, %v", m, ok)
+	}
+	if m, ok := ms.PeekNext(3, Down); !ok || m.Raw != "5_foo.down.sql" {
+		t.Errorf("expected 5_foo.down.sql, got %#v, %v", m, ok)
+	}
+	if m, ok := ms.PeekPrev(5, Up); !ok || m.Raw != "3_foo.up.sql" {
+		t.Errorf("expected 3_foo.up.sql, got %#v, %v", m, ok)
+	}
+	if m, ok := ms.PeekPrev(3, Down); !ok || m.Raw != "1_foo.down.sql" {
+		t.Errorf("expected 1_foo.down.sql, got %#v, %v", m, ok)
+	}
+
+	for name, peek := range map[string]func() (*Migration, bool){
+		"next of last":      func() (*Migration, bool) { return ms.PeekNext(5, Up) },
+		"prev of first":     func() (*Migration, bool) { return ms.PeekPrev(1, Up) },
+		"next of unknown":   func() (*Migration, bool) { return ms.PeekNext(2, Up) },
+		"missing direction": func() (*Migration, bool) { return ms.PeekNext(1, Down) },
+		"prev missing down": func() (*Migration, bool) { return ms.PeekPrev(5, Down) },
+	} {
+		if m, ok := peek(); ok {
+			t.Errorf("%v: expected false, got %#v", name, m)
+		}
+	}
+
+	m, _ := ms.PeekNext(3, Up)
+	m.Status = Failed
+	if orig, _ := ms.Up(5); orig.Status == Failed {
+		t.Error("expected a copy, the original was modified")
+	}
+}
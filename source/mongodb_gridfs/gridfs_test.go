@@ -0,0 +1,115 @@
+package mongodbgridfs
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"io/ioutil"
+	"strings"
+	"testing"
+	"time"
+
+	st "github.com/nokia/migrate/v4/source/testing"
+)
+
+// fakeBucket is a Bucket serving files with their name as id.
+type fakeBucket struct {
+	files    []File
+	contents map[string]string
+}
+
+func newFakeBucket(contents map[string]string) *fakeBucket {
+	b := &fakeBucket{contents: make(map[string]string)}
+	for name, content := range contents {
+		b.add(name, content, time.Unix(0, 0))
+	}
+	return b
+}
+
+func (b *fakeBucket) add(name, content string, uploaded time.Time) {
+	id := name + "@" + uploaded.String()
+	b.files = append(b.files, File{ID: id, Name: name, Length: int64(len(content)), UploadDate: uploaded})
+	b.contents[id] = content
+}
+
+func (b *fakeBucket) Files(ctx context.Context) ([]File, error) {
+	return b.files, nil
+}
+
+func (b *fakeBucket) Open(ctx context.Context, id interface{}) (io.ReadCloser, error) {
+	content, ok := b.contents[id.(string)]
+	if !ok {
+		return nil, errors.New("file not found")
+	}
+	return ioutil.NopCloser(strings.NewReader(content)), nil
+}
+
+func Test(t *testing.T) {
+	bucket := newFakeBucket(map[string]string{
+		"1_foobar.up.sql":     "1 up",
+		"1_foobar.down.sql":   "1 down",
+		"3_foobar.up.sql":     "3 up",
+		"4_foobar.up.sql":     "4 up",
+		"4_foobar.down.sql":   "4 down",
+		"5_foobar.down.sql":   "5 down",
+		"7_foobar.up.sql":     "7 up",
+		"7_foobar.down.sql":   "7 down",
+		"not-a-migration.txt": "",
+	})
+	d, err := WithInstance(bucket, &Config{BucketName: DefaultBucketName})
+	if err != nil {
+		t.Fatal(err)
+	}
+	st.Test(t, d)
+}
+
+func TestReadContent(t *testing.T) {
+	bucket := newFakeBucket(map[string]string{
+		"prod/2_foobar.up.sql":    "2 up",
+		"prod/1_foobar.up.sql":    "1 up",
+		"prod/1_foobar.down.sql":  "",
+		"staging/3_foobar.up.sql": "3 up",
+	})
+	// a newer revision of the same file name wins
+	bucket.add("prod/2_foobar.up.sql", "2 up, revised", time.Unix(60, 0))
+
+	d, err := WithInstance(bucket, &Config{BucketName: "migrations", Prefix: "prod/"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var versions []uint
+	for v, err := d.First(); err == nil; v, err = d.Next(v) {
+		versions = append(versions, v)
+	}
+	if len(versions) != 2 || versions[0] != 1 || versions[1] != 2 {
+		t.Errorf("expected versions [1 2], got %v", versions)
+	}
+
+	r, identifier, location, _, err := d.ReadUp(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	body, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(body) != "2 up, revised" || identifier != "foobar" || location != "prod/2_foobar.up.sql" {
+		t.Errorf("unexpected read %q, %q, %q", body, identifier, location)
+	}
+
+	if !d.(*GridFS).IsEmptyDown(1) {
+		t.Error("expected empty down migration for version 1")
+	}
+	if _, _, _, _, err := d.ReadDown(2); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("expected %v, got %v", fs.ErrNotExist, err)
+	}
+}
+
+func TestOpenWithoutDatabase(t *testing.T) {
+	if _, err := (&GridFS{}).Open("gridfs://localhost:27017"); !errors.Is(err, ErrNoDatabaseName) {
+		t.Errorf("expected %v, got %v", ErrNoDatabaseName, err)
+	}
+}
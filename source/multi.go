@@ -0,0 +1,161 @@
+package source
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+)
+
+// NewMultiDriver returns a driver presenting the migrations of drivers as a
+// single ordered stream, e.g. base migrations embedded into the binary and
+// customer specific ones from a bucket. Every version must be provided by a
+// single driver, a version found in several drivers is reported as
+// ErrDuplicateMigration. Reads and status updates of a version are passed
+// to the driver providing it. Closing the returned driver closes drivers.
+func NewMultiDriver(drivers ...Driver) (Driver, error) {
+	md := &multiDriver{
+		drivers: drivers,
+		owners:  make(map[uint]Driver),
+	}
+	for _, d := range drivers {
+		version, err := d.First()
+		for ; err == nil; version, err = d.Next(version) {
+			if owner, dup := md.owners[version]; dup {
+				return nil, ErrDuplicateMigration{
+					Migration:   Migration{Version: version, Raw: location(d, version)},
+					ExistingRaw: location(owner, version),
+				}
+			}
+			md.owners[version] = d
+			md.index = append(md.index, version)
+		}
+		if !errors.Is(err, os.ErrNotExist) {
+			return nil, err
+		}
+	}
+	sort.Slice(md.index, func(x, y int) bool {
+		return md.index[x] < md.index[y]
+	})
+	return md, nil
+}
+
+// location returns where d reads version from.
+func location(d Driver, version uint) string {
+	for _, read := range []func(uint) (io.ReadCloser, string, string, MigrationFunc, error){d.ReadUp, d.ReadDown} {
+		r, _, location, _, err := read(version)
+		if r != nil {
+			r.Close()
+		}
+		if err == nil {
+			return location
+		}
+	}
+	return "<unknown>"
+}
+
+type multiDriver struct {
+	drivers []Driver
+	owners  map[uint]Driver
+	index   uintSlice
+}
+
+// Open is part of Driver interface implementation. A multi driver can only
+// be created with NewMultiDriver.
+func (md *multiDriver) Open(url string) (Driver, error) {
+	return nil, errors.New("multi driver can't be opened from a URL, use NewMultiDriver")
+}
+
+// Close closes all drivers and returns the first error.
+func (md *multiDriver) Close() error {
+	var first error
+	for _, d := range md.drivers {
+		if err := d.Close(); err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
+}
+
+func (md *multiDriver) First() (uint, error) {
+	if len(md.index) == 0 {
+		return 0, &os.PathError{Op: "first", Path: "multi", Err: os.ErrNotExist}
+	}
+	return md.index[0], nil
+}
+
+func (md *multiDriver) Prev(version uint) (uint, error) {
+	pos := md.index.Search(version)
+	if pos < len(md.index) && md.index[pos] == version && pos > 0 {
+		return md.index[pos-1], nil
+	}
+	return 0, &os.PathError{Op: fmt.Sprintf("prev for version %v", version), Path: "multi", Err: os.ErrNotExist}
+}
+
+func (md *multiDriver) Next(version uint) (uint, error) {
+	pos := md.index.Search(version)
+	if pos < len(md.index) && md.index[pos] == version && pos+1 < len(md.index) {
+		return md.index[pos+1], nil
+	}
+	return 0, &os.PathError{Op: fmt.Sprintf("next for version %v", version), Path: "multi", Err: os.ErrNotExist}
+}
+
+func (md *multiDriver) ReadUp(version uint) (io.ReadCloser, string, string, MigrationFunc, error) {
+	d, ok := md.owners[version]
+	if !ok {
+		return nil, "", "", nil, &os.PathError{Op: fmt.Sprintf("read up for version %v", version), Path: "multi", Err: os.ErrNotExist}
+	}
+	return d.ReadUp(version)
+}
+
+func (md *multiDriver) ReadDown(version uint) (io.ReadCloser, string, string, MigrationFunc, error) {
+	d, ok := md.owners[version]
+	if !ok {
+		return nil, "", "", nil, &os.PathError{Op: fmt.Sprintf("read down for version %v", version), Path: "multi", Err: os.ErrNotExist}
+	}
+	return d.ReadDown(version)
+}
+
+// MarkSkipMigrations is passed to all drivers, as each of them has to skip
+// its own migrations older or newer than version.
+func (md *multiDriver) MarkSkipMigrations(version uint, dir Direction) {
+	for _, d := range md.drivers {
+		d.MarkSkipMigrations(version, dir)
+	}
+}
+
+func (md *multiDriver) UpdateStatus(version uint, status Status, errstr string) {
+	if d, ok := md.owners[version]; ok {
+		d.UpdateStatus(version, status, errstr)
+	}
+}
+
+// UpdateStatusDir is like UpdateStatus, but only updates the migration of
+// direction dir if the owning driver supports it.
+func (md *multiDriver) UpdateStatusDir(version uint, dir Direction, status Status, errstr string) {
+	if d, ok := md.owners[version]; ok {
+		UpdateStatusDir(d, version, dir, status, errstr)
+	}
+}
+
+// IsEmptyDown reports whether the driver providing version flags its down
+// migration as empty.
+func (md *multiDriver) IsEmptyDown(version uint) bool {
+	d, ok := md.owners[version]
+	return ok && IsEmptyDown(d, version)
+}
+
+// IsFunc reports whether the driver providing version reports its
+// migration in direction dir as a go migration function.
+func (md *multiDriver) IsFunc(version uint, dir Direction) bool {
+	d, ok := md.owners[version]
+	return ok && IsFunc(d, version, dir)
+}
+
+// PrintSummary prints the summary of every driver.
+func (md *multiDriver) PrintSummary(dir Direction) {
+	for _, d := range md.drivers {
+		d.PrintSummary(dir)
+	}
+}
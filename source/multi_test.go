@@ -0,0 +1,119 @@
+//go:build go1.16
+// +build go1.16
+
+package source_test
+
+import (
+	"errors"
+	"testing"
+	"testing/fstest"
+
+	"github.com/nokia/migrate/v4/source"
+	"github.com/nokia/migrate/v4/source/iofs"
+	"github.com/nokia/migrate/v4/source/memory"
+	st "github.com/nokia/migrate/v4/source/testing"
+)
+
+func TestMultiDriver(t *testing.T) {
+	base, err := iofs.New(fstest.MapFS{
+		"migrations/1_foobar.up.sql":   &fstest.MapFile{Data: []byte("1 up")},
+		"migrations/1_foobar.down.sql": &fstest.MapFile{Data: []byte("1 down")},
+		"migrations/4_foobar.up.sql":   &fstest.MapFile{Data: []byte("4 up")},
+		"migrations/4_foobar.down.sql": &fstest.MapFile{Data: []byte("4 down")},
+		"migrations/7_foobar.up.sql":   &fstest.MapFile{Data: []byte("7 up")},
+		"migrations/7_foobar.down.sql": &fstest.MapFile{Data: []byte("7 down")},
+	}, "migrations")
+	if err != nil {
+		t.Fatal(err)
+	}
+	overrides := memory.New().
+		Add(3, source.Up, "3 up").
+		Add(5, source.Down, "5 down")
+
+	d, err := source.NewMultiDriver(base, overrides)
+	if err != nil {
+		t.Fatal(err)
+	}
+	st.Test(t, d)
+}
+
+func TestMultiDriverReads(t *testing.T) {
+	base, err := iofs.New(fstest.MapFS{
+		"migrations/1_base.up.sql": &fstest.MapFile{Data: []byte("1 up")},
+		"migrations/3_base.up.sql": &fstest.MapFile{Data: []byte("3 up")},
+	}, "migrations")
+	if err != nil {
+		t.Fatal(err)
+	}
+	overrides := memory.New().Add(2, source.Up, "2 up")
+
+	d, err := source.NewMultiDriver(base, overrides)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var bodies []string
+	for v, err := d.First(); err == nil; v, err = d.Next(v) {
+		body, _, _, _, err := source.ReadUpString(d, v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		bodies = append(bodies, body)
+	}
+	if len(bodies) != 3 || bodies[0] != "1 up" || bodies[1] != "2 up" || bodies[2] != "3 up" {
+		t.Errorf("expected bodies in version order, got %v", bodies)
+	}
+
+	r, _, location, _, err := d.ReadUp(3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.Close()
+	if location != "migrations/3_base.up.sql" {
+		t.Errorf("expected version 3 to be read from the iofs driver, got %v", location)
+	}
+
+	if err := d.Close(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestMultiDriverDuplicate(t *testing.T) {
+	base, err := iofs.New(fstest.MapFS{
+		"migrations/1_base.up.sql": &fstest.MapFile{Data: []byte("1 up")},
+		"migrations/2_base.up.sql": &fstest.MapFile{Data: []byte("2 up")},
+	}, "migrations")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = source.NewMultiDriver(base, memory.New().Add(2, source.Down, "2 down"))
+	var dup source.ErrDuplicateMigration
+	if !errors.As(err, &dup) {
+		t.Fatalf("expected ErrDuplicateMigration, got %v", err)
+	}
+	if dup.Version != 2 {
+		t.Errorf("expected duplicate version 2, got %v", dup.Version)
+	}
+}
+
+func TestMultiDriverIsEmptyDown(t *testing.T) {
+	base, err := iofs.New(fstest.MapFS{
+		"migrations/1_base.up.sql":   &fstest.MapFile{Data: []byte("1 up")},
+		"migrations/1_base.down.sql": &fstest.MapFile{Data: []byte(" \n")},
+		"migrations/3_base.up.sql":   &fstest.MapFile{Data: []byte("3 up")},
+		"migrations/3_base.down.sql": &fstest.MapFile{Data: []byte("3 down")},
+	}, "migrations")
+	if err != nil {
+		t.Fatal(err)
+	}
+	md, err := source.NewMultiDriver(base, memory.New().Add(2, source.Up, "2 up"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, d := range []source.Driver{md, source.NewCachingDriver(md), source.WithEnvExpansion(md, false)} {
+		for version, expected := range map[uint]bool{1: true, 2: false, 3: false, 4: false} {
+			if got := source.IsEmptyDown(d, version); got != expected {
+				t.Errorf("expected IsEmptyDown(%v) of %T to be %v, got %v", version, d, expected, got)
+			}
+		}
+	}
+}
@@ -1,38 +1,185 @@
 package source
 
 import (
+	"errors"
 	"fmt"
 	"regexp"
+	"sort"
 	"strconv"
+	"strings"
 )
 
 var ErrParse = fmt.Errorf("no match")
 
+// Parser returns the Migration for a migration file name, or ErrParse if
+// the file is not a migration. It must set Version, Identifier and
+// Direction, and should set Raw to the file name and Status to Pending.
+type Parser func(raw string) (*Migration, error)
+
 var (
-	DefaultParse = Parse
-	DefaultRegex = Regex
+	DefaultParse Parser = Parse
+	DefaultRegex        = Regex
 )
 
+// RegisterParser replaces DefaultParse, which is used by the source drivers
+// to recognize migration files. Passing nil restores Parse.
+// It must be called before opening any source.
+func RegisterParser(p Parser) {
+	if p == nil {
+		p = Parse
+	}
+	DefaultParse = p
+}
+
 // Regex matches the following pattern:
 //  123_name.up.ext
 //  123_name.down.ext
-var Regex = regexp.MustCompile(`^([0-9]+)_(.*)\.(` + string(Down) + `|` + string(Up) + `)\.(.*)$`)
+// The version may also be separated from the name by a dash, e.g.
+// 123-name.up.ext, and the direction is matched case insensitively.
+// The name may be followed by labels, each prefixed with @, e.g.
+// 123_name@prod-only.up.ext, and by ParallelMarker, e.g.
+// 123_name+parallel.up.ext.
+var Regex = regexp.MustCompile(`^([0-9]+)[_-](.*)\.(?i:(` + string(Down) + `|` + string(Up) + `))\.(.*)$`)
 
-// Parse returns Migration for matching Regex pattern.
+// Parse returns Migration for matching Regex pattern. Leading zeros of the
+// version are ignored and the direction is normalized to lower case.
+// Labels following the name are split off, see Migration.Labels,
+// ParallelMarker sets Parallel. The name with underscores replaced by
+// spaces is the Description.
+// Names that don't match are rejected with an error wrapping ErrParse.
 func Parse(raw string) (*Migration, error) {
 	m := Regex.FindStringSubmatch(raw)
 	if len(m) == 5 {
-		versionUint64, err := strconv.ParseUint(m[1], 10, 64)
+		version, err := ParseVersion(m[1])
 		if err != nil {
 			return nil, err
 		}
+		identifier, labels := splitLabels(m[2])
+		parallel := strings.HasSuffix(identifier, ParallelMarker)
+		identifier = strings.TrimSuffix(identifier, ParallelMarker)
 		return &Migration{
-			Version:    uint(versionUint64),
-			Identifier: m[2],
-			Direction:  Direction(m[3]),
-			Raw:        raw,
-			Status:     Pending,
+			Version:     version,
+			Identifier:  identifier,
+			Description: strings.ReplaceAll(identifier, "_", " "),
+			Direction:   Direction(strings.ToLower(m[3])),
+			Raw:         raw,
+			Status:      Pending,
+			labels:      labels,
+			Parallel:    parallel,
 		}, nil
 	}
-	return nil, ErrParse
+	return nil, fmt.Errorf("%w: %q is not named <version>_<name>.<up|down>.<ext>", ErrParse, raw)
+}
+
+// ParseVersion parses the decimal version s. Versions are uint, so on
+// 32-bit platforms versions above 4294967295, like many timestamps, can't
+// be represented; an error wrapping strconv.ErrRange is returned for them
+// instead of a truncated version.
+func ParseVersion(s string) (uint, error) {
+	v, err := strconv.ParseUint(s, 10, strconv.IntSize)
+	if errors.Is(err, strconv.ErrRange) {
+		return 0, fmt.Errorf("version %v exceeds the %v-bit uint of this platform: %w", s, strconv.IntSize, strconv.ErrRange)
+	}
+	if err != nil {
+		return 0, err
+	}
+	return uint(v), nil
+}
+
+// ParallelMarker follows the name of a migration that may run concurrently
+// with its neighbouring parallel migrations, see Migrations.ParallelGroups.
+const ParallelMarker = "+parallel"
+
+// splitLabels splits name@label1@label2 into the name and its labels,
+// sorted and joined by commas.
+func splitLabels(name string) (string, string) {
+	parts := strings.Split(name, "@")
+	var labels []string
+	for _, label := range parts[1:] {
+		if label != "" {
+			labels = append(labels, label)
+		}
+	}
+	sort.Strings(labels)
+	return parts[0], strings.Join(labels, ",")
+}
+
+// VersionDirRegex matches the following pattern of a migration file and
+// the directory holding it:
+//  123/up.ext
+//  123_name/down.ext
+var VersionDirRegex = regexp.MustCompile(`^([0-9]+)(?:[_-](.*))?/(?i:(` + string(Down) + `|` + string(Up) + `))\.(.*)$`)
+
+// ParseVersionDir returns Migration for matching VersionDirRegex pattern,
+// for layouts with a directory per version. raw is the slash separated
+// name of the directory and the file. The name following the version in
+// the directory name is the Identifier, the version itself if there is
+// none.
+func ParseVersionDir(raw string) (*Migration, error) {
+	m := VersionDirRegex.FindStringSubmatch(raw)
+	if len(m) != 5 {
+		return nil, fmt.Errorf("%w: %q is not named <version>[_<name>]/<up|down>.<ext>", ErrParse, raw)
+	}
+	version, err := ParseVersion(m[1])
+	if err != nil {
+		return nil, err
+	}
+	identifier := m[2]
+	if identifier == "" {
+		identifier = m[1]
+	}
+	return &Migration{
+		Version:    version,
+		Identifier: identifier,
+		Direction:  Direction(strings.ToLower(m[3])),
+		Raw:        raw,
+		Status:     Pending,
+	}, nil
+}
+
+// EpochSize is the number of sequence numbers available per epoch
+// when parsing compound versions with ParseCompound.
+const EpochSize = 1000000
+
+// CompoundRegex matches the following pattern:
+//  2.0041_name.up.ext
+//  2.0041_name.down.ext
+// Like Regex, the direction is matched case insensitively.
+var CompoundRegex = regexp.MustCompile(`^([0-9]+)\.([0-9]+)_(.*)\.(?i:(` + string(Down) + `|` + string(Up) + `))\.(.*)$`)
+
+// ParseCompound returns Migration for matching CompoundRegex pattern.
+// The version is composed as epoch*EpochSize + sequence, so a bumped epoch
+// always sorts after every sequence of the previous epoch. The original
+// "epoch.sequence" is kept as Identifier and the direction is normalized
+// to lower case. A sequence of EpochSize or more, or an epoch overflowing
+// the version, is rejected with an error wrapping strconv.ErrRange.
+//
+// To enable it, call RegisterParser(ParseCompound) before opening the source.
+func ParseCompound(raw string) (*Migration, error) {
+	m := CompoundRegex.FindStringSubmatch(raw)
+	if len(m) != 6 {
+		return nil, ErrParse
+	}
+	epoch, err := strconv.ParseUint(m[1], 10, 64)
+	if err != nil {
+		return nil, err
+	}
+	seq, err := strconv.ParseUint(m[2], 10, 64)
+	if err != nil {
+		return nil, err
+	}
+	if seq >= EpochSize {
+		return nil, fmt.Errorf("sequence %v out of range for epoch %v in %v: %w", m[2], m[1], raw, strconv.ErrRange)
+	}
+	maxVersion := uint64(^uint(0))
+	if epoch > (maxVersion-seq)/EpochSize {
+		return nil, fmt.Errorf("epoch %v out of range in %v: %w", m[1], raw, strconv.ErrRange)
+	}
+	return &Migration{
+		Version:    uint(epoch*EpochSize + seq),
+		Identifier: m[1] + "." + m[2],
+		Direction:  Direction(strings.ToLower(m[4])),
+		Raw:        raw,
+		Status:     Pending,
+	}, nil
 }
@@ -1,6 +1,10 @@
 package source
 
 import (
+	"errors"
+	"reflect"
+	"strconv"
+	"strings"
 	"testing"
 )
 
@@ -14,55 +18,72 @@ func TestParse(t *testing.T) {
 			name:      "1_foobar.up.sql",
 			expectErr: nil,
 			expectMigration: &Migration{
-				Version:    1,
-				Identifier: "foobar",
-				Direction:  Up,
-				Raw:        "1_foobar.up.sql",
-				Status:     Pending,
+				Version:     1,
+				Identifier:  "foobar",
+				Description: "foobar",
+				Direction:   Up,
+				Raw:         "1_foobar.up.sql",
+				Status:      Pending,
 			},
 		},
 		{
 			name:      "1_foobar.down.sql",
 			expectErr: nil,
 			expectMigration: &Migration{
-				Version:    1,
-				Identifier: "foobar",
-				Direction:  Down,
-				Raw:        "1_foobar.down.sql",
-				Status:     Pending,
+				Version:     1,
+				Identifier:  "foobar",
+				Description: "foobar",
+				Direction:   Down,
+				Raw:         "1_foobar.down.sql",
+				Status:      Pending,
 			},
 		},
 		{
 			name:      "1_f-o_ob+ar.up.sql",
 			expectErr: nil,
 			expectMigration: &Migration{
-				Version:    1,
-				Identifier: "f-o_ob+ar",
-				Direction:  Up,
-				Raw:        "1_f-o_ob+ar.up.sql",
-				Status:     Pending,
+				Version:     1,
+				Identifier:  "f-o_ob+ar",
+				Description: "f-o ob+ar",
+				Direction:   Up,
+				Raw:         "1_f-o_ob+ar.up.sql",
+				Status:      Pending,
 			},
 		},
 		{
 			name:      "1485385885_foobar.up.sql",
 			expectErr: nil,
 			expectMigration: &Migration{
-				Version:    1485385885,
-				Identifier: "foobar",
-				Direction:  Up,
-				Raw:        "1485385885_foobar.up.sql",
-				Status:     Pending,
+				Version:     1485385885,
+				Identifier:  "foobar",
+				Description: "foobar",
+				Direction:   Up,
+				Raw:         "1485385885_foobar.up.sql",
+				Status:      Pending,
 			},
 		},
 		{
 			name:      "20170412214116_date_foobar.up.sql",
 			expectErr: nil,
 			expectMigration: &Migration{
-				Version:    20170412214116,
-				Identifier: "date_foobar",
-				Direction:  Up,
-				Raw:        "20170412214116_date_foobar.up.sql",
-				Status:     Pending,
+				Version:     20170412214116,
+				Identifier:  "date_foobar",
+				Description: "date foobar",
+				Direction:   Up,
+				Raw:         "20170412214116_date_foobar.up.sql",
+				Status:      Pending,
+			},
+		},
+		{
+			name:      "0003_add_user_index.up.sql",
+			expectErr: nil,
+			expectMigration: &Migration{
+				Version:     3,
+				Identifier:  "add_user_index",
+				Description: "add user index",
+				Direction:   Up,
+				Raw:         "0003_add_user_index.up.sql",
+				Status:      Pending,
 			},
 		},
 		{
@@ -100,12 +121,267 @@ func TestParse(t *testing.T) {
 	for i, v := range tt {
 		f, err := Parse(v.name)
 
-		if err != v.expectErr {
+		if !errors.Is(err, v.expectErr) || (err != nil) != (v.expectErr != nil) {
 			t.Errorf("expected %v, got %v, in %v", v.expectErr, err, i)
 		}
 
 		if v.expectMigration != nil && *f != *v.expectMigration {
-			t.Errorf("expected %+v, got %+v, in %v", *v.expectMigration, *f, i)
+			t.Errorf("expected %#v, got %#v, in %v", *v.expectMigration, *f, i)
+		}
+	}
+}
+
+func TestParseCompound(t *testing.T) {
+	tt := []struct {
+		name            string
+		expectErr       error
+		expectMigration *Migration
+	}{
+		{
+			name: "2.0041_foobar.up.sql",
+			expectMigration: &Migration{
+				Version:    2000041,
+				Identifier: "2.0041",
+				Direction:  Up,
+				Raw:        "2.0041_foobar.up.sql",
+				Status:     Pending,
+			},
+		},
+		{
+			name: "0.1_foobar.down.sql",
+			expectMigration: &Migration{
+				Version:    1,
+				Identifier: "0.1",
+				Direction:  Down,
+				Raw:        "0.1_foobar.down.sql",
+				Status:     Pending,
+			},
+		},
+		{
+			name: "1.0002_foobar.DOWN.sql",
+			expectMigration: &Migration{
+				Version:    1000002,
+				Identifier: "1.0002",
+				Direction:  Down,
+				Raw:        "1.0002_foobar.DOWN.sql",
+				Status:     Pending,
+			},
+		},
+		{name: "1.1000000_foobar.up.sql", expectErr: strconv.ErrRange},
+		{name: "18446744073710.0_foobar.up.sql", expectErr: strconv.ErrRange},
+		{name: "99999999999999999999.1_foobar.up.sql", expectErr: strconv.ErrRange},
+		{name: "1_foobar.up.sql", expectErr: ErrParse},
+		{name: "1._foobar.up.sql", expectErr: ErrParse},
+		{name: "1.2_foobar.sql", expectErr: ErrParse},
+	}
+
+	for i, v := range tt {
+		f, err := ParseCompound(v.name)
+		if !errors.Is(err, v.expectErr) || (err != nil) != (v.expectErr != nil) {
+			t.Errorf("expected error %v, got %v, in %v", v.expectErr, err, i)
+		}
+		if v.expectMigration != nil && *f != *v.expectMigration {
+			t.Errorf("expected %#v, got %#v, in %v", *v.expectMigration, *f, i)
+		}
+	}
+}
+
+func TestParseCompoundOrdering(t *testing.T) {
+	ms := NewMigrations()
+	for _, name := range []string{
+		"2.0001_rebaseline.up.sql",
+		"1.0999_late.up.sql",
+		"1.0002_second.up.sql",
+		"3.0_next.up.sql",
+		"1.0001_first.up.sql",
+	} {
+		m, err := ParseCompound(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !ms.Append(m) {
+			t.Fatalf("failed to append %v", name)
+		}
+	}
+
+	expected := []string{"1.0001", "1.0002", "1.0999", "2.0001", "3.0"}
+	v, ok := ms.First()
+	for i, id := range expected {
+		if !ok {
+			t.Fatalf("expected %v at position %v, got none", id, i)
+		}
+		m, _ := ms.Up(v)
+		if m.Identifier != id {
+			t.Errorf("expected %v at position %v, got %v", id, i, m.Identifier)
+		}
+		v, ok = ms.Next(v)
+	}
+	if ok {
+		t.Errorf("expected no migration after %v", expected[len(expected)-1])
+	}
+}
+
+func TestRegisterParser(t *testing.T) {
+	defer RegisterParser(nil)
+
+	RegisterParser(ParseCompound)
+	m, err := DefaultParse("1.2_foobar.up.sql")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.Version != 1000002 {
+		t.Errorf("expected version 1000002, got %v", m.Version)
+	}
+
+	RegisterParser(nil)
+	if _, err := DefaultParse("1.2_foobar.up.sql"); !errors.Is(err, ErrParse) {
+		t.Errorf("expected %v after reset, got %v", ErrParse, err)
+	}
+}
+
+func TestParseVariations(t *testing.T) {
+	tt := []struct {
+		name       string
+		version    uint
+		identifier string
+		direction  Direction
+	}{
+		{"1_foobar.up.sql", 1, "foobar", Up},
+		{"1-foobar.up.sql", 1, "foobar", Up},
+		{"1-foo_bar.down.sql", 1, "foo_bar", Down},
+		{"1_foo-bar.down.sql", 1, "foo-bar", Down},
+		{"1_foobar.UP.sql", 1, "foobar", Up},
+		{"1_foobar.Down.sql", 1, "foobar", Down},
+		{"1-foobar.DOWN.sql", 1, "foobar", Down},
+		{"0003_add_user_index.up.sql", 3, "add_user_index", Up},
+		{"0003-add_user_index.Up.sql", 3, "add_user_index", Up},
+		{"000000_init.up.sql", 0, "init", Up},
+	}
+	for _, v := range tt {
+		t.Run(v.name, func(t *testing.T) {
+			m, err := Parse(v.name)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if m.Version != v.version || m.Identifier != v.identifier || m.Direction != v.direction || m.Raw != v.name {
+				t.Errorf("expected %v %v %v, got %#v", v.version, v.identifier, v.direction, *m)
+			}
+		})
+	}
+
+	for _, name := range []string{
+		"foobar.up.sql",
+		"-1_foobar.up.sql",
+		"1foobar.up.sql",
+		"1.foobar.up.sql",
+		"1_foobar.upp.sql",
+		"1_foobar_up.sql",
+		"1_foobar.sideways.sql",
+		"1_foobar.UP",
+		"x1_foobar.up.sql",
+	} {
+		t.Run(name, func(t *testing.T) {
+			_, err := Parse(name)
+			if !errors.Is(err, ErrParse) {
+				t.Fatalf("expected %v, got %v", ErrParse, err)
+			}
+			if !strings.Contains(err.Error(), name) {
+				t.Errorf("expected error to name the file, got %v", err)
+			}
+		})
+	}
+}
+
+func TestParseVersionDir(t *testing.T) {
+	tt := []struct {
+		raw        string
+		version    uint
+		identifier string
+		direction  Direction
+	}{
+		{"0001/up.sql", 1, "0001", Up},
+		{"0001/down.sql", 1, "0001", Down},
+		{"2_add_email/UP.sql", 2, "add_email", Up},
+		{"3-drop-index/down.cql", 3, "drop-index", Down},
+	}
+	for _, v := range tt {
+		m, err := ParseVersionDir(v.raw)
+		if err != nil {
+			t.Errorf("unexpected error %v for %v", err, v.raw)
+			continue
+		}
+		if m.Version != v.version || m.Identifier != v.identifier || m.Direction != v.direction || m.Raw != v.raw {
+			t.Errorf("unexpected migration %#v for %v", m, v.raw)
+		}
+	}
+
+	for _, raw := range []string{"up.sql", "0001/sideways.sql", "name/up.sql", "1_foobar.up.sql"} {
+		if _, err := ParseVersionDir(raw); !errors.Is(err, ErrParse) {
+			t.Errorf("expected %v for %v, got %v", ErrParse, raw, err)
+		}
+	}
+}
+
+func TestParseLabels(t *testing.T) {
+	tt := []struct {
+		raw        string
+		identifier string
+		labels     []string
+	}{
+		{"1_foobar.up.sql", "foobar", nil},
+		{"1_seed_users@test-seed.up.sql", "seed_users", []string{"test-seed"}},
+		{"2_add_index@prod-only@staging.down.sql", "add_index", []string{"prod-only", "staging"}},
+		{"3_trailing@.up.sql", "trailing", nil},
+		{"4_seed@staging@prod-only.up.sql", "seed", []string{"prod-only", "staging"}},
+	}
+	for _, v := range tt {
+		m, err := Parse(v.raw)
+		if err != nil {
+			t.Errorf("unexpected error %v for %v", err, v.raw)
+			continue
+		}
+		if m.Identifier != v.identifier || !reflect.DeepEqual(m.Labels(), v.labels) {
+			t.Errorf("expected identifier %q and labels %q for %v, got %q and %q", v.identifier, v.labels, v.raw, m.Identifier, m.Labels())
 		}
 	}
 }
+
+func TestParseLargeVersions(t *testing.T) {
+	raws := []string{
+		"20240101120000123_add_index.up.sql",
+		"4294967297_second.up.sql",
+		"4294967296_first.up.sql",
+		"4294967295_max32.up.sql",
+	}
+	if strconv.IntSize == 32 {
+		if _, err := Parse(raws[0]); !errors.Is(err, strconv.ErrRange) {
+			t.Errorf("expected %v, got %v", strconv.ErrRange, err)
+		}
+		return
+	}
+
+	ms := NewMigrations()
+	for _, raw := range raws {
+		m, err := Parse(raw)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ms.Append(m)
+	}
+	// uint64 keeps the test compiling on 32-bit platforms
+	var versions []uint64
+	for _, v := range ms.Versions() {
+		versions = append(versions, uint64(v))
+	}
+	expected := []uint64{4294967295, 4294967296, 4294967297, 20240101120000123}
+	if !reflect.DeepEqual(versions, expected) {
+		t.Errorf("expected %v, got %v", expected, versions)
+	}
+	if next, ok := ms.Next(uint(expected[1])); !ok || uint64(next) != expected[2] {
+		t.Errorf("expected next version %v, got %v, %v", expected[2], next, ok)
+	}
+
+	if _, err := Parse("18446744073709551616_overflow.up.sql"); !errors.Is(err, strconv.ErrRange) {
+		t.Errorf("expected %v, got %v", strconv.ErrRange, err)
+	}
+}
@@ -0,0 +1,196 @@
+package source
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+	"unicode/utf8"
+)
+
+// ErrUnreadableMigration is an error type for reporting a migration
+// PreflightCheck failed to read.
+type ErrUnreadableMigration struct {
+	Version   uint
+	Direction Direction
+	// Location is the location the driver returned for the migration, if
+	// opening it succeeded.
+	Location string
+	Err      error
+}
+
+// Error implements error interface.
+func (e ErrUnreadableMigration) Error() string {
+	if e.Location == "" {
+		return fmt.Sprintf("unable to read %v migration %v: %v", e.Direction, e.Version, e.Err)
+	}
+	return fmt.Sprintf("unable to read %v migration %v (%v): %v", e.Direction, e.Version, e.Location, e.Err)
+}
+
+// Unwrap returns the error of the driver.
+func (e ErrUnreadableMigration) Unwrap() error {
+	return e.Err
+}
+
+// ErrInvalidEncoding is an error type for reporting a migration whose
+// body is not valid UTF-8, see ValidateEncoding.
+type ErrInvalidEncoding struct {
+	Version   uint
+	Direction Direction
+	Location  string
+	// Offset is the offset of the first invalid byte in the body.
+	Offset int
+}
+
+// Error implements error interface.
+func (e ErrInvalidEncoding) Error() string {
+	return fmt.Sprintf("invalid UTF-8 in %v migration %v (%v) at byte %v", e.Direction, e.Version, e.Location, e.Offset)
+}
+
+// ErrPreflight lists all problems found by PreflightCheck or
+// ValidateEncoding.
+type ErrPreflight []error
+
+// Error implements error interface.
+func (e ErrPreflight) Error() string {
+	msgs := make([]string, len(e))
+	for i, err := range e {
+		msgs[i] = err.Error()
+	}
+	return "preflight check failed: " + strings.Join(msgs, "; ")
+}
+
+// Is reports whether any of the listed errors matches target, so
+// errors.Is looks into the list before Go 1.20.
+func (e ErrPreflight) Is(target error) bool {
+	return anyIs(e, target)
+}
+
+// As finds the first of the listed errors that matches target, so
+// errors.As looks into the list before Go 1.20.
+func (e ErrPreflight) As(target interface{}) bool {
+	return anyAs(e, target)
+}
+
+// Unwrap returns the listed errors, for errors.Is and errors.As of Go 1.20
+// and later.
+func (e ErrPreflight) Unwrap() []error {
+	return e
+}
+
+// PreflightCheck reads every migration of d in both directions to the end
+// without running any, so missing or inaccessible migrations are found
+// before a run starts. Go migrations and irreversible down migrations
+// have no body and are skipped. Each migration failing to read is reported
+// as ErrUnreadableMigration in an ErrPreflight; errors listing the versions
+// are returned as is.
+//
+// If d has an Identifier method, like the drivers of this module, it tells
+// which migrations exist, so a migration that is listed but can't be found
+// when read is reported. Otherwise a not exist error of ReadUp or ReadDown
+// is taken to mean the version has no migration in that direction.
+func PreflightCheck(d Driver) error {
+	return check(d, nil)
+}
+
+// ValidateEncoding is like PreflightCheck, but also checks that the body of
+// every migration is valid UTF-8, so a corrupted or wrongly encoded file is
+// found before it is run as garbled SQL. Each invalid body is reported as
+// ErrInvalidEncoding in the returned ErrPreflight.
+func ValidateEncoding(d Driver) error {
+	return check(d, func(version uint, dir Direction, location string, body []byte) error {
+		if utf8.Valid(body) {
+			return nil
+		}
+		return ErrInvalidEncoding{Version: version, Direction: dir, Location: location, Offset: invalidOffset(body)}
+	})
+}
+
+// invalidOffset returns the offset of the first byte of body that is not
+// part of a valid UTF-8 sequence, or -1 if there is none.
+func invalidOffset(body []byte) int {
+	for offset := 0; offset < len(body); {
+		r, size := utf8.DecodeRune(body[offset:])
+		if r == utf8.RuneError && size == 1 {
+			return offset
+		}
+		offset += size
+	}
+	return -1
+}
+
+// inspectFunc checks the body of the migration of version in direction dir
+// read from location.
+type inspectFunc func(version uint, dir Direction, location string, body []byte) error
+
+// check reads every migration of d as described by PreflightCheck and
+// passes their bodies to inspect, if set, collecting the errors.
+func check(d Driver, inspect inspectFunc) error {
+	identified, _ := d.(interface {
+		Identifier(version uint, dir Direction) (string, bool)
+	})
+	var errs ErrPreflight
+	version, err := d.First()
+	for ok := err == nil; ok; version, ok, err = TryNextE(d, version) {
+		for _, dir := range []Direction{Up, Down} {
+			exists := true
+			if identified != nil {
+				_, exists = identified.Identifier(version, dir)
+			}
+			if !exists {
+				continue
+			}
+			if err := preflight(d, version, dir, identified != nil, inspect); err != nil {
+				errs = append(errs, err)
+			}
+		}
+	}
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	if len(errs) == 0 {
+		return nil
+	}
+	return errs
+}
+
+// preflight reads the migration of version in direction dir of d and
+// passes its body to inspect, if set. If known is not set, a not exist
+// error is ignored.
+func preflight(d Driver, version uint, dir Direction, known bool, inspect inspectFunc) error {
+	read := d.ReadUp
+	if dir == Down {
+		read = d.ReadDown
+	}
+	r, _, location, fn, err := read(version)
+	if errors.Is(err, ErrIrreversibleMigration) || (!known && errors.Is(err, os.ErrNotExist)) {
+		return nil
+	}
+	if err != nil {
+		return ErrUnreadableMigration{Version: version, Direction: dir, Err: err}
+	}
+	if r == nil {
+		return nil
+	}
+	var body []byte
+	switch {
+	case fn != nil:
+		// go migrations have no body
+	case inspect == nil:
+		_, err = io.Copy(ioutil.Discard, r)
+	default:
+		body, err = ioutil.ReadAll(r)
+	}
+	if closeErr := r.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return ErrUnreadableMigration{Version: version, Direction: dir, Location: location, Err: err}
+	}
+	if fn == nil && inspect != nil {
+		return inspect(version, dir, location, body)
+	}
+	return nil
+}
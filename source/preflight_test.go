@@ -0,0 +1,111 @@
+package source_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/nokia/migrate/v4/source"
+	"github.com/nokia/migrate/v4/source/memory"
+)
+
+// brokenDriver fails reading the up migration of version broken and
+// can't find the down migration of version missing, like a storage
+// denying access to or having lost an object.
+type brokenDriver struct {
+	*memory.Memory
+	broken, missing uint
+	err             error
+}
+
+func (d brokenDriver) ReadUp(version uint) (io.ReadCloser, string, string, source.MigrationFunc, error) {
+	r, identifier, location, fn, err := d.Memory.ReadUp(version)
+	if err == nil && version == d.broken {
+		r = ioutil.NopCloser(io.MultiReader(r, errReader{d.err}))
+	}
+	return r, identifier, location, fn, err
+}
+
+func (d brokenDriver) ReadDown(version uint) (io.ReadCloser, string, string, source.MigrationFunc, error) {
+	if version == d.missing {
+		return nil, "", "", nil, &fs.PathError{Op: "read", Path: "3_foobar.down.sql", Err: fs.ErrNotExist}
+	}
+	return d.Memory.ReadDown(version)
+}
+
+type errReader struct {
+	err error
+}
+
+func (r errReader) Read(p []byte) (int, error) {
+	return 0, r.err
+}
+
+func TestPreflightCheck(t *testing.T) {
+	errFn := errors.New("fn")
+	m := memory.New().
+		Add(1, source.Up, "1 up").
+		Add(1, source.Down, "1 down").
+		Add(2, source.Up, "2 up").
+		AddFunc(3, source.Up, func(ctx context.Context, db interface{}) error { return errFn }).
+		Add(3, source.Down, "3 down").
+		Add(4, source.Down, "4 down")
+	if err := source.PreflightCheck(m); err != nil {
+		t.Fatal(err)
+	}
+
+	errDenied := errors.New("permission denied")
+	err := source.PreflightCheck(brokenDriver{Memory: m, broken: 2, missing: 3, err: errDenied})
+	var errs source.ErrPreflight
+	if !errors.As(err, &errs) || len(errs) != 2 {
+		t.Fatalf("expected 2 unreadable migrations, got %v", err)
+	}
+	if !errors.Is(err, errDenied) || !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("expected errors of the reads, got %v", err)
+	}
+	for _, s := range []string{"up migration 2 (2.up.memory): permission denied", "down migration 3: read 3_foobar.down.sql"} {
+		if !strings.Contains(err.Error(), s) {
+			t.Errorf("expected error to contain %q, got %v", s, err)
+		}
+	}
+	var unreadable source.ErrUnreadableMigration
+	if !errors.As(err, &unreadable) || unreadable.Version != 2 || unreadable.Direction != source.Up {
+		t.Errorf("expected up migration 2 to be unreadable first, got %+v", unreadable)
+	}
+
+	// without Identifier a missing migration can't be told apart from a
+	// version without a migration in that direction
+	err = source.PreflightCheck(struct{ source.Driver }{brokenDriver{Memory: m, broken: 2, missing: 3, err: errDenied}})
+	if !errors.As(err, &errs) || len(errs) != 1 || !errors.Is(err, errDenied) {
+		t.Errorf("expected only up migration 2 to be unreadable, got %v", err)
+	}
+}
+
+func TestValidateEncoding(t *testing.T) {
+	m := memory.New().
+		Add(1, source.Up, "CREATE TABLE café ();").
+		Add(1, source.Down, "DROP TABLE café;").
+		Add(2, source.Up, "CREATE TABLE caf\xe9 ();").
+		AddFunc(3, source.Up, func(ctx context.Context, db interface{}) error { return nil })
+
+	err := source.ValidateEncoding(m)
+	var errs source.ErrPreflight
+	if !errors.As(err, &errs) || len(errs) != 1 {
+		t.Fatalf("expected 1 invalid migration, got %v", err)
+	}
+	var invalid source.ErrInvalidEncoding
+	if !errors.As(err, &invalid) || invalid.Version != 2 || invalid.Direction != source.Up || invalid.Offset != 16 {
+		t.Errorf("expected up migration 2 to be invalid at byte 16, got %+v", invalid)
+	}
+	if s := "invalid UTF-8 in up migration 2 (2.up.memory) at byte 16"; !strings.Contains(err.Error(), s) {
+		t.Errorf("expected error to contain %q, got %v", s, err)
+	}
+
+	if err := source.PreflightCheck(m); err != nil {
+		t.Errorf("expected PreflightCheck to ignore the encoding, got %v", err)
+	}
+}
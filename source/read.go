@@ -0,0 +1,168 @@
+package source
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+)
+
+// ReadUpString reads the up migration of version from d and closes the
+// reader. The body is empty if the migration is a go migration, fn is
+// set instead.
+func ReadUpString(d Driver, version uint) (body string, fn MigrationFunc, identifier, location string, err error) {
+	return readString(d.ReadUp(version))
+}
+
+// ReadDownString is like ReadUpString for the down migration of version.
+func ReadDownString(d Driver, version uint) (body string, fn MigrationFunc, identifier, location string, err error) {
+	return readString(d.ReadDown(version))
+}
+
+// ReadUpBytes reads the up migration of version from d and closes the
+// reader, so no file or connection is left open by the caller. The body is
+// nil if the migration is a go migration, fn is set instead.
+func ReadUpBytes(d Driver, version uint) (body []byte, identifier, location string, fn MigrationFunc, err error) {
+	return readBytes(d.ReadUp(version))
+}
+
+// ReadDownBytes is like ReadUpBytes for the down migration of version.
+func ReadDownBytes(d Driver, version uint) (body []byte, identifier, location string, fn MigrationFunc, err error) {
+	return readBytes(d.ReadDown(version))
+}
+
+// ReadUpHeader reads at most the first n bytes of the up migration of
+// version from d and closes the reader, e.g. to check a leading directive
+// without reading a large body. The header of a go migration is empty.
+func ReadUpHeader(d Driver, version uint, n int) (string, error) {
+	r, _, _, fn, err := d.ReadUp(version)
+	return readHeader(r, fn, err, n)
+}
+
+// ReadDownHeader is like ReadUpHeader for the down migration of version.
+func ReadDownHeader(d Driver, version uint, n int) (string, error) {
+	r, _, _, fn, err := d.ReadDown(version)
+	return readHeader(r, fn, err, n)
+}
+
+func readHeader(r io.ReadCloser, fn MigrationFunc, err error, n int) (string, error) {
+	if r != nil {
+		defer r.Close()
+	}
+	if err != nil {
+		return "", err
+	}
+	if fn != nil || r == nil || n <= 0 {
+		return "", nil
+	}
+	b := make([]byte, n)
+	read, err := io.ReadFull(r, b)
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		// the body is shorter than n
+		err = nil
+	}
+	if err != nil {
+		return "", err
+	}
+	return string(b[:read]), nil
+}
+
+// ReadUpStatements reads the up migration of version from d and splits it
+// into statements with SplitStatements. Go migrations have no statements,
+// ErrFuncMigration is returned for them.
+func ReadUpStatements(d Driver, version uint, delimiter string) ([]string, error) {
+	r, _, location, fn, err := d.ReadUp(version)
+	return readStatements(r, location, fn, err, delimiter)
+}
+
+// ReadDownStatements is like ReadUpStatements for the down migration of
+// version.
+func ReadDownStatements(d Driver, version uint, delimiter string) ([]string, error) {
+	r, _, location, fn, err := d.ReadDown(version)
+	return readStatements(r, location, fn, err, delimiter)
+}
+
+func readStatements(r io.ReadCloser, location string, fn MigrationFunc, err error, delimiter string) ([]string, error) {
+	if r != nil {
+		defer r.Close()
+	}
+	if err != nil {
+		return nil, err
+	}
+	if fn != nil || r == nil {
+		return nil, fmt.Errorf("%v: %w", location, ErrFuncMigration)
+	}
+	return SplitStatements(r, delimiter)
+}
+
+// MigrationSource is a migration read from a driver. Either Body or Func
+// is set.
+type MigrationSource struct {
+	Body       io.ReadCloser
+	Func       MigrationFunc
+	Identifier string
+	Location   string
+}
+
+// IsFunc reports whether the migration is a go migration function.
+func (s MigrationSource) IsFunc() bool {
+	return s.Func != nil
+}
+
+// Close closes Body, if any.
+func (s MigrationSource) Close() error {
+	if s.Body == nil {
+		return nil
+	}
+	return s.Body.Close()
+}
+
+// ReadUpSource reads the up migration of version from d. The caller must
+// close the returned MigrationSource.
+func ReadUpSource(d Driver, version uint) (MigrationSource, error) {
+	return readSource(d.ReadUp(version))
+}
+
+// ReadDownSource is like ReadUpSource for the down migration of version.
+func ReadDownSource(d Driver, version uint) (MigrationSource, error) {
+	return readSource(d.ReadDown(version))
+}
+
+func readSource(r io.ReadCloser, identifier, location string, fn MigrationFunc, err error) (MigrationSource, error) {
+	if err != nil {
+		if r != nil {
+			r.Close()
+		}
+		return MigrationSource{}, err
+	}
+	if fn != nil && r != nil {
+		r.Close()
+		r = nil
+	}
+	return MigrationSource{Body: r, Func: fn, Identifier: identifier, Location: location}, nil
+}
+
+func readString(r io.ReadCloser, identifier, location string, fn MigrationFunc, err error) (string, MigrationFunc, string, string, error) {
+	b, identifier, location, fn, err := readBytes(r, identifier, location, fn, err)
+	return string(b), fn, identifier, location, err
+}
+
+func readBytes(r io.ReadCloser, identifier, location string, fn MigrationFunc, err error) ([]byte, string, string, MigrationFunc, error) {
+	if err != nil {
+		if r != nil {
+			r.Close()
+		}
+		return nil, "", "", nil, err
+	}
+	if r == nil {
+		return nil, identifier, location, fn, nil
+	}
+	defer r.Close()
+	if fn != nil {
+		return nil, identifier, location, fn, nil
+	}
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, "", "", nil, err
+	}
+	return b, identifier, location, nil, nil
+}
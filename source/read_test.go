@@ -0,0 +1,245 @@
+//go:build go1.16
+// +build go1.16
+
+package source_test
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"io/ioutil"
+	"testing"
+	"testing/fstest"
+
+	"github.com/nokia/migrate/v4/source"
+	"github.com/nokia/migrate/v4/source/iofs"
+	"github.com/nokia/migrate/v4/source/memory"
+)
+
+func TestReadString(t *testing.T) {
+	errFn := errors.New("fn")
+	d := memory.New().
+		Add(1, source.Up, "1 up").
+		Add(1, source.Down, "1 down").
+		AddFunc(2, source.Up, func(ctx context.Context, db interface{}) error { return errFn })
+
+	body, fn, identifier, location, err := source.ReadUpString(d, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if body != "1 up" || fn != nil || identifier == "" || location == "" {
+		t.Errorf("unexpected read %q, %v, %q, %q", body, fn, identifier, location)
+	}
+
+	body, _, _, _, err = source.ReadDownString(d, 1)
+	if err != nil || body != "1 down" {
+		t.Errorf("expected %q, got %q, %v", "1 down", body, err)
+	}
+
+	body, fn, _, _, err = source.ReadUpString(d, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if body != "" || fn == nil || fn(context.Background(), nil) != errFn {
+		t.Errorf("expected empty body and the registered function, got %q, %v", body, fn)
+	}
+
+	if _, _, _, _, err := source.ReadDownString(d, 2); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("expected %v, got %v", fs.ErrNotExist, err)
+	}
+}
+
+func TestReadStringFuncMigration(t *testing.T) {
+	errFn := errors.New("fn")
+	source.MgrFunctions["1_readstring.up.go"] = func(ctx context.Context, db interface{}) error { return errFn }
+	defer delete(source.MgrFunctions, "1_readstring.up.go")
+
+	d, err := iofs.New(fstest.MapFS{
+		"migrations/1_readstring.up.go":    &fstest.MapFile{Data: []byte("package migrations")},
+		"migrations/1_readstring.down.sql": &fstest.MapFile{Data: []byte("1 down")},
+	}, "migrations")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	body, fn, _, location, err := source.ReadUpString(d, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if body != "" || fn == nil || fn(context.Background(), nil) != errFn {
+		t.Errorf("expected empty body and the registered function, got %q, %v", body, fn)
+	}
+	if location != "migrations/1_readstring.up.go" {
+		t.Errorf("unexpected location %q", location)
+	}
+
+	body, fn, _, _, err = source.ReadDownString(d, 1)
+	if err != nil || body != "1 down" || fn != nil {
+		t.Errorf("expected %q, got %q, %v, %v", "1 down", body, fn, err)
+	}
+}
+
+func TestReadBytes(t *testing.T) {
+	errFn := errors.New("fn")
+	source.MgrFunctions["2_readbytes.up.go"] = func(ctx context.Context, db interface{}) error { return errFn }
+	defer delete(source.MgrFunctions, "2_readbytes.up.go")
+
+	fsys := &openFilesFS{FS: fstest.MapFS{
+		"migrations/1_readbytes.up.sql":   &fstest.MapFile{Data: []byte("1 up")},
+		"migrations/1_readbytes.down.sql": &fstest.MapFile{Data: []byte("1 down")},
+		"migrations/2_readbytes.up.go":    &fstest.MapFile{Data: []byte("package migrations")},
+	}}
+	d, err := iofs.New(fsys, "migrations")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	body, identifier, location, fn, err := source.ReadUpBytes(d, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(body) != "1 up" || identifier != "readbytes" || location != "migrations/1_readbytes.up.sql" || fn != nil {
+		t.Errorf("unexpected read %q, %q, %q, %v", body, identifier, location, fn)
+	}
+	if fsys.open != 0 {
+		t.Errorf("expected no open files, got %v", fsys.open)
+	}
+
+	body, _, _, _, err = source.ReadDownBytes(d, 1)
+	if err != nil || string(body) != "1 down" {
+		t.Errorf("expected %q, got %q, %v", "1 down", body, err)
+	}
+
+	body, _, _, fn, err = source.ReadUpBytes(d, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if body != nil || fn == nil || fn(context.Background(), nil) != errFn {
+		t.Errorf("expected nil body and the registered function, got %q, %v", body, fn)
+	}
+
+	if _, _, _, _, err := source.ReadDownBytes(d, 2); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("expected %v, got %v", fs.ErrNotExist, err)
+	}
+	if fsys.open != 0 {
+		t.Errorf("expected no open files, got %v", fsys.open)
+	}
+}
+
+// openFilesFS counts the files opened and not yet closed.
+type openFilesFS struct {
+	fs.FS
+	open int
+}
+
+func (f *openFilesFS) Open(name string) (fs.File, error) {
+	file, err := f.FS.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	f.open++
+	return &countedFile{File: file, fsys: f}, nil
+}
+
+func (f *openFilesFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	return fs.ReadDir(f.FS, name)
+}
+
+type countedFile struct {
+	fs.File
+	fsys *openFilesFS
+}
+
+func (f *countedFile) Close() error {
+	f.fsys.open--
+	return f.File.Close()
+}
+
+func TestReadHeader(t *testing.T) {
+	d := memory.New().
+		Add(1, source.Up, "-- migrate:up\nCREATE TABLE foo (id int);").
+		Add(1, source.Down, "DROP TABLE foo;").
+		AddFunc(2, source.Up, func(ctx context.Context, db interface{}) error { return nil })
+
+	for _, tc := range []struct {
+		read     func(source.Driver, uint, int) (string, error)
+		version  uint
+		n        int
+		expected string
+	}{
+		{source.ReadUpHeader, 1, 13, "-- migrate:up"},
+		{source.ReadUpHeader, 1, 0, ""},
+		{source.ReadDownHeader, 1, 100, "DROP TABLE foo;"},
+		{source.ReadUpHeader, 2, 10, ""},
+	} {
+		header, err := tc.read(d, tc.version, tc.n)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if header != tc.expected {
+			t.Errorf("expected %q for version %v and %v bytes, got %q", tc.expected, tc.version, tc.n, header)
+		}
+	}
+
+	if _, err := source.ReadUpHeader(d, 3, 10); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("expected %v, got %v", fs.ErrNotExist, err)
+	}
+}
+
+func TestReadSource(t *testing.T) {
+	errFn := errors.New("fn")
+	d := memory.New().
+		Add(1, source.Up, "1 up").
+		AddFunc(2, source.Up, func(ctx context.Context, db interface{}) error { return errFn })
+
+	file, err := source.ReadUpSource(d, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	if file.IsFunc() || file.Body == nil || file.Location == "" {
+		t.Errorf("expected a file backed migration, got %+v", file)
+	}
+	body, err := ioutil.ReadAll(file.Body)
+	if err != nil || string(body) != "1 up" {
+		t.Errorf("expected %q, got %q, %v", "1 up", body, err)
+	}
+
+	fn, err := source.ReadUpSource(d, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fn.Close()
+	if !fn.IsFunc() || fn.Body != nil || fn.Func(context.Background(), nil) != errFn {
+		t.Errorf("expected a function backed migration, got %+v", fn)
+	}
+
+	if _, err := source.ReadDownSource(d, 1); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("expected %v, got %v", fs.ErrNotExist, err)
+	}
+}
+
+func TestReadStatements(t *testing.T) {
+	d := memory.New().
+		Add(1, source.Up, "CREATE TABLE users (id int);\nINSERT INTO users VALUES (1);").
+		Add(1, source.Down, "DROP TABLE users;").
+		AddFunc(2, source.Up, func(ctx context.Context, db interface{}) error { return nil })
+
+	statements, err := source.ReadUpStatements(d, 1, ";")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(statements) != 2 || statements[0] != "CREATE TABLE users (id int)" || statements[1] != "INSERT INTO users VALUES (1)" {
+		t.Errorf("unexpected statements %q", statements)
+	}
+	if statements, err := source.ReadDownStatements(d, 1, ";"); err != nil || len(statements) != 1 {
+		t.Errorf("expected a single statement, got %q, %v", statements, err)
+	}
+
+	if _, err := source.ReadUpStatements(d, 2, ";"); !errors.Is(err, source.ErrFuncMigration) {
+		t.Errorf("expected %v, got %v", source.ErrFuncMigration, err)
+	}
+	if _, err := source.ReadDownStatements(d, 2, ";"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("expected %v, got %v", fs.ErrNotExist, err)
+	}
+}
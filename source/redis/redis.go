@@ -0,0 +1,247 @@
+// Package redis provides a source driver that reads migrations from the
+// string values of Redis keys.
+package redis
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"io/ioutil"
+	nurl "net/url"
+	"strconv"
+	"strings"
+
+	"github.com/go-redis/redis/v8"
+
+	"github.com/nokia/migrate/v4/source"
+)
+
+func init() {
+	source.Register("redis", &Redis{})
+	source.Register("rediss", &Redis{})
+}
+
+type Config struct {
+	// Prefix restricts the driver to keys starting with Prefix, e.g.
+	// migrations:. It is stripped before the key is parsed.
+	Prefix string
+}
+
+type Redis struct {
+	client     *redis.Client
+	opened     bool
+	config     *Config
+	migrations *source.Migrations
+}
+
+// Open is part of source.Driver interface implementation.
+// The URL names the server, the database and the key prefix, e.g.
+// redis://:password@host:6379/0?x-prefix=migrations:. Other query
+// parameters are passed on to redis.ParseURL.
+func (r *Redis) Open(url string) (source.Driver, error) {
+	u, err := nurl.Parse(url)
+	if err != nil {
+		return nil, err
+	}
+	q := u.Query()
+	config := &Config{Prefix: q.Get("x-prefix")}
+	q.Del("x-prefix")
+	u.RawQuery = q.Encode()
+	opts, err := redis.ParseURL(u.String())
+	if err != nil {
+		return nil, err
+	}
+	client := redis.NewClient(opts)
+	d, err := WithInstance(client, config)
+	if err != nil {
+		client.Close()
+		return nil, err
+	}
+	d.(*Redis).opened = true
+	return d, nil
+}
+
+// WithInstance returns a driver reading migrations with client.
+func WithInstance(client *redis.Client, config *Config) (source.Driver, error) {
+	r := &Redis{
+		client:     client,
+		config:     config,
+		migrations: source.NewMigrations(),
+	}
+	if err := r.loadMigrations(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (r *Redis) loadMigrations() error {
+	// SCAN may return a key more than once
+	seen := make(map[string]bool)
+	match := escapeGlob(r.config.Prefix) + "*"
+	var cursor uint64
+	for {
+		keys, next, err := r.client.Scan(context.Background(), cursor, match, 100).Result()
+		if err != nil {
+			return fmt.Errorf("unable to list keys %v: %w", match, err)
+		}
+		for _, key := range keys {
+			if seen[key] || !strings.HasPrefix(key, r.config.Prefix) {
+				continue
+			}
+			seen[key] = true
+			m, err := source.DefaultParse(strings.TrimPrefix(key, r.config.Prefix))
+			if errors.Is(err, source.ErrParse) {
+				continue
+			}
+			if err != nil {
+				return fmt.Errorf("unable to parse key %v: %w", key, err)
+			}
+			m.Raw = key
+			if err := r.migrations.AppendErr(m); err != nil {
+				return fmt.Errorf("unable to load %v: %w", key, err)
+			}
+		}
+		if next == 0 {
+			return nil
+		}
+		cursor = next
+	}
+}
+
+// escapeGlob escapes the special characters of a SCAN MATCH pattern in s.
+func escapeGlob(s string) string {
+	var b strings.Builder
+	for _, c := range s {
+		if strings.ContainsRune(`*?[]^\`, c) {
+			b.WriteByte('\\')
+		}
+		b.WriteRune(c)
+	}
+	return b.String()
+}
+
+// Close is part of source.Driver interface implementation.
+// The client is only closed if the driver was created by Open.
+func (r *Redis) Close() error {
+	if !r.opened {
+		return nil
+	}
+	return r.client.Close()
+}
+
+func (r *Redis) First() (uint, error) {
+	v, ok := r.migrations.First()
+	if !ok {
+		return 0, r.errNotExist("first")
+	}
+	return v, nil
+}
+
+func (r *Redis) Prev(version uint) (uint, error) {
+	v, ok := r.migrations.Prev(version)
+	if !ok {
+		return 0, r.errNotExist("prev for version " + strconv.FormatUint(uint64(version), 10))
+	}
+	return v, nil
+}
+
+func (r *Redis) Next(version uint) (uint, error) {
+	v, ok := r.migrations.Next(version)
+	if !ok {
+		return 0, r.errNotExist("next for version " + strconv.FormatUint(uint64(version), 10))
+	}
+	return v, nil
+}
+
+func (r *Redis) ReadUp(version uint) (io.ReadCloser, string, string, source.MigrationFunc, error) {
+	if m, ok := r.migrations.Up(version); ok {
+		return r.read(m)
+	}
+	return nil, "", "", nil, r.errNotExist("read up for version " + strconv.FormatUint(uint64(version), 10))
+}
+
+func (r *Redis) ReadDown(version uint) (io.ReadCloser, string, string, source.MigrationFunc, error) {
+	if m, ok := r.migrations.Down(version); ok {
+		return r.read(m)
+	}
+	return nil, "", "", nil, r.errNotExist("read down for version " + strconv.FormatUint(uint64(version), 10))
+}
+
+// read fetches the value of the key of m. Values are only read when
+// needed, not when the keys are listed.
+func (r *Redis) read(m *source.Migration) (io.ReadCloser, string, string, source.MigrationFunc, error) {
+	body, err := r.client.Get(context.Background(), m.Raw).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, "", "", nil, &fs.PathError{Op: "read", Path: m.Raw, Err: fs.ErrNotExist}
+	}
+	if err != nil {
+		return nil, "", "", nil, fmt.Errorf("unable to read %v: %w", m.Raw, err)
+	}
+	return ioutil.NopCloser(bytes.NewReader(body)), m.Identifier, m.Raw, nil, nil
+}
+
+// errNotExist returns an error wrapping fs.ErrNotExist for op on the key
+// prefix, like the iofs driver does.
+func (r *Redis) errNotExist(op string) error {
+	return &fs.PathError{
+		Op:   op,
+		Path: "redis keys " + r.config.Prefix + "*",
+		Err:  fs.ErrNotExist,
+	}
+}
+
+func (r *Redis) MarkSkipMigrations(version uint, dir source.Direction) {
+	r.migrations.MarkSkipMigrations(version, dir)
+}
+
+func (r *Redis) UpdateStatus(version uint, status source.Status, errstr string) {
+	r.migrations.UpdateStatus(version, status, errstr)
+}
+
+// UpdateStatusDir is like UpdateStatus, but only updates the migration of
+// direction dir.
+func (r *Redis) UpdateStatusDir(version uint, dir source.Direction, status source.Status, errstr string) {
+	r.migrations.UpdateStatusDir(version, dir, status, errstr)
+}
+
+func (r *Redis) PrintSummary(dir source.Direction) {
+	r.migrations.PrintSummary(dir)
+}
+
+// Versions returns all versions available to the driver in ascending order.
+func (r *Redis) Versions() []uint {
+	return r.migrations.Versions()
+}
+
+// Identifier returns the identifier of the migration of version in
+// direction dir without reading it.
+func (r *Redis) Identifier(version uint, dir source.Direction) (string, bool) {
+	return r.migrations.Identifier(version, dir)
+}
+
+// FindByIdentifier returns a copy of the first migration in direction dir
+// named identifier, see source.Migrations.FindByIdentifier.
+func (r *Redis) FindByIdentifier(identifier string, dir source.Direction) (*source.Migration, bool) {
+	return r.migrations.FindByIdentifier(identifier, dir)
+}
+
+// FindByIdentifierFold is like FindByIdentifier, but matches identifier
+// case insensitively.
+func (r *Redis) FindByIdentifierFold(identifier string, dir source.Direction) (*source.Migration, bool) {
+	return r.migrations.FindByIdentifierFold(identifier, dir)
+}
+
+// Walk calls fn with a copy of each migration of direction dir in the
+// order they would be applied, see source.Migrations.Walk.
+func (r *Redis) Walk(dir source.Direction, fn func(m *source.Migration) error) error {
+	return r.migrations.Walk(dir, fn)
+}
+
+// Validate checks that every version has an up and a down migration, or
+// only an up migration if downOptional is set, see source.Migrations.Validate.
+func (r *Redis) Validate(downOptional bool) error {
+	return r.migrations.Validate(downOptional)
+}
@@ -0,0 +1,98 @@
+package redis
+
+import (
+	"errors"
+	"io/fs"
+	"io/ioutil"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+
+	st "github.com/nokia/migrate/v4/source/testing"
+)
+
+func Test(t *testing.T) {
+	server := miniredis.RunT(t)
+	for key, value := range map[string]string{
+		"migrations:1_foobar.up.sql":   "1 up",
+		"migrations:1_foobar.down.sql": "1 down",
+		"migrations:3_foobar.up.sql":   "3 up",
+		"migrations:4_foobar.up.sql":   "4 up",
+		"migrations:4_foobar.down.sql": "4 down",
+		"migrations:5_foobar.down.sql": "5 down",
+		"migrations:7_foobar.up.sql":   "7 up",
+		"migrations:7_foobar.down.sql": "7 down",
+		"migrations:not-a-migration":   "",
+		"other:2_foobar.up.sql":        "2 up",
+	} {
+		server.Set(key, value)
+	}
+	d, err := (&Redis{}).Open("redis://" + server.Addr() + "?x-prefix=migrations:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+	st.Test(t, d)
+}
+
+func TestOpenAuthAndDB(t *testing.T) {
+	server := miniredis.RunT(t)
+	server.RequireAuth("secret")
+	server.DB(2).Set("1_create_users.up.sql", "CREATE TABLE users ();")
+	server.Set("2_other_db.up.sql", "")
+
+	if _, err := (&Redis{}).Open("redis://:wrong@" + server.Addr()); err == nil {
+		t.Error("expected authentication to fail")
+	}
+
+	d, err := (&Redis{}).Open("redis://:secret@" + server.Addr() + "/2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+	if _, err := d.Next(1); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("expected only the keys of database 2, got %v", err)
+	}
+	r, identifier, location, _, err := d.ReadUp(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	body, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(body) != "CREATE TABLE users ();" || identifier != "create_users" || location != "1_create_users.up.sql" {
+		t.Errorf("unexpected read %q, %q, %q", body, identifier, location)
+	}
+}
+
+func TestDeletedKey(t *testing.T) {
+	server := miniredis.RunT(t)
+	server.Set("m:1_foobar.up.sql", "1 up")
+	server.Set("m:2_foobar.up.sql", "2 up")
+	d, err := (&Redis{}).Open("redis://" + server.Addr() + "?x-prefix=m:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+
+	var versions []uint
+	for v, err := d.First(); err == nil; v, err = d.Next(v) {
+		versions = append(versions, v)
+	}
+	if len(versions) != 2 || versions[0] != 1 || versions[1] != 2 {
+		t.Errorf("expected versions [1 2], got %v", versions)
+	}
+
+	server.Del("m:2_foobar.up.sql")
+	if _, _, _, _, err := d.ReadUp(2); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("expected %v, got %v", fs.ErrNotExist, err)
+	}
+}
+
+func TestEscapeGlob(t *testing.T) {
+	if got, want := escapeGlob(`app[1]*:`), `app\[1\]\*:`; got != want {
+		t.Errorf("expected %v, got %v", want, got)
+	}
+}
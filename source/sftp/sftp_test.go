@@ -0,0 +1,236 @@
+package sftp
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+
+	st "github.com/nokia/migrate/v4/source/testing"
+)
+
+func Test(t *testing.T) {
+	dir := writeMigrations(t, map[string]string{
+		"1_foobar.up.sql":   "1 up",
+		"1_foobar.down.sql": "1 down",
+		"3_foobar.up.sql":   "3 up",
+		"4_foobar.up.sql":   "4 up",
+		"4_foobar.down.sql": "4 down",
+		"5_foobar.down.sql": "5 down",
+		"7_foobar.up.sql":   "7 up",
+		"7_foobar.down.sql": "7 down",
+		"not-a-migration":   "",
+	})
+	d, err := WithInstance(pipeClient(t), dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+	st.Test(t, d)
+}
+
+func TestReadContent(t *testing.T) {
+	dir := writeMigrations(t, map[string]string{
+		"10_add_index.up.sql":     "CREATE INDEX ...;",
+		"2_create_users.up.sql":   "CREATE TABLE users ();",
+		"2_create_users.down.sql": "DROP TABLE users;",
+	})
+	if err := os.Mkdir(filepath.Join(dir, "3_directory.up.sql"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	d, err := WithInstance(pipeClient(t), dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+
+	var versions []uint
+	for v, err := d.First(); err == nil; v, err = d.Next(v) {
+		versions = append(versions, v)
+	}
+	if len(versions) != 2 || versions[0] != 2 || versions[1] != 10 {
+		t.Errorf("expected versions [2 10], got %v", versions)
+	}
+
+	r, identifier, location, fn, err := d.ReadDown(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	body, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(body) != "DROP TABLE users;" || identifier != "create_users" || location != "2_create_users.down.sql" || fn != nil {
+		t.Errorf("unexpected read %q, %q, %q, %v", body, identifier, location, fn)
+	}
+}
+
+func TestOpenPrivateKey(t *testing.T) {
+	dir := writeMigrations(t, map[string]string{
+		"1_create_users.up.sql": "CREATE TABLE users ();",
+	})
+	clientPub, clientKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	authorized, err := ssh.NewPublicKey(clientPub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr, hostKey := newSSHServer(t, authorized)
+
+	tmp := t.TempDir()
+	keyFile := filepath.Join(tmp, "id_ed25519")
+	der, err := x509.MarshalPKCS8PrivateKey(clientKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	block := &pem.Block{Type: "PRIVATE KEY", Bytes: der}
+	if err := ioutil.WriteFile(keyFile, pem.EncodeToMemory(block), 0600); err != nil {
+		t.Fatal(err)
+	}
+	knownHostsFile := filepath.Join(tmp, "known_hosts")
+	line := knownhosts.Line([]string{knownhosts.Normalize(addr)}, hostKey) + "\n"
+	if err := ioutil.WriteFile(knownHostsFile, []byte(line), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	d, err := (&SFTP{}).Open("sftp://migrator@" + addr + dir + "?x-private-key=" + keyFile + "&x-known-hosts=" + knownHostsFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+	r, identifier, _, _, err := d.ReadUp(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	body, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(body) != "CREATE TABLE users ();" || identifier != "create_users" {
+		t.Errorf("unexpected read %q, %q", body, identifier)
+	}
+
+	if _, err := (&SFTP{}).Open("sftp://migrator@" + addr + dir + "?x-known-hosts=" + knownHostsFile); err == nil {
+		t.Error("expected authentication without key to fail")
+	}
+}
+
+// writeMigrations writes files to a new directory and returns its path.
+func writeMigrations(t *testing.T, files map[string]string) string {
+	dir := t.TempDir()
+	for name, body := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(body), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return filepath.ToSlash(dir)
+}
+
+// pipeClient returns a client talking to an in-process sftp server over
+// pipes, without ssh in between.
+func pipeClient(t *testing.T) *sftp.Client {
+	serverRead, clientWrite := io.Pipe()
+	clientRead, serverWrite := io.Pipe()
+	server, err := sftp.NewServer(struct {
+		io.Reader
+		io.WriteCloser
+	}{serverRead, serverWrite}, sftp.ReadOnly())
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		server.Serve()
+		// let the client see the end of the session once it hung up
+		serverWrite.Close()
+	}()
+
+	client, err := sftp.NewClientPipe(clientRead, clientWrite)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return client
+}
+
+// newSSHServer starts an ssh server offering the sftp subsystem to clients
+// authenticating with authorized. It returns the address and host key of
+// the server.
+func newSSHServer(t *testing.T, authorized ssh.PublicKey) (string, ssh.PublicKey) {
+	_, hostKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, err := ssh.NewSignerFromKey(hostKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	config := &ssh.ServerConfig{
+		PublicKeyCallback: func(_ ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+			if string(key.Marshal()) != string(authorized.Marshal()) {
+				return nil, ssh.ErrNoAuth
+			}
+			return nil, nil
+		},
+	}
+	config.AddHostKey(signer)
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go serveSSH(conn, config)
+		}
+	}()
+	return l.Addr().String(), signer.PublicKey()
+}
+
+func serveSSH(conn net.Conn, config *ssh.ServerConfig) {
+	defer conn.Close()
+	_, chans, reqs, err := ssh.NewServerConn(conn, config)
+	if err != nil {
+		return
+	}
+	go ssh.DiscardRequests(reqs)
+	for newChannel := range chans {
+		if newChannel.ChannelType() != "session" {
+			newChannel.Reject(ssh.UnknownChannelType, "unknown channel type")
+			continue
+		}
+		channel, requests, err := newChannel.Accept()
+		if err != nil {
+			return
+		}
+		go func() {
+			for req := range requests {
+				ok := req.Type == "subsystem" && string(req.Payload[4:]) == "sftp"
+				req.Reply(ok, nil)
+				if ok {
+					if server, err := sftp.NewServer(channel, sftp.ReadOnly()); err == nil {
+						server.Serve()
+					}
+					channel.Close()
+				}
+			}
+		}()
+	}
+}
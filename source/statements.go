@@ -0,0 +1,67 @@
+package source
+
+import (
+	"io"
+	"io/ioutil"
+	"strings"
+)
+
+// SplitStatements reads r and splits it into the statements separated by
+// delimiter, e.g. ";". The statements are trimmed of surrounding white
+// space and returned without the delimiter, empty ones are left out.
+//
+// Delimiters inside of single or double quoted strings, -- line comments
+// and /* */ block comments don't split. Quoting is only understood as far
+// as doubling a quote to escape it; other forms like PostgreSQL dollar
+// quoting, backslash escapes or nested block comments are not, so the
+// migration should use a delimiter that doesn't occur in them.
+func SplitStatements(r io.Reader, delimiter string) ([]string, error) {
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	s := string(b)
+	var statements []string
+	add := func(stmt string) {
+		if stmt = strings.TrimSpace(stmt); stmt != "" {
+			statements = append(statements, stmt)
+		}
+	}
+
+	start := 0
+	for i := 0; i < len(s); {
+		switch {
+		case s[i] == '\'' || s[i] == '"':
+			// a doubled quote ends the string and starts it again, which
+			// doesn't change the outcome
+			end := strings.IndexByte(s[i+1:], s[i])
+			if end < 0 {
+				i = len(s)
+			} else {
+				i += end + 2
+			}
+		case strings.HasPrefix(s[i:], "--"):
+			end := strings.IndexByte(s[i:], '\n')
+			if end < 0 {
+				i = len(s)
+			} else {
+				i += end + 1
+			}
+		case strings.HasPrefix(s[i:], "/*"):
+			end := strings.Index(s[i+2:], "*/")
+			if end < 0 {
+				i = len(s)
+			} else {
+				i += end + 4
+			}
+		case delimiter != "" && strings.HasPrefix(s[i:], delimiter):
+			add(s[start:i])
+			i += len(delimiter)
+			start = i
+		default:
+			i++
+		}
+	}
+	add(s[start:])
+	return statements, nil
+}
@@ -0,0 +1,64 @@
+package source
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSplitStatements(t *testing.T) {
+	tt := []struct {
+		name      string
+		body      string
+		delimiter string
+		expected  []string
+	}{
+		{
+			name:      "single",
+			body:      "CREATE TABLE users (id int);\n",
+			delimiter: ";",
+			expected:  []string{"CREATE TABLE users (id int)"},
+		},
+		{
+			name:      "multiple",
+			body:      "CREATE TABLE users (id int);\nCREATE INDEX users_id ON users (id);\n\nINSERT INTO users VALUES (1)",
+			delimiter: ";",
+			expected:  []string{"CREATE TABLE users (id int)", "CREATE INDEX users_id ON users (id)", "INSERT INTO users VALUES (1)"},
+		},
+		{
+			name:      "quoted delimiters",
+			body:      `INSERT INTO t VALUES ('a;b', 'it''s;'); SELECT "odd;name" FROM t;`,
+			delimiter: ";",
+			expected:  []string{`INSERT INTO t VALUES ('a;b', 'it''s;')`, `SELECT "odd;name" FROM t`},
+		},
+		{
+			name:      "comments",
+			body:      "-- don't split; here\nSELECT 1; /* nor; here */ SELECT 2;",
+			delimiter: ";",
+			expected:  []string{"-- don't split; here\nSELECT 1", "/* nor; here */ SELECT 2"},
+		},
+		{
+			name:      "custom delimiter",
+			body:      "CREATE FUNCTION f() BEGIN SELECT 1; END$$\nSELECT f()$$",
+			delimiter: "$$",
+			expected:  []string{"CREATE FUNCTION f() BEGIN SELECT 1; END", "SELECT f()"},
+		},
+		{
+			name:      "empty",
+			body:      " ;\n; ",
+			delimiter: ";",
+			expected:  nil,
+		},
+	}
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := SplitStatements(strings.NewReader(tc.body), tc.delimiter)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tc.expected) {
+				t.Errorf("expected %q, got %q", tc.expected, got)
+			}
+		})
+	}
+}
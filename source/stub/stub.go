@@ -92,6 +92,12 @@ func (s *Stub) UpdateStatus(version uint, status source.Status, errstr string) {
 	s.Migrations.UpdateStatus(version, status, errstr)
 }
 
+// UpdateStatusDir is like UpdateStatus, but only updates the migration of
+// direction dir.
+func (s *Stub) UpdateStatusDir(version uint, dir source.Direction, status source.Status, errstr string) {
+	s.Migrations.UpdateStatusDir(version, dir, status, errstr)
+}
+
 func (s *Stub) PrintSummary(dir source.Direction) {
 	// do nothing for stub as printed fields are null.
 }
@@ -0,0 +1,42 @@
+package source
+
+import (
+	"errors"
+	"os"
+)
+
+// TryPrev returns the version before version in d and true, or false if
+// there is none. Other errors of d are reported as false as well, use
+// TryPrevE to tell them apart.
+func TryPrev(d Driver, version uint) (uint, bool) {
+	prev, ok, _ := TryPrevE(d, version)
+	return prev, ok
+}
+
+// TryNext returns the version after version in d and true, or false if
+// there is none. Other errors of d are reported as false as well, use
+// TryNextE to tell them apart.
+func TryNext(d Driver, version uint) (uint, bool) {
+	next, ok, _ := TryNextE(d, version)
+	return next, ok
+}
+
+// TryPrevE is like TryPrev, but returns errors of d other than not exist.
+func TryPrevE(d Driver, version uint) (uint, bool, error) {
+	return try(d.Prev(version))
+}
+
+// TryNextE is like TryNext, but returns errors of d other than not exist.
+func TryNextE(d Driver, version uint) (uint, bool, error) {
+	return try(d.Next(version))
+}
+
+func try(version uint, err error) (uint, bool, error) {
+	if errors.Is(err, os.ErrNotExist) {
+		return 0, false, nil
+	}
+	if err != nil {
+		return 0, false, err
+	}
+	return version, true, nil
+}
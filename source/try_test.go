@@ -0,0 +1,69 @@
+//go:build go1.16
+// +build go1.16
+
+package source_test
+
+import (
+	"errors"
+	"testing"
+	"testing/fstest"
+
+	"github.com/nokia/migrate/v4/source"
+	"github.com/nokia/migrate/v4/source/iofs"
+	"github.com/nokia/migrate/v4/source/memory"
+)
+
+func TestTryPrevNext(t *testing.T) {
+	fsDriver, err := iofs.New(fstest.MapFS{
+		"migrations/1_foobar.up.sql": &fstest.MapFile{Data: []byte("1 up")},
+		"migrations/3_foobar.up.sql": &fstest.MapFile{Data: []byte("3 up")},
+	}, "migrations")
+	if err != nil {
+		t.Fatal(err)
+	}
+	drivers := map[string]source.Driver{
+		"iofs":   fsDriver,
+		"memory": memory.New().Add(1, source.Up, "1 up").Add(3, source.Up, "3 up"),
+	}
+	for name, d := range drivers {
+		t.Run(name, func(t *testing.T) {
+			if v, ok := source.TryNext(d, 1); !ok || v != 3 {
+				t.Errorf("expected next of 1 to be 3, got %v, %v", v, ok)
+			}
+			if v, ok := source.TryPrev(d, 3); !ok || v != 1 {
+				t.Errorf("expected prev of 3 to be 1, got %v, %v", v, ok)
+			}
+			if v, ok := source.TryNext(d, 3); ok {
+				t.Errorf("expected no next of 3, got %v", v)
+			}
+			if v, ok := source.TryPrev(d, 1); ok {
+				t.Errorf("expected no prev of 1, got %v", v)
+			}
+			if v, ok, err := source.TryNextE(d, 3); ok || err != nil {
+				t.Errorf("expected no next of 3 and no error, got %v, %v, %v", v, ok, err)
+			}
+		})
+	}
+}
+
+type failingDriver struct {
+	source.Driver
+	err error
+}
+
+func (d failingDriver) Prev(version uint) (uint, error) { return 0, d.err }
+func (d failingDriver) Next(version uint) (uint, error) { return 0, d.err }
+
+func TestTryNextError(t *testing.T) {
+	errList := errors.New("list failed")
+	d := failingDriver{err: errList}
+	if _, ok, err := source.TryNextE(d, 1); ok || err != errList {
+		t.Errorf("expected %v, got %v, %v", errList, ok, err)
+	}
+	if _, ok, err := source.TryPrevE(d, 1); ok || err != errList {
+		t.Errorf("expected %v, got %v, %v", errList, ok, err)
+	}
+	if _, ok := source.TryNext(d, 1); ok {
+		t.Error("expected false on error")
+	}
+}